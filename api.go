@@ -1,22 +1,65 @@
 package main
 
 import (
+	"crypto/tls"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"math/rand"
+	"net"
 	"net/http"
 	"sync"
 	"time"
 
+	"github.com/nadoo/glider/api"
+	"github.com/nadoo/glider/dns"
 	"github.com/nadoo/glider/pkg/log"
 	"github.com/nadoo/glider/rule"
+	"github.com/nadoo/glider/service/dhcpd"
 )
 
-// APIManager 管理API模式的全局状态
+// defaultGroup 未指定组名时使用的转发器组
+const defaultGroup = api.DefaultGroup
+
+// API 的数据结构定义在 api 包中，与客户端共用
+type (
+	ProxySelector       = api.ProxySelector
+	ProxyInfo           = api.ProxyInfo
+	GroupInfo           = api.GroupInfo
+	APIResponse         = api.APIResponse
+	AddForwarderRequest = api.AddForwarderRequest
+	ForwarderUpdate     = api.ForwarderUpdate
+	ConnectionInfo      = api.ConnectionInfo
+	CheckInfo           = api.CheckInfo
+	RotationInfo        = api.RotationInfo
+	SessionInfo         = api.SessionInfo
+	DNSInfo             = api.DNSInfo
+	DNSRecord           = api.DNSRecord
+	AddDNSRecordRequest = api.AddDNSRecordRequest
+	DHCPLease           = api.DHCPLease
+	DHCPReservation     = api.DHCPReservation
+	AuditEntry          = api.AuditEntry
+	AuditState          = api.AuditState
+	APIEvent            = api.APIEvent
+	RouteInfo           = api.RouteInfo
+)
+
+var (
+	errProxyNotFound     = errors.New("proxy not found")
+	errProxyDisabled     = errors.New("proxy is disabled")
+	errInvalidSelector   = errors.New("one of address, url, index, tag or step must be specified")
+	errInvalidSelectStep = errors.New("step must be next or previous")
+)
+
+// APIManager 管理API模式的状态，每个转发器组各自维护当前选中的代理
 type APIManager struct {
-	mu           sync.RWMutex
-	currentProxy *rule.Forwarder
-	proxyList    []*rule.Forwarder
-	rng          *rand.Rand
+	mu  sync.RWMutex
+	pxy *rule.Proxy
+	dns *dns.Server
+	rng *rand.Rand
+
+	rotators map[string]*rotator // 按组名索引的自动轮换器
+	dhcp     []dhcpd.Manager     // 运行中的 dhcpd 服务
 }
 
 // 全局API管理器实例
@@ -29,117 +72,456 @@ func GetAPIManager() *APIManager {
 	return apiManager
 }
 
-// SetProxyList 设置可用的代理列表
-func (am *APIManager) SetProxyList(proxies []*rule.Forwarder) {
+// SetProxy 设置规则代理，API管理器通过它访问所有转发器组，重新加载配置时复用的组
+// 保留事件监听和轮换器，新的同名组会保留原来选中的代理（如果它仍然存在）
+func (am *APIManager) SetProxy(pxy *rule.Proxy) {
 	am.mu.Lock()
 	defer am.mu.Unlock()
-	am.proxyList = make([]*rule.Forwarder, len(proxies))
-	copy(am.proxyList, proxies)
-	log.F("[api] updated proxy list with %d proxies", len(proxies))
+	old := am.pxy
+	am.pxy = pxy
+
+	rotators := make(map[string]*rotator)
+	for _, g := range pxy.Groups() {
+		// 重新加载时复用的组已经在监听事件，保留它的轮换器
+		if old != nil && old.Group(g.Name()) == g {
+			if r := am.rotators[g.Name()]; r != nil {
+				rotators[g.Name()] = r
+			}
+			continue
+		}
+
+		g.Watch(onGroupEvent)
+		if old != nil {
+			restoreCurrentProxy(old.Group(g.Name()), g)
+		}
+		if r := newRotator(am, g); r != nil {
+			rotators[g.Name()] = r
+		}
+		log.F("[api] group %s: %d proxies", g.Name(), len(g.GetForwarders()))
+	}
+
+	for name, r := range am.rotators {
+		if rotators[name] != r {
+			r.stop()
+		}
+	}
+	am.rotators = rotators
+}
+
+// restoreCurrentProxy 将旧组选中的代理对应到新组中 URL 相同的代理
+func restoreCurrentProxy(old, g *rule.FwdrGroup) {
+	if old == nil {
+		return
+	}
+
+	cur := old.CurrentProxy()
+	if cur == nil {
+		return
+	}
+
+	if f := findProxy(g.GetForwarders(), func(f *rule.Forwarder) bool { return f.URL() == cur.URL() }); f != nil {
+		g.SetCurrentProxy(f)
+	}
 }
 
-// GetCurrentProxy 获取当前选中的代理，如果为nil则随机选择一个
-func (am *APIManager) GetCurrentProxy() *rule.Forwarder {
+// SetDNS 设置DNS服务器，用于查看DNS缓存等信息
+func (am *APIManager) SetDNS(d *dns.Server) {
 	am.mu.Lock()
 	defer am.mu.Unlock()
+	am.dns = d
+}
 
-	// 如果当前代理为nil，随机选择一个
-	if am.currentProxy == nil && len(am.proxyList) > 0 {
-		idx := am.rng.Intn(len(am.proxyList))
-		am.currentProxy = am.proxyList[idx]
-		log.F("[api] auto selected proxy: %s", am.currentProxy.Addr())
+// DNS 获取DNS服务器，未启用时为nil
+func (am *APIManager) DNS() *dns.Server {
+	am.mu.RLock()
+	defer am.mu.RUnlock()
+	return am.dns
+}
+
+// AddDHCP 添加运行中的 dhcpd 服务，用于查看和管理租约
+func (am *APIManager) AddDHCP(m dhcpd.Manager) {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	am.dhcp = append(am.dhcp, m)
+}
+
+// DHCP 获取所有运行中的 dhcpd 服务
+func (am *APIManager) DHCP() []dhcpd.Manager {
+	am.mu.RLock()
+	defer am.mu.RUnlock()
+	return am.dhcp
+}
+
+// Groups 获取所有转发器组
+func (am *APIManager) Groups() []*rule.FwdrGroup {
+	am.mu.RLock()
+	defer am.mu.RUnlock()
+	if am.pxy == nil {
+		return nil
 	}
+	return am.pxy.Groups()
+}
+
+// Group 根据名称获取转发器组
+func (am *APIManager) Group(name string) *rule.FwdrGroup {
+	am.mu.RLock()
+	defer am.mu.RUnlock()
+	return am.group(name)
+}
 
-	return am.currentProxy
+// group 根据名称获取当前规则代理中的转发器组，调用时必须持有 am.mu；
+// 修改转发器组的操作需要在同一个锁内查找组，避免操作重新加载时被替换的旧组
+func (am *APIManager) group(name string) *rule.FwdrGroup {
+	if am.pxy == nil {
+		return nil
+	}
+	return am.pxy.Group(name)
 }
 
-// ChangeProxy 随机切换到不同的代理
-func (am *APIManager) ChangeProxy() (*rule.Forwarder, error) {
+// GetCurrentProxy 获取指定组当前选中的代理，未选择时为nil
+func (am *APIManager) GetCurrentProxy(group string) *rule.Forwarder {
+	g := am.Group(group)
+	if g == nil {
+		return nil
+	}
+	return g.CurrentProxy()
+}
+
+// ChangeProxy 将指定组随机切换到不同的代理
+func (am *APIManager) ChangeProxy(group string) (*rule.Forwarder, error) {
 	am.mu.Lock()
 	defer am.mu.Unlock()
 
-	if len(am.proxyList) == 0 {
+	g := am.group(group)
+	if g == nil {
+		return nil, nil
+	}
+
+	proxyList := g.GetForwarders()
+	if len(proxyList) == 0 {
 		return nil, nil
 	}
 
 	// 如果只有一个代理，直接返回
-	if len(am.proxyList) == 1 {
-		am.currentProxy = am.proxyList[0]
-		return am.currentProxy, nil
+	if len(proxyList) == 1 {
+		am.setCurrentProxy(g, proxyList[0])
+		return proxyList[0], nil
 	}
 
-	oldProxy := am.currentProxy
-	
+	oldProxy := g.CurrentProxy()
+
 	// 最多尝试3次找到不同的代理
 	for i := 0; i < 3; i++ {
-		idx := am.rng.Intn(len(am.proxyList))
-		newProxy := am.proxyList[idx]
-		
+		idx := am.rng.Intn(len(proxyList))
+		newProxy := proxyList[idx]
+
 		// 如果找到不同的代理，立即使用
 		if oldProxy == nil || newProxy.Addr() != oldProxy.Addr() {
-			am.currentProxy = newProxy
-			log.F("[api] changed proxy from %v to %s", 
-				func() string {
+			am.setCurrentProxy(g, newProxy)
+			log.F("[api] %s: changed proxy from %v to %s",
+				group, func() string {
 					if oldProxy != nil {
 						return oldProxy.Addr()
 					}
 					return "nil"
 				}(), newProxy.Addr())
-			return am.currentProxy, nil
+			return newProxy, nil
 		}
 	}
-	
+
 	// 如果3次都没找到不同的代理，使用最后一次的结果
-	if len(am.proxyList) > 0 {
-		idx := am.rng.Intn(len(am.proxyList))
-		am.currentProxy = am.proxyList[idx]
-		log.F("[api] changed proxy to %s (after 3 attempts)", am.currentProxy.Addr())
+	newProxy := proxyList[am.rng.Intn(len(proxyList))]
+	am.setCurrentProxy(g, newProxy)
+	log.F("[api] %s: changed proxy to %s (after 3 attempts)", group, newProxy.Addr())
+
+	return newProxy, nil
+}
+
+// SelectProxy 将指定组切换到选择器匹配的代理，目标不存在返回 errProxyNotFound，目标被禁用返回 errProxyDisabled
+func (am *APIManager) SelectProxy(group string, sel *ProxySelector) (*rule.Forwarder, error) {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+
+	g := am.group(group)
+	if g == nil {
+		return nil, errProxyNotFound
+	}
+
+	proxyList := g.GetForwarders()
+	if sel.Step != "" && sel.Index == nil && sel.Address == "" && sel.URL == "" && sel.Tag == "" {
+		return am.stepProxy(g, proxyList, sel.Step)
+	}
+
+	target, err := matchProxy(proxyList, sel)
+	if err != nil {
+		return nil, err
+	}
+
+	if !target.Enabled() {
+		return target, errProxyDisabled
+	}
+
+	am.setCurrentProxy(g, target)
+	log.F("[api] %s: selected proxy %s", group, target.Addr())
+
+	return target, nil
+}
+
+// stepProxy 从当前代理开始按列表顺序前进或后退到下一个可用的代理
+func (am *APIManager) stepProxy(g *rule.FwdrGroup, proxyList []*rule.Forwarder, step string) (*rule.Forwarder, error) {
+	var delta int
+	switch step {
+	case "next":
+		delta = 1
+	case "previous", "prev":
+		delta = -1
+	default:
+		return nil, errInvalidSelectStep
+	}
+
+	if len(proxyList) == 0 {
+		return nil, errProxyNotFound
+	}
+
+	// 当前代理不在列表中时，next 从第一个开始，previous 从最后一个开始
+	cur := -1
+	if delta < 0 {
+		cur = len(proxyList)
+	}
+	if current := g.CurrentProxy(); current != nil {
+		for i, f := range proxyList {
+			if f == current {
+				cur = i
+				break
+			}
+		}
+	}
+
+	n := len(proxyList)
+	for i := 1; i <= n; i++ {
+		f := proxyList[((cur+delta*i)%n+n)%n]
+		if f.Enabled() {
+			am.setCurrentProxy(g, f)
+			log.F("[api] %s: stepped to %s proxy %s", g.Name(), step, f.Addr())
+			return f, nil
+		}
+	}
+
+	return nil, errProxyDisabled
+}
+
+// matchProxy 返回列表中与选择器匹配的代理，不处理 step 字段
+func matchProxy(proxyList []*rule.Forwarder, sel *ProxySelector) (*rule.Forwarder, error) {
+	var target *rule.Forwarder
+	switch {
+	case sel.Index != nil:
+		if *sel.Index >= 0 && *sel.Index < len(proxyList) {
+			target = proxyList[*sel.Index]
+		}
+	case sel.Address != "":
+		target = findProxy(proxyList, func(f *rule.Forwarder) bool { return f.Addr() == sel.Address })
+	case sel.URL != "":
+		target = findProxy(proxyList, func(f *rule.Forwarder) bool { return f.URL() == sel.URL })
+	case sel.Tag != "":
+		target = findProxy(proxyList, func(f *rule.Forwarder) bool { return f.Tag() == sel.Tag })
+	default:
+		return nil, errInvalidSelector
 	}
-	
-	return am.currentProxy, nil
+
+	if target == nil {
+		return nil, errProxyNotFound
+	}
+	return target, nil
 }
 
-// ProxyInfo 代理信息结构
-type ProxyInfo struct {
-	Address  string `json:"address"`
-	Priority uint32 `json:"priority"`
-	Enabled  bool   `json:"enabled"`
-	Latency  int64  `json:"latency"`
+// findProxy 返回列表中第一个满足条件的代理
+func findProxy(proxyList []*rule.Forwarder, match func(*rule.Forwarder) bool) *rule.Forwarder {
+	for _, f := range proxyList {
+		if match(f) {
+			return f
+		}
+	}
+	return nil
 }
 
-// APIResponse API响应结构
-type APIResponse struct {
-	Success      bool        `json:"success"`
-	Message      string      `json:"message"`
-	CurrentProxy *ProxyInfo  `json:"current_proxy,omitempty"`
-	ProxyList    []ProxyInfo `json:"proxy_list,omitempty"`
+// newProxyInfo 根据转发器生成代理信息
+func newProxyInfo(f *rule.Forwarder) *ProxyInfo {
+	return &ProxyInfo{
+		Address:   f.Addr(),
+		Tag:       f.Tag(),
+		Priority:  f.Priority(),
+		Enabled:   f.Enabled(),
+		Suspended: f.Suspended(),
+		Latency:   f.Latency(),
+	}
 }
 
-// StartAPIServer 启动API服务器
-func StartAPIServer(port string) {
+// newGroupInfo 根据转发器组生成组信息
+func newGroupInfo(g *rule.FwdrGroup) GroupInfo {
+	fwdrs := g.GetForwarders()
+	info := GroupInfo{Name: g.Name(), Strategy: g.Strategy(), Total: len(fwdrs)}
+	for _, f := range fwdrs {
+		if f.Enabled() {
+			info.Enabled++
+		}
+	}
+	if g.Strategy() == "api" {
+		if f := g.CurrentProxy(); f != nil {
+			info.CurrentProxy = newProxyInfo(f)
+		}
+	}
+	return info
+}
+
+// StartAPIServer 启动API服务器，返回的 http.Server 可用于关闭API服务器
+func StartAPIServer(c *APIConfig) (*http.Server, error) {
 	mux := http.NewServeMux()
-	
+
+	// handle 注册接口，修改状态的请求会记录到审计日志
+	handle := func(pattern string, h http.HandlerFunc) {
+		mux.HandleFunc(pattern, audited(h))
+	}
+
 	// 代理切换接口
-	mux.HandleFunc("/api/proxy/change", handleProxyChange)
-	
+	handle("/api/proxy/change", handleProxyChange)
+
+	// 代理指定切换接口
+	handle("/api/proxy/select", handleProxySelect)
+
 	// 获取当前代理信息接口
-	mux.HandleFunc("/api/proxy/current", handleGetCurrent)
-	
+	handle("/api/proxy/current", handleGetCurrent)
+
 	// 获取所有代理列表接口
-	mux.HandleFunc("/api/proxy/list", handleGetProxyList)
+	handle("/api/proxy/list", handleGetProxyList)
+
+	// 转发器组接口
+	handle("/api/groups", handleGetGroups)
+	handle("/api/groups/{name}/forwarders", handleForwarders)
+	handle("/api/groups/{name}/current", handleGetCurrent)
+	handle("/api/groups/{name}/change", handleProxyChange)
+	handle("/api/groups/{name}/select", handleProxySelect)
+	handle("/api/groups/{name}/check", handleCheckGroup)
+
+	// 健康检查接口
+	handle("/api/check", handleCheckAll)
+
+	// 粘性会话接口
+	handle("/api/sessions", handleSessions)
+	handle("/api/sessions/{id}", handleExpireSession)
+	handle("/api/sessions/{id}/reroll", handleRerollSession)
+
+	// 连接表接口
+	handle("/api/connections", handleConnections)
+	handle("/api/connections/{id}", handleCloseConnection)
+
+	// 重新加载配置接口
+	handle("/api/reload", handleReload)
+
+	// 事件流接口
+	handle("/api/events", handleEvents)
+
+	// DNS 缓存接口
+	handle("/api/dns", handleDNS)
+	handle("/api/dns/cache", handleDNSCache)
+	handle("/api/dns/cache/{name}", handleDNSCacheEntry)
+	handle("/api/dns/records", handleAddDNSRecord)
+	handle("/api/dns/records/{name}", handleRemoveDNSRecord)
+
+	// DHCP 租约接口
+	handle("/api/dhcp/leases", handleDHCPLeases)
+	handle("/api/dhcp/leases/{mac}", handleReleaseDHCPLease)
+	handle("/api/dhcp/static", handleAddDHCPStatic)
+	handle("/api/dhcp/static/{mac}", handleRemoveDHCPStatic)
+
+	// 路由查询接口
+	handle("/api/route", handleRoute)
+
+	// 审计日志接口
+	handle("/api/audit", handleAudit)
+
+	// Prometheus 监控指标接口
+	mux.HandleFunc("/metrics", handleMetrics)
+
+	auth := newAPIAuth(c.Auth, c.ReadOnlyAuth)
+
+	// 管理页面
+	root := http.NewServeMux()
+	root.Handle("/dashboard/", dashboardHandler())
+	root.Handle("/{$}", http.RedirectHandler("/dashboard/", http.StatusFound))
+	root.Handle("/", auth.wrap(mux))
 
 	server := &http.Server{
-		Addr:    ":" + port,
-		Handler: mux,
+		Addr:    c.Listen,
+		Handler: root,
+	}
+	// Shutdown 不会等待事件流这种长连接，需要主动结束它们
+	server.RegisterOnShutdown(apiEvents.close)
+
+	if c.CertFile != "" || c.KeyFile != "" {
+		if c.CertFile == "" || c.KeyFile == "" {
+			return nil, errors.New("[api] both apicert and apikey must be specified")
+		}
+
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("[api] unable to load cert: %s, key %s, error: %s", c.CertFile, c.KeyFile, err)
+		}
+
+		server.TLSConfig = &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		}
+	}
+
+	l, err := net.Listen("tcp", c.Listen)
+	if err != nil {
+		return nil, fmt.Errorf("[api] failed to listen on %s: %v", c.Listen, err)
 	}
 
-	log.F("[api] starting API server on port %s", port)
-	
+	if auth.disabled() {
+		log.F("[api] WARNING: no apiauth specified, anyone who can reach %s can manage glider", c.Listen)
+	}
+
+	log.F("[api] starting API server on %s, with TLS: %v", c.Listen, server.TLSConfig != nil)
+
 	go func() {
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if server.TLSConfig != nil {
+			err = server.ServeTLS(l, "", "")
+		} else {
+			err = server.Serve(l)
+		}
+		if err != nil && err != http.ErrServerClosed {
 			log.F("[api] API server error: %v", err)
 		}
 	}()
+
+	return server, nil
+}
+
+// groupName 从请求中获取组名：路径参数 {name} 优先，其次是查询参数 group，默认为 main
+func groupName(r *http.Request) string {
+	if name := r.PathValue("name"); name != "" {
+		return name
+	}
+	if name := r.URL.Query().Get("group"); name != "" {
+		return name
+	}
+	return defaultGroup
+}
+
+// lookupGroup 查找请求对应的转发器组，找不到时写入404响应并返回nil
+func lookupGroup(w http.ResponseWriter, r *http.Request) *rule.FwdrGroup {
+	name := groupName(r)
+	g := apiManager.Group(name)
+	if g == nil {
+		writeAPIResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Group not found: " + name,
+			Group:   name,
+		})
+	}
+	return g
 }
 
 // handleProxyChange 处理代理切换请求
@@ -152,11 +534,17 @@ func handleProxyChange(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	newProxy, err := apiManager.ChangeProxy()
+	g := lookupGroup(w, r)
+	if g == nil {
+		return
+	}
+
+	newProxy, err := apiManager.ChangeProxy(g.Name())
 	if err != nil {
 		writeAPIResponse(w, http.StatusInternalServerError, APIResponse{
 			Success: false,
 			Message: "Failed to change proxy: " + err.Error(),
+			Group:   g.Name(),
 		})
 		return
 	}
@@ -165,24 +553,76 @@ func handleProxyChange(w http.ResponseWriter, r *http.Request) {
 		writeAPIResponse(w, http.StatusNotFound, APIResponse{
 			Success: false,
 			Message: "No proxies available",
+			Group:   g.Name(),
 		})
 		return
 	}
 
 	response := APIResponse{
-		Success: true,
-		Message: "Proxy changed successfully",
-		CurrentProxy: &ProxyInfo{
-			Address:  newProxy.Addr(),
-			Priority: newProxy.Priority(),
-			Enabled:  newProxy.Enabled(),
-			Latency:  newProxy.Latency(),
-		},
+		Success:      true,
+		Message:      "Proxy changed successfully",
+		Group:        g.Name(),
+		CurrentProxy: newProxyInfo(newProxy),
 	}
 
 	writeAPIResponse(w, http.StatusOK, response)
 }
 
+// handleProxySelect 处理指定代理切换请求
+func handleProxySelect(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeAPIResponse(w, http.StatusMethodNotAllowed, APIResponse{
+			Success: false,
+			Message: "Method not allowed, use POST",
+		})
+		return
+	}
+
+	g := lookupGroup(w, r)
+	if g == nil {
+		return
+	}
+
+	var sel ProxySelector
+	if err := json.NewDecoder(r.Body).Decode(&sel); err != nil {
+		writeAPIResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid request body: " + err.Error(),
+			Group:   g.Name(),
+		})
+		return
+	}
+
+	newProxy, err := apiManager.SelectProxy(g.Name(), &sel)
+	if err != nil {
+		status := http.StatusBadRequest
+		switch {
+		case errors.Is(err, errProxyNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, errProxyDisabled):
+			status = http.StatusConflict
+		}
+
+		response := APIResponse{
+			Success: false,
+			Message: "Failed to select proxy: " + err.Error(),
+			Group:   g.Name(),
+		}
+		if newProxy != nil {
+			response.CurrentProxy = newProxyInfo(newProxy)
+		}
+		writeAPIResponse(w, status, response)
+		return
+	}
+
+	writeAPIResponse(w, http.StatusOK, APIResponse{
+		Success:      true,
+		Message:      "Proxy selected successfully",
+		Group:        g.Name(),
+		CurrentProxy: newProxyInfo(newProxy),
+	})
+}
+
 // handleGetCurrent 处理获取当前代理请求
 func handleGetCurrent(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -193,24 +633,27 @@ func handleGetCurrent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	currentProxy := apiManager.GetCurrentProxy()
+	g := lookupGroup(w, r)
+	if g == nil {
+		return
+	}
+
+	currentProxy := g.CurrentProxy()
 	if currentProxy == nil {
 		writeAPIResponse(w, http.StatusNotFound, APIResponse{
 			Success: false,
 			Message: "No current proxy set",
+			Group:   g.Name(),
 		})
 		return
 	}
 
 	response := APIResponse{
-		Success: true,
-		Message: "Current proxy retrieved successfully",
-		CurrentProxy: &ProxyInfo{
-			Address:  currentProxy.Addr(),
-			Priority: currentProxy.Priority(),
-			Enabled:  currentProxy.Enabled(),
-			Latency:  currentProxy.Latency(),
-		},
+		Success:      true,
+		Message:      "Current proxy retrieved successfully",
+		Group:        g.Name(),
+		CurrentProxy: newProxyInfo(currentProxy),
+		Rotation:     apiManager.Rotation(g.Name()),
 	}
 
 	writeAPIResponse(w, http.StatusOK, response)
@@ -226,32 +669,59 @@ func handleGetProxyList(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	apiManager.mu.RLock()
-	proxyList := make([]ProxyInfo, len(apiManager.proxyList))
-	for i, proxy := range apiManager.proxyList {
-		proxyList[i] = ProxyInfo{
-			Address:  proxy.Addr(),
-			Priority: proxy.Priority(),
-			Enabled:  proxy.Enabled(),
-			Latency:  proxy.Latency(),
-		}
+	g := lookupGroup(w, r)
+	if g == nil {
+		return
+	}
+
+	fwdrs := g.GetForwarders()
+	proxyList := make([]ProxyInfo, len(fwdrs))
+	for i, proxy := range fwdrs {
+		proxyList[i] = *newProxyInfo(proxy)
 	}
-	apiManager.mu.RUnlock()
 
 	response := APIResponse{
 		Success:   true,
 		Message:   "Proxy list retrieved successfully",
+		Group:     g.Name(),
 		ProxyList: proxyList,
 	}
 
 	writeAPIResponse(w, http.StatusOK, response)
 }
 
+// handleGetGroups 处理获取转发器组列表请求
+func handleGetGroups(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIResponse(w, http.StatusMethodNotAllowed, APIResponse{
+			Success: false,
+			Message: "Method not allowed, use GET",
+		})
+		return
+	}
+
+	writeAPIResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Group list retrieved successfully",
+		Groups:  groupInfos(),
+	})
+}
+
+// groupInfos 获取所有转发器组的信息
+func groupInfos() []GroupInfo {
+	groups := apiManager.Groups()
+	groupList := make([]GroupInfo, len(groups))
+	for i, g := range groups {
+		groupList[i] = newGroupInfo(g)
+	}
+	return groupList
+}
+
 // writeAPIResponse 写入API响应
 func writeAPIResponse(w http.ResponseWriter, status int, response APIResponse) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
-	
+
 	if err := json.NewEncoder(w).Encode(response); err != nil {
 		log.F("[api] failed to encode response: %v", err)
 	}
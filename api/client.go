@@ -0,0 +1,510 @@
+// Package api 定义 glider API 的数据结构，并提供访问 API 的客户端。
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Error API 请求失败时返回的错误
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("api: %s (%d)", e.Message, e.StatusCode)
+}
+
+// Client glider API 客户端
+type Client struct {
+	BaseURL    string       // API 服务器地址，例如 http://127.0.0.1:9000
+	Credential string       // 凭据，TOKEN 或 USER:PASS，为空时不认证
+	HTTPClient *http.Client // 为空时使用 http.DefaultClient
+}
+
+// NewClient 创建 API 客户端，baseURL 没有 scheme 时使用 http
+func NewClient(baseURL, credential string) *Client {
+	if !strings.Contains(baseURL, "://") {
+		baseURL = "http://" + baseURL
+	}
+	return &Client{BaseURL: strings.TrimSuffix(baseURL, "/"), Credential: credential}
+}
+
+// query 将选择器转换为查询参数
+func (s ProxySelector) query() url.Values {
+	q := url.Values{}
+	if s.Address != "" {
+		q.Set("address", s.Address)
+	}
+	if s.URL != "" {
+		q.Set("url", s.URL)
+	}
+	if s.Index != nil {
+		q.Set("index", strconv.Itoa(*s.Index))
+	}
+	if s.Tag != "" {
+		q.Set("tag", s.Tag)
+	}
+	return q
+}
+
+// groupPath 返回组接口的路径，组名为空时使用默认组
+func groupPath(group, endpoint string) string {
+	if group == "" {
+		group = DefaultGroup
+	}
+	return "/api/groups/" + url.PathEscape(group) + "/" + endpoint
+}
+
+// groupQuery 返回只包含组名的查询参数，组名为空时返回 nil
+func groupQuery(group string) url.Values {
+	if group == "" {
+		return nil
+	}
+	return url.Values{"group": {group}}
+}
+
+// request 创建 API 请求，body 不为 nil 时以 JSON 格式发送
+func (c *Client) request(ctx context.Context, method, path string, query url.Values, body any) (*http.Request, error) {
+	u := c.BaseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, r)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	// USER:PASS 使用 Basic 认证，否则作为 Bearer Token
+	if user, pass, ok := strings.Cut(c.Credential, ":"); ok {
+		req.SetBasicAuth(user, pass)
+	} else if c.Credential != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Credential)
+	}
+	return req, nil
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// do 发送 API 请求并解析响应，请求失败时返回 *Error
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body any) (*APIResponse, error) {
+	req, err := c.request(ctx, method, path, query, body)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var res APIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		if resp.StatusCode >= 400 {
+			return nil, &Error{StatusCode: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+		}
+		return nil, fmt.Errorf("api: invalid response: %w", err)
+	}
+
+	if !res.Success || resp.StatusCode >= 400 {
+		return &res, &Error{StatusCode: resp.StatusCode, Message: res.Message}
+	}
+	return &res, nil
+}
+
+// Groups 获取所有转发器组
+func (c *Client) Groups(ctx context.Context) ([]GroupInfo, error) {
+	res, err := c.do(ctx, http.MethodGet, "/api/groups", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return res.Groups, nil
+}
+
+// Forwarders 获取组的所有转发器
+func (c *Client) Forwarders(ctx context.Context, group string) ([]ProxyInfo, error) {
+	res, err := c.do(ctx, http.MethodGet, groupPath(group, "forwarders"), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return res.ProxyList, nil
+}
+
+// Current 获取组当前选中的代理和自动轮换状态，组没有配置自动轮换时 RotationInfo 为 nil
+func (c *Client) Current(ctx context.Context, group string) (*ProxyInfo, *RotationInfo, error) {
+	res, err := c.do(ctx, http.MethodGet, groupPath(group, "current"), nil, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return res.CurrentProxy, res.Rotation, nil
+}
+
+// Change 将组随机切换到不同的代理
+func (c *Client) Change(ctx context.Context, group string) (*ProxyInfo, error) {
+	res, err := c.do(ctx, http.MethodPost, groupPath(group, "change"), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return res.CurrentProxy, nil
+}
+
+// Select 将组切换到选择器匹配的代理
+func (c *Client) Select(ctx context.Context, group string, sel ProxySelector) (*ProxyInfo, error) {
+	res, err := c.do(ctx, http.MethodPost, groupPath(group, "select"), nil, sel)
+	if err != nil {
+		return nil, err
+	}
+	return res.CurrentProxy, nil
+}
+
+// AddForwarder 向组添加转发器，forwardURL 格式与 -forward 参数相同
+func (c *Client) AddForwarder(ctx context.Context, group, forwardURL string) (*ProxyInfo, error) {
+	res, err := c.do(ctx, http.MethodPost, groupPath(group, "forwarders"), nil, AddForwarderRequest{URL: forwardURL})
+	if err != nil {
+		return nil, err
+	}
+	return res.Proxy, nil
+}
+
+// RemoveForwarder 从组中删除选择器匹配的转发器
+func (c *Client) RemoveForwarder(ctx context.Context, group string, sel ProxySelector) (*ProxyInfo, error) {
+	res, err := c.do(ctx, http.MethodDelete, groupPath(group, "forwarders"), sel.query(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return res.Proxy, nil
+}
+
+// UpdateForwarder 修改选择器匹配的转发器的属性
+func (c *Client) UpdateForwarder(ctx context.Context, group string, sel ProxySelector, update ForwarderUpdate) (*ProxyInfo, error) {
+	res, err := c.do(ctx, http.MethodPatch, groupPath(group, "forwarders"), sel.query(), update)
+	if err != nil {
+		return nil, err
+	}
+	return res.Proxy, nil
+}
+
+// CheckAll 立即检查所有组的转发器
+func (c *Client) CheckAll(ctx context.Context) ([]CheckInfo, error) {
+	res, err := c.do(ctx, http.MethodPost, "/api/check", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return res.Checks, nil
+}
+
+// Check 立即检查组的转发器，选择器为空时检查组内所有转发器
+func (c *Client) Check(ctx context.Context, group string, sel ProxySelector) ([]CheckInfo, error) {
+	res, err := c.do(ctx, http.MethodPost, groupPath(group, "check"), sel.query(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return res.Checks, nil
+}
+
+// Connections 获取正在转发的连接，forwarder 不为空时只返回经过该转发器的连接
+func (c *Client) Connections(ctx context.Context, forwarder string) ([]ConnectionInfo, error) {
+	var query url.Values
+	if forwarder != "" {
+		query = url.Values{"forwarder": {forwarder}}
+	}
+	res, err := c.do(ctx, http.MethodGet, "/api/connections", query, nil)
+	if err != nil {
+		return nil, err
+	}
+	return res.Connections, nil
+}
+
+// CloseConnection 关闭指定的连接
+func (c *Client) CloseConnection(ctx context.Context, id uint64) (*ConnectionInfo, error) {
+	res, err := c.do(ctx, http.MethodDelete, "/api/connections/"+strconv.FormatUint(id, 10), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Connections) == 0 {
+		return nil, nil
+	}
+	return &res.Connections[0], nil
+}
+
+// CloseConnections 关闭经过指定转发器的所有连接
+func (c *Client) CloseConnections(ctx context.Context, forwarder string) error {
+	_, err := c.do(ctx, http.MethodDelete, "/api/connections", url.Values{"forwarder": {forwarder}}, nil)
+	return err
+}
+
+// Sessions 获取粘性会话，group 为空时返回所有组的会话
+func (c *Client) Sessions(ctx context.Context, group string) ([]SessionInfo, error) {
+	res, err := c.do(ctx, http.MethodGet, "/api/sessions", groupQuery(group), nil)
+	if err != nil {
+		return nil, err
+	}
+	return res.Sessions, nil
+}
+
+// ExpireSession 使会话过期，group 为空时作用于所有组
+func (c *Client) ExpireSession(ctx context.Context, id, group string) error {
+	_, err := c.do(ctx, http.MethodDelete, "/api/sessions/"+url.PathEscape(id), groupQuery(group), nil)
+	return err
+}
+
+// RerollSession 为会话重新选择代理，group 为空时作用于所有组
+func (c *Client) RerollSession(ctx context.Context, id, group string) ([]SessionInfo, error) {
+	res, err := c.do(ctx, http.MethodPost, "/api/sessions/"+url.PathEscape(id)+"/reroll", groupQuery(group), nil)
+	if err != nil {
+		return nil, err
+	}
+	return res.Sessions, nil
+}
+
+// Reload 重新加载配置文件，返回加载后的转发器组
+func (c *Client) Reload(ctx context.Context) ([]GroupInfo, error) {
+	res, err := c.do(ctx, http.MethodPost, "/api/reload", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return res.Groups, nil
+}
+
+// DNS 获取 DNS 缓存统计信息
+func (c *Client) DNS(ctx context.Context) (*DNSInfo, error) {
+	res, err := c.do(ctx, http.MethodGet, "/api/dns", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return res.DNS, nil
+}
+
+// DNSCache 获取DNS缓存中的所有记录，自定义记录在前
+func (c *Client) DNSCache(ctx context.Context) ([]DNSRecord, error) {
+	res, err := c.do(ctx, http.MethodGet, "/api/dns/cache", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return res.DNSRecords, nil
+}
+
+// LookupDNSCache 查看域名在DNS缓存中的记录，qtype 可以是 A、AAAA 或数字，为空时是 A
+func (c *Client) LookupDNSCache(ctx context.Context, name, qtype string) (*DNSRecord, error) {
+	var query url.Values
+	if qtype != "" {
+		query = url.Values{"type": {qtype}}
+	}
+	res, err := c.do(ctx, http.MethodGet, "/api/dns/cache/"+url.PathEscape(name), query, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(res.DNSRecords) == 0 {
+		return nil, nil
+	}
+	return &res.DNSRecords[0], nil
+}
+
+// DeleteDNSCache 删除域名的缓存记录，suffix 为 true 时同时删除子域名的记录，不影响自定义记录
+func (c *Client) DeleteDNSCache(ctx context.Context, name string, suffix bool) error {
+	var query url.Values
+	if suffix {
+		query = url.Values{"suffix": {"true"}}
+	}
+	_, err := c.do(ctx, http.MethodDelete, "/api/dns/cache/"+url.PathEscape(name), query, nil)
+	return err
+}
+
+// FlushDNSCache 清空DNS缓存，不影响自定义记录
+func (c *Client) FlushDNSCache(ctx context.Context) error {
+	_, err := c.do(ctx, http.MethodDelete, "/api/dns/cache", nil, nil)
+	return err
+}
+
+// AddDNSRecord 添加自定义DNS记录，格式与 -dnsrecord 参数相同，如 www.example.com/1.2.3.4
+func (c *Client) AddDNSRecord(ctx context.Context, record string) (*DNSRecord, error) {
+	res, err := c.do(ctx, http.MethodPost, "/api/dns/records", nil, AddDNSRecordRequest{Record: record})
+	if err != nil {
+		return nil, err
+	}
+	if len(res.DNSRecords) == 0 {
+		return nil, nil
+	}
+	return &res.DNSRecords[0], nil
+}
+
+// RemoveDNSRecord 删除域名的自定义DNS记录
+func (c *Client) RemoveDNSRecord(ctx context.Context, name string) error {
+	_, err := c.do(ctx, http.MethodDelete, "/api/dns/records/"+url.PathEscape(name), nil, nil)
+	return err
+}
+
+// DHCPLeases 获取 dhcpd 服务的租约，iface 不为空时只返回该接口的租约
+func (c *Client) DHCPLeases(ctx context.Context, iface string) ([]DHCPLease, error) {
+	res, err := c.do(ctx, http.MethodGet, "/api/dhcp/leases", ifaceQuery(iface), nil)
+	if err != nil {
+		return nil, err
+	}
+	return res.DHCPLeases, nil
+}
+
+// ReleaseDHCPLease 释放 MAC 地址的动态租约，iface 为空时作用于所有接口
+func (c *Client) ReleaseDHCPLease(ctx context.Context, mac, iface string) error {
+	_, err := c.do(ctx, http.MethodDelete, "/api/dhcp/leases/"+url.PathEscape(mac), ifaceQuery(iface), nil)
+	return err
+}
+
+// AddDHCPStatic 为 MAC 地址添加静态地址
+func (c *Client) AddDHCPStatic(ctx context.Context, r DHCPReservation) (*DHCPLease, error) {
+	res, err := c.do(ctx, http.MethodPost, "/api/dhcp/static", nil, r)
+	if err != nil {
+		return nil, err
+	}
+	if len(res.DHCPLeases) == 0 {
+		return nil, nil
+	}
+	return &res.DHCPLeases[0], nil
+}
+
+// RemoveDHCPStatic 删除 MAC 地址的静态地址，iface 为空时作用于所有接口
+func (c *Client) RemoveDHCPStatic(ctx context.Context, mac, iface string) error {
+	_, err := c.do(ctx, http.MethodDelete, "/api/dhcp/static/"+url.PathEscape(mac), ifaceQuery(iface), nil)
+	return err
+}
+
+// ifaceQuery 返回只包含接口名的查询参数，接口名为空时返回 nil
+func ifaceQuery(iface string) url.Values {
+	if iface == "" {
+		return nil
+	}
+	return url.Values{"interface": {iface}}
+}
+
+// Audit 查询审计日志，返回满足条件的最近的记录，按时间顺序排列
+func (c *Client) Audit(ctx context.Context, q AuditQuery) ([]AuditEntry, error) {
+	query := url.Values{}
+	if q.User != "" {
+		query.Set("user", q.User)
+	}
+	if q.Group != "" {
+		query.Set("group", q.Group)
+	}
+	if !q.Since.IsZero() {
+		query.Set("since", q.Since.Format(time.RFC3339))
+	}
+	if q.Limit > 0 {
+		query.Set("limit", strconv.Itoa(q.Limit))
+	}
+
+	res, err := c.do(ctx, http.MethodGet, "/api/audit", query, nil)
+	if err != nil {
+		return nil, err
+	}
+	return res.Audit, nil
+}
+
+// Route 查询请求会匹配的规则和使用的转发器，不会发起连接
+func (c *Client) Route(ctx context.Context, q RouteQuery) (*RouteInfo, error) {
+	query := url.Values{"addr": {q.Addr}}
+	if q.Network != "" {
+		query.Set("network", q.Network)
+	}
+	if q.Src != "" {
+		query.Set("src", q.Src)
+	}
+	if q.Listener != "" {
+		query.Set("listener", q.Listener)
+	}
+
+	res, err := c.do(ctx, http.MethodGet, "/api/route", query, nil)
+	if err != nil {
+		return nil, err
+	}
+	return res.Route, nil
+}
+
+// Metrics 获取 Prometheus 格式的监控指标
+func (c *Client) Metrics(ctx context.Context) (string, error) {
+	req, err := c.request(ctx, http.MethodGet, "/metrics", nil, nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", &Error{StatusCode: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+	}
+
+	b, err := io.ReadAll(resp.Body)
+	return string(b), err
+}
+
+// Events 订阅事件流，每收到一个事件调用一次 fn，直到 ctx 结束或服务器关闭事件流，
+// group 不为空时只接收该组的事件
+func (c *Client) Events(ctx context.Context, group string, fn func(APIEvent)) error {
+	req, err := c.request(ctx, http.MethodGet, "/api/events", groupQuery(group), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var res APIResponse
+		if json.NewDecoder(resp.Body).Decode(&res) != nil {
+			res.Message = http.StatusText(resp.StatusCode)
+		}
+		return &Error{StatusCode: resp.StatusCode, Message: res.Message}
+	}
+
+	sc := bufio.NewScanner(resp.Body)
+	for sc.Scan() {
+		data, ok := strings.CutPrefix(sc.Text(), "data: ")
+		if !ok {
+			continue
+		}
+
+		var ev APIEvent
+		if err := json.Unmarshal([]byte(data), &ev); err != nil {
+			return fmt.Errorf("api: invalid event: %w", err)
+		}
+		fn(ev)
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return sc.Err()
+}
@@ -0,0 +1,215 @@
+package api
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// DefaultGroup 未指定组名时使用的转发器组
+const DefaultGroup = "main"
+
+// ProxySelector 代理选择条件，按 index、address、url、tag、step 的顺序使用第一个指定的字段
+type ProxySelector struct {
+	Address string `json:"address,omitempty"`
+	URL     string `json:"url,omitempty"`
+	Index   *int   `json:"index,omitempty"`
+	Tag     string `json:"tag,omitempty"`
+	Step    string `json:"step,omitempty"` // next 或 previous
+}
+
+// ProxyInfo 代理信息结构
+type ProxyInfo struct {
+	Address   string `json:"address"`
+	Tag       string `json:"tag,omitempty"`
+	Priority  uint32 `json:"priority"`
+	Enabled   bool   `json:"enabled"`
+	Suspended bool   `json:"suspended,omitempty"` // 通过 API 手动禁用
+	Latency   int64  `json:"latency"`
+}
+
+// GroupInfo 转发器组信息结构
+type GroupInfo struct {
+	Name         string     `json:"name"`
+	Strategy     string     `json:"strategy"`
+	Total        int        `json:"total"`
+	Enabled      int        `json:"enabled"`
+	CurrentProxy *ProxyInfo `json:"current_proxy,omitempty"`
+}
+
+// APIResponse API响应结构
+type APIResponse struct {
+	Success      bool             `json:"success"`
+	Message      string           `json:"message"`
+	Group        string           `json:"group,omitempty"`
+	Proxy        *ProxyInfo       `json:"proxy,omitempty"`
+	CurrentProxy *ProxyInfo       `json:"current_proxy,omitempty"`
+	ProxyList    []ProxyInfo      `json:"proxy_list,omitempty"`
+	Groups       []GroupInfo      `json:"groups,omitempty"`
+	Connections  []ConnectionInfo `json:"connections,omitempty"`
+	Checks       []CheckInfo      `json:"checks,omitempty"`
+	Rotation     *RotationInfo    `json:"rotation,omitempty"`
+	Sessions     []SessionInfo    `json:"sessions,omitempty"`
+	DNS          *DNSInfo         `json:"dns,omitempty"`
+	DNSRecords   []DNSRecord      `json:"dns_records,omitempty"`
+	DHCPLeases   []DHCPLease      `json:"dhcp_leases,omitempty"`
+	Audit        []AuditEntry     `json:"audit,omitempty"`
+	Route        *RouteInfo       `json:"route,omitempty"`
+}
+
+// RouteInfo 请求的路由结果，directive 为空时没有匹配规则，使用 main 组
+type RouteInfo struct {
+	Addr      string     `json:"addr"`
+	Network   string     `json:"network"`
+	RuleFile  string     `json:"rule_file,omitempty"`
+	Directive string     `json:"directive,omitempty"` // ip、learned、cidr、geoip、domain 等匹配的规则类型
+	Value     string     `json:"value,omitempty"`     // 匹配的规则值，learned 时是解析出该 IP 的域名
+	Group     string     `json:"group"`
+	Forwarder *ProxyInfo `json:"forwarder,omitempty"` // 组的策略当前会选择的转发器，直连时为空
+}
+
+// AddForwarderRequest 添加转发器的请求，URL 格式与 -forward 参数相同，可以带 #priority=N&tag=NAME 等选项
+type AddForwarderRequest struct {
+	URL string `json:"url"`
+}
+
+// ForwarderUpdate 转发器可修改的属性，未指定的字段保持不变
+type ForwarderUpdate struct {
+	Priority    *uint32 `json:"priority,omitempty"`
+	Tag         *string `json:"tag,omitempty"`
+	MaxFailures *uint32 `json:"max_failures,omitempty"`
+	Enabled     *bool   `json:"enabled,omitempty"` // false 手动禁用，健康检查不会再启用它；true 取消手动禁用并启用
+}
+
+// ConnectionInfo 正在转发的连接信息
+type ConnectionInfo struct {
+	ID        uint64    `json:"id"`
+	Network   string    `json:"network"`
+	Client    string    `json:"client"`
+	Target    string    `json:"target,omitempty"`
+	Forwarder string    `json:"forwarder"`
+	Start     time.Time `json:"start"`
+	Upload    uint64    `json:"upload"`
+	Download  uint64    `json:"download"`
+}
+
+// CheckInfo 健康检查结果
+type CheckInfo struct {
+	Group   string     `json:"group"`
+	Proxy   *ProxyInfo `json:"proxy"`
+	Elapsed int64      `json:"elapsed"` // 单位与 latency 相同为纳秒
+	Error   string     `json:"error,omitempty"`
+}
+
+// RotationInfo 组的自动轮换策略和状态
+type RotationInfo struct {
+	Interval    int        `json:"interval,omitempty"` // 单位为秒
+	Conns       int        `json:"conns,omitempty"`
+	OnFailure   bool       `json:"on_failure,omitempty"`
+	Rotations   uint64     `json:"rotations"`
+	Connections int        `json:"connections"` // 上次轮换后新建的连接数
+	LastRotated *time.Time `json:"last_rotated,omitempty"`
+	LastReason  string     `json:"last_reason,omitempty"`
+}
+
+// SessionInfo api 模式下的粘性会话信息
+type SessionInfo struct {
+	ID       string     `json:"id"`
+	Group    string     `json:"group"`
+	Proxy    *ProxyInfo `json:"proxy"`
+	Created  time.Time  `json:"created"`
+	LastUsed time.Time  `json:"last_used"`
+	Expires  *time.Time `json:"expires,omitempty"` // 会话不过期时为空
+}
+
+// DNSInfo DNS缓存统计信息
+type DNSInfo struct {
+	Hits    uint64 `json:"hits"`
+	Misses  uint64 `json:"misses"`
+	Entries int    `json:"entries"`
+}
+
+// DNSRecord DNS缓存中的记录
+type DNSRecord struct {
+	Domain string   `json:"domain"`
+	Type   string   `json:"type"` // A、AAAA 或数字表示的其他类型
+	IPs    []string `json:"ips"`
+	TTL    int      `json:"ttl"`              // 剩余的秒数，已过期时为负数
+	Custom bool     `json:"custom,omitempty"` // 自定义记录，不会过期
+}
+
+// AddDNSRecordRequest 添加自定义DNS记录的请求，格式与 -dnsrecord 参数相同，如 www.example.com/1.2.3.4
+type AddDNSRecordRequest struct {
+	Record string `json:"record"`
+}
+
+// DHCPLease dhcpd 服务的租约
+type DHCPLease struct {
+	Interface string     `json:"interface"`
+	MAC       string     `json:"mac"`
+	IP        string     `json:"ip"`
+	Expires   *time.Time `json:"expires,omitempty"` // 静态地址为空
+	Static    bool       `json:"static"`
+}
+
+// DHCPReservation 添加静态地址的请求，未指定 interface 时使用地址池包含该 IP 的 dhcpd 服务
+type DHCPReservation struct {
+	Interface string `json:"interface,omitempty"`
+	MAC       string `json:"mac"`
+	IP        string `json:"ip"`
+}
+
+// AuditState 审计日志中操作前后的状态
+type AuditState struct {
+	Current   *ProxyInfo `json:"current,omitempty"`   // 组当前选中的代理
+	Forwarder *ProxyInfo `json:"forwarder,omitempty"` // 操作的转发器
+}
+
+// AuditEntry 审计日志中的一条记录，对应一次修改状态的 API 请求
+type AuditEntry struct {
+	Time    time.Time       `json:"time"`
+	User    string          `json:"user"` // USER:PASS 凭据的用户名，TOKEN 凭据为 token: 加上其哈希值的前缀
+	Remote  string          `json:"remote"`
+	Method  string          `json:"method"`
+	Path    string          `json:"path"`
+	Request json.RawMessage `json:"request,omitempty"` // 请求体，URL 中的密码已隐藏
+	Status  int             `json:"status"`
+	Message string          `json:"message"`
+	Group   string          `json:"group,omitempty"`
+	Before  *AuditState     `json:"before,omitempty"` // 操作前的状态，只有组接口记录
+	After   *AuditState     `json:"after,omitempty"`  // 操作后的状态，只有组接口记录
+}
+
+// AuditQuery 审计日志的查询条件，未指定的条件不做过滤
+type AuditQuery struct {
+	User  string
+	Group string
+	Since time.Time
+	Limit int // 返回最近的记录数，默认为 100
+}
+
+// RouteQuery 路由查询条件，Network 默认为 tcp，Src 和 Listener 用于匹配规则文件中的请求条件
+type RouteQuery struct {
+	Addr     string // HOST:PORT
+	Network  string
+	Src      string // 客户端 IP 或 IP:端口
+	Listener string
+}
+
+// 事件类型，enabled、disabled 和 check 与 rule.EventType 相同
+const (
+	EventProxyChanged = "proxy_changed"
+	EventEnabled      = "enabled"
+	EventDisabled     = "disabled"
+	EventCheck        = "check"
+)
+
+// APIEvent 推送给事件流订阅者的事件
+type APIEvent struct {
+	Type     string     `json:"type"`
+	Time     time.Time  `json:"time"`
+	Group    string     `json:"group"`
+	Proxy    *ProxyInfo `json:"proxy,omitempty"`
+	Previous *ProxyInfo `json:"previous,omitempty"`
+	Elapsed  int64      `json:"elapsed,omitempty"` // 健康检查耗时，单位与 latency 相同为纳秒
+	Error    string     `json:"error,omitempty"`
+}
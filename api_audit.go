@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nadoo/glider/api"
+	"github.com/nadoo/glider/pkg/log"
+	"github.com/nadoo/glider/rule"
+)
+
+const (
+	// auditDefaultLimit 查询审计日志时默认返回的记录数
+	auditDefaultLimit = 100
+
+	// auditMaxLimit 查询审计日志时最多返回的记录数
+	auditMaxLimit = 1000
+
+	// auditMaxRequest 记录到审计日志的请求体的最大长度
+	auditMaxRequest = 4096
+)
+
+// auditStore 以 JSON lines 格式追加写入的审计日志文件
+type auditStore struct {
+	path string
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+// 审计日志，未设置 apiauditfile 时为 nil
+var auditLog *auditStore
+
+// openAuditStore 打开审计日志文件，文件不存在时创建
+func openAuditStore(path string) (*auditStore, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("[audit] failed to open audit file %s: %v", path, err)
+	}
+	return &auditStore{path: path, file: f}, nil
+}
+
+// record 写入一条审计记录
+func (s *auditStore) record(e *AuditEntry) {
+	if s == nil {
+		return
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		log.F("[audit] failed to encode entry: %v", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.file.Write(append(data, '\n')); err != nil {
+		log.F("[audit] failed to write audit file %s: %v", s.path, err)
+	}
+}
+
+// query 返回满足条件的最近 q.Limit 条记录，按时间顺序排列
+func (s *auditStore) query(q api.AuditQuery) ([]AuditEntry, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// 只保留最近的 limit 条记录，ring 是环形缓冲区，n 是匹配的记录总数
+	var ring []AuditEntry
+	n := 0
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		var e AuditEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			continue
+		}
+		if q.User != "" && e.User != q.User ||
+			q.Group != "" && e.Group != q.Group ||
+			!q.Since.IsZero() && e.Time.Before(q.Since) {
+			continue
+		}
+		if len(ring) < q.Limit {
+			ring = append(ring, e)
+		} else {
+			ring[n%q.Limit] = e
+		}
+		n++
+	}
+
+	// 缓冲区写满后最早的记录位于下一个写入位置
+	if n > len(ring) {
+		start := n % len(ring)
+		ring = append(ring[start:], ring[:start]...)
+	}
+	return ring, sc.Err()
+}
+
+// apiUserKey 请求上下文中保存请求者身份的键
+type apiUserKey struct{}
+
+// withAPIUser 在请求上下文中保存请求者身份
+func withAPIUser(r *http.Request, user string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), apiUserKey{}, user))
+}
+
+// apiUser 返回请求者身份，未启用认证时为 anonymous
+func apiUser(r *http.Request) string {
+	if user, ok := r.Context().Value(apiUserKey{}).(string); ok {
+		return user
+	}
+	return "anonymous"
+}
+
+// identity 返回凭据对应的身份，不包含密码或完整的 TOKEN
+func identity(cred string) string {
+	if cred == "" {
+		return "anonymous"
+	}
+	if user, _, ok := strings.Cut(cred, ":"); ok {
+		return user
+	}
+	sum := sha256.Sum256([]byte(cred))
+	return "token:" + hex.EncodeToString(sum[:4])
+}
+
+// redactURL 隐藏转发器 URL（可以是用逗号分隔的代理链）中的密码
+func redactURL(s string) string {
+	parts := strings.Split(s, ",")
+	for i, p := range parts {
+		if u, err := url.Parse(p); err == nil && u.User != nil {
+			parts[i] = u.Redacted()
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// auditRequest 读取请求体用于审计日志，并恢复请求体供处理器使用
+func auditRequest(r *http.Request) json.RawMessage {
+	if r.Body == nil {
+		return nil
+	}
+
+	b, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(b))
+	if err != nil || len(b) > auditMaxRequest {
+		return nil
+	}
+
+	var m map[string]any
+	if json.Unmarshal(b, &m) != nil {
+		return nil
+	}
+	if u, ok := m["url"].(string); ok {
+		m["url"] = redactURL(u)
+	}
+	data, _ := json.Marshal(m)
+	return data
+}
+
+// auditPath 返回请求的路径和查询参数，查询参数 url 中的密码被隐藏
+func auditPath(r *http.Request) string {
+	query := r.URL.Query()
+	if u := query.Get("url"); u != "" {
+		query.Set("url", redactURL(u))
+	}
+	if len(query) == 0 {
+		return r.URL.Path
+	}
+	return r.URL.Path + "?" + query.Encode()
+}
+
+// auditGroup 返回请求操作的转发器组，不是组接口时返回nil
+func auditGroup(r *http.Request) *rule.FwdrGroup {
+	if !strings.HasPrefix(r.URL.Path, "/api/groups/") && !strings.HasPrefix(r.URL.Path, "/api/proxy/") {
+		return nil
+	}
+	return apiManager.Group(groupName(r))
+}
+
+// groupAuditState 返回组的状态，sel 不为 nil 时包括它匹配的转发器
+func groupAuditState(g *rule.FwdrGroup, sel *ProxySelector) *AuditState {
+	st := &AuditState{}
+	if f := g.CurrentProxy(); f != nil && g.Strategy() == "api" {
+		st.Current = newProxyInfo(f)
+	}
+	if sel != nil {
+		if f, err := matchProxy(g.GetForwarders(), sel); err == nil {
+			st.Forwarder = newProxyInfo(f)
+		}
+	}
+	return st
+}
+
+// auditRecorder 记录响应的状态码和内容
+type auditRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *auditRecorder) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *auditRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *auditRecorder) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// audited 为处理器加上审计，GET 和 HEAD 以外的请求都记录到审计日志；
+// 只有组接口（/api/groups/ 和 /api/proxy/）记录操作前后的状态，其他接口只记录请求和响应
+func audited(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if auditLog == nil || r.Method == http.MethodGet || r.Method == http.MethodHead {
+			h(w, r)
+			return
+		}
+
+		e := &AuditEntry{
+			Time:    time.Now(),
+			User:    apiUser(r),
+			Remote:  r.RemoteAddr,
+			Method:  r.Method,
+			Path:    auditPath(r),
+			Request: auditRequest(r),
+		}
+
+		// 通过查询参数指定的转发器在操作前的状态
+		var sel *ProxySelector
+		if s, err := selectorFromQuery(r); err == nil && (s.Index != nil || s.Address != "" || s.URL != "" || s.Tag != "") {
+			sel = s
+		}
+
+		g := auditGroup(r)
+		if g != nil {
+			e.Group = g.Name()
+			e.Before = groupAuditState(g, sel)
+		}
+
+		rec := &auditRecorder{ResponseWriter: w, status: http.StatusOK}
+		h(rec, r)
+
+		var resp APIResponse
+		json.Unmarshal(rec.body.Bytes(), &resp)
+		e.Status, e.Message = rec.status, resp.Message
+
+		if g != nil {
+			e.After = groupAuditState(g, nil)
+			if r.Method != http.MethodDelete {
+				e.After.Forwarder = resp.Proxy
+			}
+		}
+
+		auditLog.record(e)
+	}
+}
+
+// auditDenied 记录被拒绝的修改请求
+func auditDenied(r *http.Request, user string, status int, message string) {
+	if auditLog == nil || r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return
+	}
+
+	auditLog.record(&AuditEntry{
+		Time:    time.Now(),
+		User:    user,
+		Remote:  r.RemoteAddr,
+		Method:  r.Method,
+		Path:    auditPath(r),
+		Status:  status,
+		Message: message,
+	})
+}
+
+// handleAudit 处理审计日志查询请求，可通过查询参数 user、group、since（RFC 3339 格式）和 limit 过滤
+func handleAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIResponse(w, http.StatusMethodNotAllowed, APIResponse{
+			Success: false,
+			Message: "Method not allowed, use GET",
+		})
+		return
+	}
+
+	if auditLog == nil {
+		writeAPIResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Audit log not enabled",
+		})
+		return
+	}
+
+	query := r.URL.Query()
+	q := api.AuditQuery{User: query.Get("user"), Group: query.Get("group"), Limit: auditDefaultLimit}
+
+	var err error
+	if s := query.Get("since"); s != "" {
+		if q.Since, err = time.Parse(time.RFC3339, s); err != nil {
+			err = errors.New("invalid since: " + s)
+		}
+	}
+	if s := query.Get("limit"); s != "" && err == nil {
+		if q.Limit, err = strconv.Atoi(s); err != nil || q.Limit <= 0 || q.Limit > auditMaxLimit {
+			err = fmt.Errorf("invalid limit: %s, must be 1-%d", s, auditMaxLimit)
+		}
+	}
+	if err != nil {
+		writeAPIResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	entries, err := auditLog.query(q)
+	if err != nil {
+		writeAPIResponse(w, http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to read audit log: " + err.Error(),
+		})
+		return
+	}
+
+	writeAPIResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("%d entries", len(entries)),
+		Audit:   entries,
+	})
+}
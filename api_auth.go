@@ -0,0 +1,121 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"strings"
+
+	"github.com/nadoo/glider/pkg/log"
+)
+
+// APIConfig API服务器配置
+type APIConfig struct {
+	Listen       string
+	Auth         []string // 管理员凭据，TOKEN 或 USER:PASS
+	ReadOnlyAuth []string // 只读凭据，只允许 GET 请求
+	CertFile     string
+	KeyFile      string
+	StateFile    string // 保存运行时状态的文件，重启后恢复
+	AuditFile    string // 记录修改状态的请求的审计日志文件
+}
+
+// apiRole 请求者的权限
+type apiRole int
+
+const (
+	roleNone apiRole = iota
+	roleReadOnly
+	roleAdmin
+)
+
+// apiAuth API认证，支持 Bearer Token 和 Basic 认证
+type apiAuth struct {
+	admin    []string
+	readOnly []string
+}
+
+func newAPIAuth(admin, readOnly []string) *apiAuth {
+	return &apiAuth{admin: admin, readOnly: readOnly}
+}
+
+// disabled 未配置任何凭据时不做认证
+func (a *apiAuth) disabled() bool {
+	return len(a.admin) == 0 && len(a.readOnly) == 0
+}
+
+// role 根据请求的 Authorization 头返回请求者的权限和身份
+func (a *apiAuth) role(r *http.Request) (apiRole, string) {
+	cred, ok := credential(r.Header.Get("Authorization"))
+	if !ok {
+		return roleNone, identity("")
+	}
+
+	// 遍历全部凭据，避免通过响应时间推测凭据
+	role := roleNone
+	for _, c := range a.readOnly {
+		if subtle.ConstantTimeCompare([]byte(c), []byte(cred)) == 1 {
+			role = roleReadOnly
+		}
+	}
+	for _, c := range a.admin {
+		if subtle.ConstantTimeCompare([]byte(c), []byte(cred)) == 1 {
+			role = roleAdmin
+		}
+	}
+	return role, identity(cred)
+}
+
+// credential 从 Authorization 头中取出凭据：Bearer 为 TOKEN，Basic 为 USER:PASS
+func credential(auth string) (string, bool) {
+	scheme, value, ok := strings.Cut(auth, " ")
+	if !ok {
+		return "", false
+	}
+
+	switch strings.ToLower(scheme) {
+	case "bearer":
+		return strings.TrimSpace(value), true
+	case "basic":
+		b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+		if err != nil {
+			return "", false
+		}
+		return string(b), true
+	}
+
+	return "", false
+}
+
+// wrap 为所有接口加上认证，GET 和 HEAD 请求需要只读或管理员权限，其他请求需要管理员权限
+func (a *apiAuth) wrap(next http.Handler) http.Handler {
+	if a.disabled() {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		role, user := a.role(r)
+		if role == roleNone {
+			log.F("[api] unauthorized request from %s: %s %s", r.RemoteAddr, r.Method, r.URL.Path)
+			auditDenied(r, user, http.StatusUnauthorized, "Unauthorized")
+			w.Header().Set("WWW-Authenticate", `Basic realm="glider"`)
+			writeAPIResponse(w, http.StatusUnauthorized, APIResponse{
+				Success: false,
+				Message: "Unauthorized",
+			})
+			return
+		}
+
+		if role == roleReadOnly && r.Method != http.MethodGet && r.Method != http.MethodHead {
+			log.F("[api] forbidden request from %s with read-only credential: %s %s", r.RemoteAddr, r.Method, r.URL.Path)
+			auditDenied(r, user, http.StatusForbidden, "Forbidden")
+			writeAPIResponse(w, http.StatusForbidden, APIResponse{
+				Success: false,
+				Message: "Forbidden, read-only credential can only use GET requests",
+			})
+			return
+		}
+
+		next.ServeHTTP(w, withAPIUser(r, user))
+	})
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/nadoo/glider/pkg/log"
+	"github.com/nadoo/glider/rule"
+)
+
+// newCheckInfo 根据健康检查结果生成检查信息，转发器状态为检查后的状态
+func newCheckInfo(g *rule.FwdrGroup, r rule.CheckResult) CheckInfo {
+	info := CheckInfo{Group: g.Name(), Proxy: newProxyInfo(r.Forwarder), Elapsed: int64(r.Elapsed)}
+	if r.Err != nil {
+		info.Error = r.Err.Error()
+	}
+	return info
+}
+
+// checkGroups 立即检查所有组中的转发器，并按检查结果启用或禁用转发器
+func checkGroups(groups []*rule.FwdrGroup) []CheckInfo {
+	results := make([][]rule.CheckResult, len(groups))
+
+	var wg sync.WaitGroup
+	for i, g := range groups {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = g.CheckForwarders()
+		}()
+	}
+	wg.Wait()
+
+	var infos []CheckInfo
+	for i, g := range groups {
+		for _, r := range results[i] {
+			infos = append(infos, newCheckInfo(g, r))
+		}
+	}
+	return infos
+}
+
+// checkAll 检查当前规则代理的所有转发器，收到 SIGUSR1 信号时调用
+func checkAll() {
+	log.Printf("[check] checking all forwarders")
+	for _, c := range checkGroups(rulePxy.Load().Groups()) {
+		if c.Error != "" {
+			log.Printf("[check] %s: %s, FAILED. error: %s", c.Group, c.Proxy.Address, c.Error)
+			continue
+		}
+		log.Printf("[check] %s: %s, SUCCESS. Elapsed: %dms", c.Group, c.Proxy.Address, c.Elapsed/1e6)
+	}
+}
+
+// checkSummary 返回检查结果的摘要
+func checkSummary(checks []CheckInfo) string {
+	failed := 0
+	for _, c := range checks {
+		if c.Error != "" {
+			failed++
+		}
+	}
+	return fmt.Sprintf("%d proxies checked, %d failed", len(checks), failed)
+}
+
+// handleCheckAll 处理检查所有组的请求
+func handleCheckAll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeAPIResponse(w, http.StatusMethodNotAllowed, APIResponse{
+			Success: false,
+			Message: "Method not allowed, use POST",
+		})
+		return
+	}
+
+	checks := checkGroups(apiManager.Groups())
+	writeAPIResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: checkSummary(checks),
+		Checks:  checks,
+	})
+}
+
+// handleCheckGroup 处理检查指定组的请求，可通过查询参数 address、url、index 或 tag 只检查一个转发器
+func handleCheckGroup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeAPIResponse(w, http.StatusMethodNotAllowed, APIResponse{
+			Success: false,
+			Message: "Method not allowed, use POST",
+		})
+		return
+	}
+
+	g := lookupGroup(w, r)
+	if g == nil {
+		return
+	}
+
+	sel, err := selectorFromQuery(r)
+	if err != nil {
+		writeAPIResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+			Group:   g.Name(),
+		})
+		return
+	}
+
+	var checks []CheckInfo
+	if sel.Index == nil && sel.Address == "" && sel.URL == "" && sel.Tag == "" {
+		checks = checkGroups([]*rule.FwdrGroup{g})
+	} else {
+		f, err := matchProxy(g.GetForwarders(), sel)
+		if err != nil {
+			writeAPIResponse(w, forwarderErrorStatus(err), APIResponse{
+				Success: false,
+				Message: "Failed to check proxy: " + err.Error(),
+				Group:   g.Name(),
+			})
+			return
+		}
+
+		elapsed, err := g.CheckForwarder(f)
+		checks = []CheckInfo{newCheckInfo(g, rule.CheckResult{Forwarder: f, Elapsed: elapsed, Err: err})}
+	}
+
+	writeAPIResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: checkSummary(checks),
+		Group:   g.Name(),
+		Checks:  checks,
+	})
+}
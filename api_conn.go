@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/nadoo/glider/pkg/log"
+	"github.com/nadoo/glider/proxy"
+)
+
+// newConnectionInfo 根据连接表中的连接生成连接信息
+func newConnectionInfo(c *proxy.Connection) ConnectionInfo {
+	return ConnectionInfo{
+		ID:        c.ID,
+		Network:   c.Network,
+		Client:    c.Client,
+		Target:    c.Target,
+		Forwarder: c.Dialer,
+		Start:     c.Start,
+		Upload:    c.Upload(),
+		Download:  c.Download(),
+	}
+}
+
+// connectionsVia 返回通过指定转发器的连接，forwarder 为空时返回所有连接
+func connectionsVia(forwarder string) []*proxy.Connection {
+	conns := proxy.Connections()
+	if forwarder == "" {
+		return conns
+	}
+
+	var via []*proxy.Connection
+	for _, c := range conns {
+		if c.Dialer == forwarder {
+			via = append(via, c)
+		}
+	}
+	return via
+}
+
+// handleConnections 处理连接表请求，GET 列出连接，DELETE 关闭通过 forwarder 参数指定转发器的所有连接
+func handleConnections(w http.ResponseWriter, r *http.Request) {
+	forwarder := r.URL.Query().Get("forwarder")
+
+	switch r.Method {
+	case http.MethodGet:
+		conns := connectionsVia(forwarder)
+		infos := make([]ConnectionInfo, 0, len(conns))
+		for _, c := range conns {
+			infos = append(infos, newConnectionInfo(c))
+		}
+		writeAPIResponse(w, http.StatusOK, APIResponse{
+			Success:     true,
+			Message:     fmt.Sprintf("%d connections", len(infos)),
+			Connections: infos,
+		})
+
+	case http.MethodDelete:
+		if forwarder == "" {
+			writeAPIResponse(w, http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "forwarder must be specified",
+			})
+			return
+		}
+
+		conns := connectionsVia(forwarder)
+		for _, c := range conns {
+			c.Close()
+		}
+		log.F("[api] closed %d connections via %s", len(conns), forwarder)
+
+		writeAPIResponse(w, http.StatusOK, APIResponse{
+			Success: true,
+			Message: fmt.Sprintf("%d connections closed", len(conns)),
+		})
+
+	default:
+		writeAPIResponse(w, http.StatusMethodNotAllowed, APIResponse{
+			Success: false,
+			Message: "Method not allowed, use GET or DELETE",
+		})
+	}
+}
+
+// handleCloseConnection 处理关闭单个连接请求
+func handleCloseConnection(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeAPIResponse(w, http.StatusMethodNotAllowed, APIResponse{
+			Success: false,
+			Message: "Method not allowed, use DELETE",
+		})
+		return
+	}
+
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeAPIResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid connection id",
+		})
+		return
+	}
+
+	c, ok := proxy.GetConnection(id)
+	if !ok {
+		writeAPIResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Connection not found",
+		})
+		return
+	}
+
+	c.Close()
+	log.F("[api] closed connection %d: %s <-> %s via %s", c.ID, c.Client, c.Target, c.Dialer)
+
+	writeAPIResponse(w, http.StatusOK, APIResponse{
+		Success:     true,
+		Message:     "Connection closed",
+		Connections: []ConnectionInfo{newConnectionInfo(c)},
+	})
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// 管理页面的静态文件
+//
+//go:embed dashboard
+var dashboardFiles embed.FS
+
+// dashboardHandler 返回管理页面的处理器，静态文件不需要认证，页面中的API请求携带用户输入的凭据
+func dashboardHandler() http.Handler {
+	files, _ := fs.Sub(dashboardFiles, "dashboard")
+	return http.StripPrefix("/dashboard/", http.FileServerFS(files))
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+
+	"github.com/nadoo/glider/service/dhcpd"
+)
+
+// newDHCPLease 根据 dhcpd 服务的租约生成租约信息
+func newDHCPLease(iface string, l dhcpd.Lease) DHCPLease {
+	lease := DHCPLease{
+		Interface: iface,
+		MAC:       l.MAC.String(),
+		IP:        l.IP.String(),
+		Static:    l.Static(),
+	}
+	if !l.Static() {
+		lease.Expires = &l.Expires
+	}
+	return lease
+}
+
+// dhcpServices 返回请求对应的 dhcpd 服务，可通过查询参数 interface 指定，
+// 找不到时写入404响应并返回nil
+func dhcpServices(w http.ResponseWriter, r *http.Request) []dhcpd.Manager {
+	services := apiManager.DHCP()
+	if len(services) == 0 {
+		writeAPIResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "DHCP server not enabled",
+		})
+		return nil
+	}
+
+	iface := r.URL.Query().Get("interface")
+	if iface == "" {
+		return services
+	}
+
+	for _, s := range services {
+		if s.Interface() == iface {
+			return []dhcpd.Manager{s}
+		}
+	}
+
+	writeAPIResponse(w, http.StatusNotFound, APIResponse{
+		Success: false,
+		Message: "DHCP server not found on interface: " + iface,
+	})
+	return nil
+}
+
+// pathMAC 解析路径参数中的 MAC 地址，格式错误时写入400响应
+func pathMAC(w http.ResponseWriter, r *http.Request) (net.HardwareAddr, bool) {
+	mac, err := net.ParseMAC(r.PathValue("mac"))
+	if err != nil {
+		writeAPIResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid mac: " + r.PathValue("mac"),
+		})
+		return nil, false
+	}
+	return mac, true
+}
+
+// handleDHCPLeases 处理租约列表请求，可通过查询参数 interface 只列出指定接口的租约
+func handleDHCPLeases(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIResponse(w, http.StatusMethodNotAllowed, APIResponse{
+			Success: false,
+			Message: "Method not allowed, use GET",
+		})
+		return
+	}
+
+	services := dhcpServices(w, r)
+	if services == nil {
+		return
+	}
+
+	leases := []DHCPLease{}
+	for _, s := range services {
+		for _, l := range s.Leases() {
+			leases = append(leases, newDHCPLease(s.Interface(), l))
+		}
+	}
+
+	writeAPIResponse(w, http.StatusOK, APIResponse{
+		Success:    true,
+		Message:    fmt.Sprintf("%d leases", len(leases)),
+		DHCPLeases: leases,
+	})
+}
+
+// handleReleaseDHCPLease 处理释放租约请求，静态地址不会被释放
+func handleReleaseDHCPLease(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeAPIResponse(w, http.StatusMethodNotAllowed, APIResponse{
+			Success: false,
+			Message: "Method not allowed, use DELETE",
+		})
+		return
+	}
+
+	services := dhcpServices(w, r)
+	if services == nil {
+		return
+	}
+
+	mac, ok := pathMAC(w, r)
+	if !ok {
+		return
+	}
+
+	released := false
+	for _, s := range services {
+		if s.Release(mac) {
+			released = true
+		}
+	}
+
+	if !released {
+		writeAPIResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Dynamic lease not found: " + mac.String(),
+		})
+		return
+	}
+
+	writeAPIResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Lease released successfully",
+	})
+}
+
+// handleAddDHCPStatic 处理添加静态地址请求
+func handleAddDHCPStatic(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeAPIResponse(w, http.StatusMethodNotAllowed, APIResponse{
+			Success: false,
+			Message: "Method not allowed, use POST",
+		})
+		return
+	}
+
+	services := dhcpServices(w, r)
+	if services == nil {
+		return
+	}
+
+	var req DHCPReservation
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeAPIResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	mac, err := net.ParseMAC(req.MAC)
+	if err != nil {
+		writeAPIResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid mac: " + req.MAC,
+		})
+		return
+	}
+
+	ip, err := netip.ParseAddr(req.IP)
+	if err != nil {
+		writeAPIResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid ip: " + req.IP,
+		})
+		return
+	}
+
+	// 未指定接口时使用地址池包含该 IP 的服务
+	var target dhcpd.Manager
+	for _, s := range services {
+		if req.Interface != "" && s.Interface() == req.Interface ||
+			req.Interface == "" && s.Contains(ip) {
+			target = s
+			break
+		}
+	}
+
+	if target == nil {
+		err = dhcpd.ErrNotInPool
+		if req.Interface != "" {
+			err = errors.New("DHCP server not found on interface: " + req.Interface)
+		}
+	} else {
+		err = target.Reserve(mac, ip)
+	}
+
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, dhcpd.ErrReserved) {
+			status = http.StatusConflict
+		}
+		writeAPIResponse(w, status, APIResponse{
+			Success: false,
+			Message: "Failed to add static ip: " + err.Error(),
+		})
+		return
+	}
+
+	writeAPIResponse(w, http.StatusCreated, APIResponse{
+		Success:    true,
+		Message:    "Static ip added successfully",
+		DHCPLeases: []DHCPLease{newDHCPLease(target.Interface(), dhcpd.Lease{IP: ip, MAC: mac})},
+	})
+}
+
+// handleRemoveDHCPStatic 处理删除静态地址请求
+func handleRemoveDHCPStatic(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeAPIResponse(w, http.StatusMethodNotAllowed, APIResponse{
+			Success: false,
+			Message: "Method not allowed, use DELETE",
+		})
+		return
+	}
+
+	services := dhcpServices(w, r)
+	if services == nil {
+		return
+	}
+
+	mac, ok := pathMAC(w, r)
+	if !ok {
+		return
+	}
+
+	removed := false
+	for _, s := range services {
+		if s.Unreserve(mac) {
+			removed = true
+		}
+	}
+
+	if !removed {
+		writeAPIResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Static ip not found: " + mac.String(),
+		})
+		return
+	}
+
+	writeAPIResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Static ip removed successfully",
+	})
+}
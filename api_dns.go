@@ -0,0 +1,264 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/nadoo/glider/dns"
+	"github.com/nadoo/glider/pkg/log"
+)
+
+// newDNSInfo 根据缓存统计生成DNS信息
+func newDNSInfo(stats dns.CacheStats) *DNSInfo {
+	return &DNSInfo{Hits: stats.Hits, Misses: stats.Misses, Entries: stats.Entries}
+}
+
+// newDNSRecord 根据缓存记录生成DNS记录信息
+func newDNSRecord(r dns.CacheRecord) DNSRecord {
+	return DNSRecord{
+		Domain: r.Domain,
+		Type:   qtypeName(r.Type),
+		IPs:    r.IPs,
+		TTL:    r.TTL,
+		Custom: r.Custom,
+	}
+}
+
+// qtypeName 返回查询类型的名称
+func qtypeName(qtype uint16) string {
+	switch qtype {
+	case dns.QTypeA:
+		return "A"
+	case dns.QTypeAAAA:
+		return "AAAA"
+	}
+	return strconv.FormatUint(uint64(qtype), 10)
+}
+
+// parseQType 解析查询类型，可以是 A、AAAA 或数字，为空时是 A
+func parseQType(s string) (uint16, error) {
+	switch strings.ToUpper(s) {
+	case "", "A":
+		return dns.QTypeA, nil
+	case "AAAA":
+		return dns.QTypeAAAA, nil
+	}
+
+	qtype, err := strconv.ParseUint(s, 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid type: %s", s)
+	}
+	return uint16(qtype), nil
+}
+
+// lookupDNS 获取DNS服务器，未启用时写入404响应并返回nil
+func lookupDNS(w http.ResponseWriter) *dns.Server {
+	d := apiManager.DNS()
+	if d == nil {
+		writeAPIResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "DNS server not enabled",
+		})
+	}
+	return d
+}
+
+// handleDNS 处理DNS缓存统计请求
+func handleDNS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIResponse(w, http.StatusMethodNotAllowed, APIResponse{
+			Success: false,
+			Message: "Method not allowed, use GET",
+		})
+		return
+	}
+
+	d := lookupDNS(w)
+	if d == nil {
+		return
+	}
+
+	writeAPIResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: "DNS cache stats retrieved successfully",
+		DNS:     newDNSInfo(d.CacheStats()),
+	})
+}
+
+// handleDNSCache 处理DNS缓存请求，GET 列出所有记录，DELETE 清空缓存（不包括自定义记录）
+func handleDNSCache(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodDelete {
+		writeAPIResponse(w, http.StatusMethodNotAllowed, APIResponse{
+			Success: false,
+			Message: "Method not allowed, use GET or DELETE",
+		})
+		return
+	}
+
+	d := lookupDNS(w)
+	if d == nil {
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		n := d.FlushCache()
+		log.F("[api] flushed %d dns cache records", n)
+		writeAPIResponse(w, http.StatusOK, APIResponse{
+			Success: true,
+			Message: fmt.Sprintf("%d records flushed", n),
+			DNS:     newDNSInfo(d.CacheStats()),
+		})
+		return
+	}
+
+	records := d.CacheRecords()
+	infos := make([]DNSRecord, len(records))
+	for i, rec := range records {
+		infos[i] = newDNSRecord(rec)
+	}
+
+	writeAPIResponse(w, http.StatusOK, APIResponse{
+		Success:    true,
+		Message:    fmt.Sprintf("%d records", len(infos)),
+		DNS:        newDNSInfo(d.CacheStats()),
+		DNSRecords: infos,
+	})
+}
+
+// handleDNSCacheEntry 处理单个域名的缓存请求，GET 通过查询参数 type 查看一条记录，
+// DELETE 删除域名的所有缓存记录，查询参数 suffix=true 时同时删除子域名的记录
+func handleDNSCacheEntry(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodDelete {
+		writeAPIResponse(w, http.StatusMethodNotAllowed, APIResponse{
+			Success: false,
+			Message: "Method not allowed, use GET or DELETE",
+		})
+		return
+	}
+
+	d := lookupDNS(w)
+	if d == nil {
+		return
+	}
+
+	name := r.PathValue("name")
+	query := r.URL.Query()
+
+	if r.Method == http.MethodDelete {
+		suffix, _ := strconv.ParseBool(query.Get("suffix"))
+		n := d.DeleteCache(name, suffix)
+		log.F("[api] deleted %d dns cache records of %s, suffix: %v", n, name, suffix)
+		writeAPIResponse(w, http.StatusOK, APIResponse{
+			Success: true,
+			Message: fmt.Sprintf("%d records deleted", n),
+		})
+		return
+	}
+
+	qtype, err := parseQType(query.Get("type"))
+	if err != nil {
+		writeAPIResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	rec, ok := d.LookupCache(name, qtype)
+	if !ok {
+		writeAPIResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Record not found in cache: %s/%s", name, qtypeName(qtype)),
+		})
+		return
+	}
+
+	writeAPIResponse(w, http.StatusOK, APIResponse{
+		Success:    true,
+		Message:    "Record retrieved successfully",
+		DNSRecords: []DNSRecord{newDNSRecord(rec)},
+	})
+}
+
+// handleAddDNSRecord 处理添加自定义DNS记录请求
+func handleAddDNSRecord(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeAPIResponse(w, http.StatusMethodNotAllowed, APIResponse{
+			Success: false,
+			Message: "Method not allowed, use POST",
+		})
+		return
+	}
+
+	d := lookupDNS(w)
+	if d == nil {
+		return
+	}
+
+	var req AddDNSRecordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Record == "" {
+		writeAPIResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid request body, record must be specified",
+		})
+		return
+	}
+
+	if err := d.AddRecord(req.Record); err != nil {
+		writeAPIResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Failed to add record: " + err.Error(),
+		})
+		return
+	}
+	log.F("[api] added dns record %s", req.Record)
+
+	domain, ip, _ := strings.Cut(req.Record, "/")
+	qtype := dns.QTypeA
+	if strings.Contains(ip, ":") {
+		qtype = dns.QTypeAAAA
+	}
+
+	response := APIResponse{
+		Success: true,
+		Message: "Record added successfully",
+	}
+	if rec, ok := d.LookupCache(domain, qtype); ok {
+		response.DNSRecords = []DNSRecord{newDNSRecord(rec)}
+	}
+	writeAPIResponse(w, http.StatusCreated, response)
+}
+
+// handleRemoveDNSRecord 处理删除自定义DNS记录请求，同时删除域名的 A 和 AAAA 记录
+func handleRemoveDNSRecord(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeAPIResponse(w, http.StatusMethodNotAllowed, APIResponse{
+			Success: false,
+			Message: "Method not allowed, use DELETE",
+		})
+		return
+	}
+
+	d := lookupDNS(w)
+	if d == nil {
+		return
+	}
+
+	name := r.PathValue("name")
+	if d.RemoveRecord(name) == 0 {
+		writeAPIResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Record not found: " + name,
+		})
+		return
+	}
+	log.F("[api] removed dns records of %s", name)
+
+	writeAPIResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Record removed successfully",
+	})
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/nadoo/glider/api"
+	"github.com/nadoo/glider/pkg/log"
+	"github.com/nadoo/glider/rule"
+)
+
+// eventBufSize 每个订阅者的事件缓冲区大小，缓冲区满时丢弃新事件
+const eventBufSize = 64
+
+// eventHub 将事件分发给所有订阅者
+type eventHub struct {
+	mu     sync.Mutex
+	closed bool
+	subs   map[chan APIEvent]struct{}
+}
+
+// 全局事件分发器
+var apiEvents = &eventHub{subs: make(map[chan APIEvent]struct{})}
+
+// subscribe 订阅事件，返回的 channel 需要通过 unsubscribe 取消订阅
+func (h *eventHub) subscribe() chan APIEvent {
+	ch := make(chan APIEvent, eventBufSize)
+	h.mu.Lock()
+	if h.closed {
+		close(ch)
+	} else {
+		h.subs[ch] = struct{}{}
+	}
+	h.mu.Unlock()
+	return ch
+}
+
+// unsubscribe 取消订阅
+func (h *eventHub) unsubscribe(ch chan APIEvent) {
+	h.mu.Lock()
+	delete(h.subs, ch)
+	h.mu.Unlock()
+}
+
+// close 关闭所有订阅者的 channel，使事件流连接结束，之后不再接受订阅
+func (h *eventHub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for ch := range h.subs {
+		close(ch)
+		delete(h.subs, ch)
+	}
+}
+
+// publish 发布事件，不会因为订阅者处理慢而阻塞
+func (h *eventHub) publish(ev APIEvent) {
+	ev.Time = time.Now()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs {
+		select {
+		case ch <- ev:
+		default:
+			log.F("[api] event stream subscriber too slow, dropped %s event of %s", ev.Type, ev.Group)
+		}
+	}
+}
+
+// onGroupEvent 将转发器组的状态变化和健康检查结果发布到事件流
+func onGroupEvent(e rule.Event) {
+	// 每个新建连接都会产生 dial 事件，不推送到事件流
+	if e.Type == rule.EventDial {
+		return
+	}
+
+	ev := APIEvent{
+		Type:  string(e.Type),
+		Group: e.Group,
+		Proxy: newProxyInfo(e.Forwarder),
+	}
+	if e.Type == rule.EventCheck {
+		ev.Elapsed = int64(e.Elapsed)
+		if e.Err != nil {
+			ev.Error = e.Err.Error()
+		}
+	}
+	apiEvents.publish(ev)
+}
+
+// setCurrentProxy 切换组的当前代理并发布 proxy_changed 事件
+func (am *APIManager) setCurrentProxy(g *rule.FwdrGroup, f *rule.Forwarder) {
+	old := g.CurrentProxy()
+	g.SetCurrentProxy(f)
+	if old == f {
+		return
+	}
+	stateFile.changed()
+
+	ev := APIEvent{Type: api.EventProxyChanged, Group: g.Name(), Proxy: newProxyInfo(f)}
+	if old != nil {
+		ev.Previous = newProxyInfo(old)
+	}
+	apiEvents.publish(ev)
+}
+
+// handleEvents 以 Server-Sent Events 格式推送事件，可通过查询参数 group 只接收指定组的事件
+func handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIResponse(w, http.StatusMethodNotAllowed, APIResponse{
+			Success: false,
+			Message: "Method not allowed, use GET",
+		})
+		return
+	}
+
+	group := r.URL.Query().Get("group")
+	rc := http.NewResponseController(w)
+
+	ch := apiEvents.subscribe()
+	defer apiEvents.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		log.F("[api] event stream not supported: %v", err)
+		return
+	}
+
+	log.F("[api] event stream subscribed by %s", r.RemoteAddr)
+	defer log.F("[api] event stream of %s closed", r.RemoteAddr)
+
+	// 定期发送注释行，避免空闲连接被中间代理断开
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			if _, err := w.Write([]byte(": keepalive\n\n")); err != nil {
+				return
+			}
+		case ev, ok := <-ch:
+			if !ok {
+				return
+			}
+			if group != "" && ev.Group != group {
+				continue
+			}
+			data, _ := json.Marshal(ev)
+			if _, err := w.Write([]byte("event: " + ev.Type + "\ndata: " + string(data) + "\n\n")); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/nadoo/glider/pkg/log"
+	"github.com/nadoo/glider/rule"
+)
+
+var errProxyExists = errors.New("proxy already exists")
+
+// AddForwarder 根据 URL 创建转发器并加入指定组
+func (am *APIManager) AddForwarder(group, url string) (*rule.Forwarder, error) {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+
+	g := am.group(group)
+	if g == nil {
+		return nil, errProxyNotFound
+	}
+
+	if findProxy(g.GetForwarders(), func(f *rule.Forwarder) bool { return f.URL() == url }) != nil {
+		return nil, errProxyExists
+	}
+
+	f, err := am.pxy.AddForwarder(g, url)
+	if err != nil {
+		return nil, err
+	}
+
+	stateFile.addForwarder(group, url)
+	log.F("[api] %s: added proxy %s", group, f.Addr())
+	return f, nil
+}
+
+// RemoveForwarder 从指定组移除选择器匹配的转发器，已建立的连接不受影响
+func (am *APIManager) RemoveForwarder(group string, sel *ProxySelector) (*rule.Forwarder, error) {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+
+	g := am.group(group)
+	if g == nil {
+		return nil, errProxyNotFound
+	}
+
+	f, err := matchProxy(g.GetForwarders(), sel)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := g.RemoveForwarder(f); err != nil {
+		return f, err
+	}
+
+	stateFile.removeForwarder(group, f.URL())
+	log.F("[api] %s: removed proxy %s", group, f.Addr())
+	return f, nil
+}
+
+// UpdateForwarder 修改指定组中选择器匹配的转发器的属性
+func (am *APIManager) UpdateForwarder(group string, sel *ProxySelector, update *ForwarderUpdate) (*rule.Forwarder, error) {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+
+	g := am.group(group)
+	if g == nil {
+		return nil, errProxyNotFound
+	}
+
+	f, err := matchProxy(g.GetForwarders(), sel)
+	if err != nil {
+		return nil, err
+	}
+
+	if update.Tag != nil {
+		f.SetTag(*update.Tag)
+	}
+
+	if update.MaxFailures != nil {
+		f.SetMaxFailures(*update.MaxFailures)
+	}
+
+	if update.Priority != nil {
+		g.SetForwarderPriority(f, *update.Priority)
+	}
+
+	if update.Enabled != nil {
+		if *update.Enabled {
+			f.Resume()
+		} else {
+			f.Suspend()
+		}
+		stateFile.changed()
+	}
+
+	log.F("[api] %s: updated proxy %s", group, f.Addr())
+	return f, nil
+}
+
+// selectorFromQuery 从查询参数中解析代理选择条件
+func selectorFromQuery(r *http.Request) (*ProxySelector, error) {
+	query := r.URL.Query()
+	sel := &ProxySelector{
+		Address: query.Get("address"),
+		URL:     query.Get("url"),
+		Tag:     query.Get("tag"),
+	}
+
+	if s := query.Get("index"); s != "" {
+		idx, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, errors.New("invalid index: " + s)
+		}
+		sel.Index = &idx
+	}
+
+	return sel, nil
+}
+
+// forwarderErrorStatus 返回错误对应的HTTP状态码
+func forwarderErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errProxyNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errProxyExists):
+		return http.StatusConflict
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// handleForwarders 处理转发器的查询、添加、删除和修改请求
+func handleForwarders(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		handleGetProxyList(w, r)
+	case http.MethodPost:
+		handleAddForwarder(w, r)
+	case http.MethodDelete:
+		handleRemoveForwarder(w, r)
+	case http.MethodPatch:
+		handleUpdateForwarder(w, r)
+	default:
+		writeAPIResponse(w, http.StatusMethodNotAllowed, APIResponse{
+			Success: false,
+			Message: "Method not allowed, use GET, POST, DELETE or PATCH",
+		})
+	}
+}
+
+// handleAddForwarder 处理添加转发器请求
+func handleAddForwarder(w http.ResponseWriter, r *http.Request) {
+	g := lookupGroup(w, r)
+	if g == nil {
+		return
+	}
+
+	var req AddForwarderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.URL == "" {
+		writeAPIResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid request body, url must be specified",
+			Group:   g.Name(),
+		})
+		return
+	}
+
+	f, err := apiManager.AddForwarder(g.Name(), req.URL)
+	if err != nil {
+		writeAPIResponse(w, forwarderErrorStatus(err), APIResponse{
+			Success: false,
+			Message: "Failed to add proxy: " + err.Error(),
+			Group:   g.Name(),
+		})
+		return
+	}
+
+	writeAPIResponse(w, http.StatusCreated, APIResponse{
+		Success: true,
+		Message: "Proxy added successfully",
+		Group:   g.Name(),
+		Proxy:   newProxyInfo(f),
+	})
+}
+
+// handleRemoveForwarder 处理删除转发器请求，通过查询参数 address、url、index 或 tag 指定转发器
+func handleRemoveForwarder(w http.ResponseWriter, r *http.Request) {
+	g := lookupGroup(w, r)
+	if g == nil {
+		return
+	}
+
+	sel, err := selectorFromQuery(r)
+	if err == nil {
+		var f *rule.Forwarder
+		if f, err = apiManager.RemoveForwarder(g.Name(), sel); err == nil {
+			writeAPIResponse(w, http.StatusOK, APIResponse{
+				Success: true,
+				Message: "Proxy removed successfully",
+				Group:   g.Name(),
+				Proxy:   newProxyInfo(f),
+			})
+			return
+		}
+	}
+
+	writeAPIResponse(w, forwarderErrorStatus(err), APIResponse{
+		Success: false,
+		Message: "Failed to remove proxy: " + err.Error(),
+		Group:   g.Name(),
+	})
+}
+
+// handleUpdateForwarder 处理修改转发器请求，通过查询参数 address、url、index 或 tag 指定转发器
+func handleUpdateForwarder(w http.ResponseWriter, r *http.Request) {
+	g := lookupGroup(w, r)
+	if g == nil {
+		return
+	}
+
+	var update ForwarderUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		writeAPIResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid request body: " + err.Error(),
+			Group:   g.Name(),
+		})
+		return
+	}
+
+	sel, err := selectorFromQuery(r)
+	if err == nil {
+		var f *rule.Forwarder
+		if f, err = apiManager.UpdateForwarder(g.Name(), sel, &update); err == nil {
+			writeAPIResponse(w, http.StatusOK, APIResponse{
+				Success: true,
+				Message: "Proxy updated successfully",
+				Group:   g.Name(),
+				Proxy:   newProxyInfo(f),
+			})
+			return
+		}
+	}
+
+	writeAPIResponse(w, forwarderErrorStatus(err), APIResponse{
+		Success: false,
+		Message: "Failed to update proxy: " + err.Error(),
+		Group:   g.Name(),
+	})
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/nadoo/glider/pkg/log"
+	"github.com/nadoo/glider/rule"
+)
+
+// 自动轮换的原因
+const (
+	rotateByInterval = "interval"
+	rotateByConns    = "connections"
+	rotateByFailure  = "failure"
+)
+
+var errNoProxyToRotate = errors.New("no other enabled proxy")
+
+// rotator 按照组的轮换策略自动切换 api 模式下的当前代理
+type rotator struct {
+	am        *APIManager
+	group     string
+	interval  time.Duration
+	conns     int
+	onFailure bool
+	done      chan struct{}
+
+	mu        sync.Mutex
+	stopped   bool
+	count     int
+	rotations uint64
+	last      time.Time
+	reason    string
+}
+
+// newRotator 根据组的配置创建轮换器，非 api 模式或未配置轮换策略时返回 nil
+func newRotator(am *APIManager, g *rule.FwdrGroup) *rotator {
+	c := g.Config()
+	if g.Strategy() != "api" || (c.RotateInterval <= 0 && c.RotateConns <= 0 && !c.RotateOnFailure) {
+		return nil
+	}
+
+	r := &rotator{
+		am:        am,
+		group:     g.Name(),
+		interval:  time.Duration(c.RotateInterval) * time.Second,
+		conns:     c.RotateConns,
+		onFailure: c.RotateOnFailure,
+		done:      make(chan struct{}),
+	}
+
+	g.Watch(func(e rule.Event) { r.onEvent(g, e) })
+	if r.interval > 0 {
+		go r.run()
+	}
+
+	log.F("[api] %s: rotate proxy every %ds, every %d connections, on failure: %t",
+		r.group, c.RotateInterval, r.conns, r.onFailure)
+
+	return r
+}
+
+// run 定时轮换
+func (r *rotator) run() {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+			r.rotate(rotateByInterval, r.am.GetCurrentProxy(r.group))
+		}
+	}
+}
+
+// stop 停止轮换，重新加载配置时旧的组不再轮换
+func (r *rotator) stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.stopped {
+		r.stopped = true
+		close(r.done)
+	}
+}
+
+// onEvent 统计新建的连接，并在当前代理连接失败时轮换
+func (r *rotator) onEvent(g *rule.FwdrGroup, e rule.Event) {
+	if e.Type != rule.EventDial {
+		return
+	}
+
+	if e.Err != nil {
+		if r.onFailure && e.Forwarder == g.CurrentProxy() {
+			r.rotate(rotateByFailure, e.Forwarder)
+		}
+		return
+	}
+
+	if r.conns <= 0 {
+		return
+	}
+
+	r.mu.Lock()
+	r.count++
+	reached := r.count >= r.conns
+	if reached {
+		r.count = 0
+	}
+	r.mu.Unlock()
+
+	if reached {
+		r.rotate(rotateByConns, g.CurrentProxy())
+	}
+}
+
+// rotate 将组从代理 from 切换到其他可用的代理，当前代理已经不是 from 时说明已被轮换过，不再切换
+func (r *rotator) rotate(reason string, from *rule.Forwarder) {
+	r.mu.Lock()
+	stopped := r.stopped
+	r.mu.Unlock()
+	if stopped {
+		return
+	}
+
+	f, err := r.am.RotateProxy(r.group, from)
+	if err != nil {
+		log.F("[api] %s: failed to rotate proxy, reason: %s, error: %v", r.group, reason, err)
+		return
+	}
+	if f == nil {
+		return
+	}
+
+	r.mu.Lock()
+	r.rotations++
+	r.last = time.Now()
+	r.reason = reason
+	r.mu.Unlock()
+
+	log.F("[api] %s: rotated proxy to %s, reason: %s", r.group, f.Addr(), reason)
+}
+
+// RotateProxy 将组的当前代理从 from 随机切换到其他已启用的代理，返回新的代理。
+// 轮换是串行的，当前代理已经不是 from 时不切换并返回 nil，同一代理的多次失败只会切换一次
+func (am *APIManager) RotateProxy(group string, from *rule.Forwarder) (*rule.Forwarder, error) {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+
+	g := am.group(group)
+	if g == nil {
+		return nil, errProxyNotFound
+	}
+
+	cur := g.CurrentProxy()
+	if cur != from {
+		return nil, nil
+	}
+
+	var candidates []*rule.Forwarder
+	for _, f := range g.GetForwarders() {
+		if f != cur && f.Enabled() {
+			candidates = append(candidates, f)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, errNoProxyToRotate
+	}
+
+	f := candidates[am.rng.Intn(len(candidates))]
+	am.setCurrentProxy(g, f)
+	return f, nil
+}
+
+// info 返回轮换策略和状态
+func (r *rotator) info() *RotationInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	info := &RotationInfo{
+		Interval:    int(r.interval / time.Second),
+		Conns:       r.conns,
+		OnFailure:   r.onFailure,
+		Rotations:   r.rotations,
+		Connections: r.count,
+		LastReason:  r.reason,
+	}
+	if !r.last.IsZero() {
+		last := r.last
+		info.LastRotated = &last
+	}
+	return info
+}
+
+// Rotation 返回指定组的自动轮换信息，未配置轮换策略时返回 nil
+func (am *APIManager) Rotation(group string) *RotationInfo {
+	am.mu.RLock()
+	r := am.rotators[group]
+	am.mu.RUnlock()
+
+	if r == nil {
+		return nil
+	}
+	return r.info()
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/nadoo/glider/rule"
+)
+
+// newTestAPIManager returns an api manager of a main group in api mode with
+// forwarders tagged by tags, all the forwarders are enabled.
+func newTestAPIManager(t *testing.T, c rule.Strategy, tags ...string) (*APIManager, *rule.FwdrGroup, map[string]*rule.Forwarder) {
+	t.Helper()
+
+	var forwards []string
+	for _, tag := range tags {
+		forwards = append(forwards, "direct://#tag="+tag)
+	}
+
+	c.Strategy = "api"
+	pxy := rule.NewProxy(forwards, &c, nil, nil, nil)
+	t.Cleanup(pxy.Close)
+
+	am := &APIManager{rng: rand.New(rand.NewSource(1))}
+	am.SetProxy(pxy)
+	t.Cleanup(func() {
+		for _, r := range am.rotators {
+			r.stop()
+		}
+	})
+
+	g := pxy.GetMainGroup()
+	fwdrs := make(map[string]*rule.Forwarder)
+	for _, f := range g.GetForwarders() {
+		f.Enable()
+		fwdrs[f.Tag()] = f
+	}
+	return am, g, fwdrs
+}
+
+func TestRotateProxyEnabledOnly(t *testing.T) {
+	am, g, fwdrs := newTestAPIManager(t, rule.Strategy{}, "a", "b", "c", "d")
+	fwdrs["b"].Disable()
+	fwdrs["c"].Suspend()
+	g.SetCurrentProxy(fwdrs["a"])
+
+	for range 100 {
+		cur := g.CurrentProxy()
+		f, err := am.RotateProxy("main", cur)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f == cur || !f.Enabled() || g.CurrentProxy() != f {
+			t.Fatalf("rotated from %s to %s, want the other enabled proxy", cur.Tag(), f.Tag())
+		}
+	}
+
+	// not rotated when the current proxy is not from
+	cur := g.CurrentProxy()
+	if f, err := am.RotateProxy("main", fwdrs["b"]); f != nil || err != nil || g.CurrentProxy() != cur {
+		t.Errorf("RotateProxy() from a proxy not current = %v, %v, want no rotation", f, err)
+	}
+
+	// no other enabled proxy
+	fwdrs["a"].Disable()
+	fwdrs["d"].Disable()
+	g.SetCurrentProxy(fwdrs["a"])
+	if _, err := am.RotateProxy("main", fwdrs["a"]); !errors.Is(err, errNoProxyToRotate) {
+		t.Errorf("RotateProxy() with no enabled proxy error = %v, want errNoProxyToRotate", err)
+	}
+	if g.CurrentProxy() != fwdrs["a"] {
+		t.Errorf("current proxy changed to %s with no enabled proxy", g.CurrentProxy().Tag())
+	}
+}
+
+func TestRotateOnFailureOnce(t *testing.T) {
+	am, g, fwdrs := newTestAPIManager(t, rule.Strategy{RotateOnFailure: true}, "a", "b", "c")
+	r := am.rotators["main"]
+	if r == nil {
+		t.Fatal("rotator of main group not created")
+	}
+
+	for round := range 10 {
+		cur := g.CurrentProxy()
+		if cur == nil {
+			cur = fwdrs["a"]
+			g.SetCurrentProxy(cur)
+		}
+		before := r.info().Rotations
+
+		// a burst of concurrent dial failures of the current proxy
+		var wg sync.WaitGroup
+		start := make(chan struct{})
+		for range 50 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				r.onEvent(g, rule.Event{Type: rule.EventDial, Forwarder: cur, Err: errors.New("dial failed")})
+			}()
+		}
+		close(start)
+		wg.Wait()
+
+		if n := r.info().Rotations - before; n != 1 {
+			t.Fatalf("round %d: %d rotations after a burst of failures, want 1", round, n)
+		}
+		if f := g.CurrentProxy(); f == cur || !f.Enabled() {
+			t.Fatalf("round %d: current proxy = %s, want another enabled proxy", round, f.Tag())
+		}
+	}
+
+	// failures of other proxies do not rotate
+	cur := g.CurrentProxy()
+	for _, f := range fwdrs {
+		if f != cur {
+			r.onEvent(g, rule.Event{Type: rule.EventDial, Forwarder: f, Err: errors.New("dial failed")})
+		}
+	}
+	if g.CurrentProxy() != cur {
+		t.Errorf("rotated on failures of proxies not current")
+	}
+}
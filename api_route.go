@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/nadoo/glider/proxy"
+	"github.com/nadoo/glider/rule"
+)
+
+// parseRouteMeta 解析路由查询的客户端地址和监听器，src 可以是 IP 或 IP:端口
+func parseRouteMeta(src, listener string) (*proxy.Metadata, error) {
+	meta := &proxy.Metadata{Listener: listener}
+	if src == "" {
+		return meta, nil
+	}
+
+	addrPort, err := netip.ParseAddrPort(src)
+	if err != nil {
+		ip, err := netip.ParseAddr(src)
+		if err != nil {
+			return nil, errors.New("invalid src: " + src)
+		}
+		addrPort = netip.AddrPortFrom(ip, 0)
+	}
+	meta.SrcAddr = net.TCPAddrFromAddrPort(addrPort)
+
+	return meta, nil
+}
+
+// newRouteInfo 根据路由结果生成路由信息
+func newRouteInfo(addr, network string, route rule.Route) *RouteInfo {
+	info := &RouteInfo{
+		Addr:      addr,
+		Network:   network,
+		RuleFile:  route.RuleFile,
+		Directive: route.Directive,
+		Value:     route.Value,
+		Group:     route.Group.Name(),
+	}
+	if route.Forwarder != nil {
+		info.Forwarder = newProxyInfo(route.Forwarder)
+	}
+
+	return info
+}
+
+// handleRoute 处理路由查询请求，返回请求会匹配的规则和使用的转发器，不会发起连接
+func handleRoute(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIResponse(w, http.StatusMethodNotAllowed, APIResponse{
+			Success: false,
+			Message: "Method not allowed, use GET",
+		})
+		return
+	}
+
+	q := r.URL.Query()
+	addr := q.Get("addr")
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		writeAPIResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid addr, use HOST:PORT",
+		})
+		return
+	}
+
+	network := strings.ToLower(q.Get("network"))
+	if network == "" {
+		network = "tcp"
+	}
+
+	meta, err := parseRouteMeta(q.Get("src"), q.Get("listener"))
+	if err != nil {
+		writeAPIResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	route := rulePxy.Load().Explain(meta, network, addr)
+	info := newRouteInfo(addr, network, route)
+	writeAPIResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Request to " + addr + " is routed to group " + info.Group,
+		Group:   info.Group,
+		Route:   info,
+	})
+}
+
+// runRoute 运行 glider -route，使用配置中的规则文件查询请求的路由，返回进程退出码。
+// 从 DNS 解析学习到的 IP 和转发器的健康状态只存在于运行中的 glider，需要通过 API 查询
+func runRoute(conf *Config) int {
+	if _, _, err := net.SplitHostPort(conf.route); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: invalid route address %s, use HOST:PORT\n", conf.route)
+		return 1
+	}
+
+	pxy := rule.NewProxy(conf.Forwards, &conf.Strategy, conf.rules, conf.geoip, conf.list)
+	defer pxy.Close()
+
+	info := newRouteInfo(conf.route, "tcp", pxy.Explain(nil, "tcp", conf.route))
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	printRoute(w, info)
+	w.Flush()
+
+	return 0
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/nadoo/glider/rule"
+)
+
+// newSessionInfo 根据粘性会话生成会话信息
+func newSessionInfo(g *rule.FwdrGroup, s rule.Session) SessionInfo {
+	info := SessionInfo{
+		ID:       s.ID,
+		Group:    g.Name(),
+		Proxy:    newProxyInfo(s.Forwarder),
+		Created:  s.Created,
+		LastUsed: s.LastUsed,
+	}
+	if ttl := g.Config().SessionTTL; ttl > 0 {
+		expires := s.LastUsed.Add(time.Duration(ttl) * time.Second)
+		info.Expires = &expires
+	}
+	return info
+}
+
+// sessionGroups 返回查询参数 group 指定的组，未指定时返回所有组，组不存在时写入错误响应并返回 nil
+func sessionGroups(w http.ResponseWriter, r *http.Request) []*rule.FwdrGroup {
+	name := r.URL.Query().Get("group")
+	if name == "" {
+		return apiManager.Groups()
+	}
+
+	g := apiManager.Group(name)
+	if g == nil {
+		writeAPIResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Group not found: " + name,
+			Group:   name,
+		})
+		return nil
+	}
+	return []*rule.FwdrGroup{g}
+}
+
+// handleSessions 处理会话列表请求，可通过查询参数 group 只列出指定组的会话
+func handleSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIResponse(w, http.StatusMethodNotAllowed, APIResponse{
+			Success: false,
+			Message: "Method not allowed, use GET",
+		})
+		return
+	}
+
+	groups := sessionGroups(w, r)
+	if groups == nil {
+		return
+	}
+
+	infos := []SessionInfo{}
+	for _, g := range groups {
+		for _, s := range g.Sessions() {
+			infos = append(infos, newSessionInfo(g, s))
+		}
+	}
+
+	writeAPIResponse(w, http.StatusOK, APIResponse{
+		Success:  true,
+		Message:  fmt.Sprintf("%d sessions", len(infos)),
+		Sessions: infos,
+	})
+}
+
+// handleExpireSession 处理会话过期请求，会话的下一个连接将使用新选择的代理
+func handleExpireSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeAPIResponse(w, http.StatusMethodNotAllowed, APIResponse{
+			Success: false,
+			Message: "Method not allowed, use DELETE",
+		})
+		return
+	}
+
+	groups := sessionGroups(w, r)
+	if groups == nil {
+		return
+	}
+
+	id := r.PathValue("id")
+	expired := 0
+	for _, g := range groups {
+		if g.ExpireSession(id) {
+			expired++
+		}
+	}
+
+	if expired == 0 {
+		writeAPIResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Session not found: " + id,
+		})
+		return
+	}
+
+	writeAPIResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Session expired in %d groups", expired),
+	})
+}
+
+// handleRerollSession 处理会话重新选择代理的请求
+func handleRerollSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeAPIResponse(w, http.StatusMethodNotAllowed, APIResponse{
+			Success: false,
+			Message: "Method not allowed, use POST",
+		})
+		return
+	}
+
+	groups := sessionGroups(w, r)
+	if groups == nil {
+		return
+	}
+
+	id := r.PathValue("id")
+	var infos []SessionInfo
+	for _, g := range groups {
+		if s, err := g.RerollSession(id); err == nil {
+			infos = append(infos, newSessionInfo(g, s))
+		}
+	}
+
+	if len(infos) == 0 {
+		writeAPIResponse(w, http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Session not found: " + id,
+		})
+		return
+	}
+
+	writeAPIResponse(w, http.StatusOK, APIResponse{
+		Success:  true,
+		Message:  "Session re-rolled successfully",
+		Sessions: infos,
+	})
+}
@@ -1,13 +1,17 @@
 package main
 
 import (
+	stdflag "flag"
 	"fmt"
+	"io"
 	"os"
 	"path"
+	"time"
 
 	"github.com/nadoo/conflag"
 
 	"github.com/nadoo/glider/dns"
+	"github.com/nadoo/glider/pkg/geoip"
 	"github.com/nadoo/glider/pkg/log"
 	"github.com/nadoo/glider/proxy"
 	"github.com/nadoo/glider/rule"
@@ -22,23 +26,30 @@ type Config struct {
 	TCPBufSize int
 	UDPBufSize int
 
-	Listens []string
+	Listens         []string
+	ShutdownTimeout int
 
 	Forwards []string
 	Strategy rule.Strategy
 
 	RuleFiles []string
 	RulesDir  string
+	RuleList  string
+	GeoIPDB   string
 
 	DNS       string
 	DNSConfig dns.Config
 
 	rules []*rule.Config
+	list  *rule.List
+	geoip *geoip.Reader
+	route string
 
 	Services []string
-	
+
 	// API server configuration
 	ServerPort string
+	API        APIConfig
 }
 
 func parseConfig() *Config {
@@ -48,55 +59,9 @@ func parseConfig() *Config {
 
 	scheme := flag.String("scheme", "", "show help message of proxy scheme, use 'all' to see all schemes")
 	example := flag.Bool("example", false, "show usage examples")
+	flag.StringVar(&conf.route, "route", "", "show the rule and forwarder the request to HOST:PORT is routed to, then exit")
 
-	flag.BoolVar(&conf.Verbose, "verbose", false, "verbose mode")
-	flag.IntVar(&conf.LogFlags, "logflags", 19, "do not change it if you do not know what it is, ref: https://pkg.go.dev/log#pkg-constants")
-	flag.IntVar(&conf.TCPBufSize, "tcpbufsize", 32768, "tcp buffer size in Bytes")
-	flag.IntVar(&conf.UDPBufSize, "udpbufsize", 2048, "udp buffer size in Bytes")
-	flag.StringSliceUniqVar(&conf.Listens, "listen", nil, "listen url, see the URL section below")
-
-	flag.StringSliceVar(&conf.Forwards, "forward", nil, "forward url, see the URL section below")
-	flag.StringVar(&conf.Strategy.Strategy, "strategy", "rr", `rr: Round Robin mode
-ha: High Availability mode
-lha: Latency based High Availability mode
-dh: Destination Hashing mode
-api: API controlled mode (requires -serverPort)`)
-	flag.StringVar(&conf.Strategy.Check, "check", "http://www.msftconnecttest.com/connecttest.txt#expect=200",
-		`check=tcp[://HOST:PORT]: tcp port connect check
-check=http://HOST[:PORT][/URI][#expect=REGEX_MATCH_IN_RESP_LINE]
-check=https://HOST[:PORT][/URI][#expect=REGEX_MATCH_IN_RESP_LINE]
-check=file://SCRIPT_PATH: run a check script, healthy when exitcode=0, env vars: FORWARDER_ADDR,FORWARDER_URL
-check=disable: disable health check`)
-	flag.IntVar(&conf.Strategy.CheckInterval, "checkinterval", 30, "fowarder check interval(seconds)")
-	flag.IntVar(&conf.Strategy.CheckTimeout, "checktimeout", 10, "fowarder check timeout(seconds)")
-	flag.IntVar(&conf.Strategy.CheckTolerance, "checktolerance", 0, "fowarder check tolerance(ms), switch only when new_latency < old_latency - tolerance, only used in lha mode")
-	flag.IntVar(&conf.Strategy.CheckLatencySamples, "checklatencysamples", 10, "use the average latency of the latest N checks")
-	flag.BoolVar(&conf.Strategy.CheckDisabledOnly, "checkdisabledonly", false, "check disabled fowarders only")
-	flag.IntVar(&conf.Strategy.MaxFailures, "maxfailures", 3, "max failures to change forwarder status to disabled")
-	flag.IntVar(&conf.Strategy.DialTimeout, "dialtimeout", 3, "dial timeout(seconds)")
-	flag.IntVar(&conf.Strategy.RelayTimeout, "relaytimeout", 0, "relay timeout(seconds)")
-	flag.StringVar(&conf.Strategy.IntFace, "interface", "", "source ip or source interface")
-
-	flag.StringSliceUniqVar(&conf.RuleFiles, "rulefile", nil, "rule file path")
-	flag.StringVar(&conf.RulesDir, "rules-dir", "", "rule file folder")
-
-	// dns configs
-	flag.StringVar(&conf.DNS, "dns", "", "local dns server listen address")
-	flag.StringSliceUniqVar(&conf.DNSConfig.Servers, "dnsserver", []string{"8.8.8.8:53"}, "remote dns server address")
-	flag.BoolVar(&conf.DNSConfig.AlwaysTCP, "dnsalwaystcp", false, "always use tcp to query upstream dns servers no matter there is a forwarder or not")
-	flag.IntVar(&conf.DNSConfig.Timeout, "dnstimeout", 3, "timeout value used in multiple dnsservers switch(seconds)")
-	flag.IntVar(&conf.DNSConfig.MaxTTL, "dnsmaxttl", 1800, "maximum TTL value for entries in the CACHE(seconds)")
-	flag.IntVar(&conf.DNSConfig.MinTTL, "dnsminttl", 0, "minimum TTL value for entries in the CACHE(seconds)")
-	flag.IntVar(&conf.DNSConfig.CacheSize, "dnscachesize", 4096, "max number of dns response in CACHE")
-	flag.BoolVar(&conf.DNSConfig.CacheLog, "dnscachelog", false, "show query log of dns cache")
-	flag.BoolVar(&conf.DNSConfig.NoAAAA, "dnsnoaaaa", false, "disable AAAA query")
-	flag.StringSliceUniqVar(&conf.DNSConfig.Records, "dnsrecord", nil, "custom dns record, format: domain/ip")
-
-	// service configs
-	flag.StringSliceUniqVar(&conf.Services, "service", nil, "run specified services, format: SERVICE_NAME[,SERVICE_CONFIG]")
-	
-	// API server configs
-	flag.StringVar(&conf.ServerPort, "serverPort", "", "API server port for remote management (e.g., 8080)")
+	defineFlags(flag, conf)
 
 	flag.Usage = usage
 	if err := flag.Parse(); err != nil {
@@ -118,7 +83,7 @@ check=disable: disable health check`)
 	// setup logger
 	log.Set(conf.Verbose, conf.LogFlags)
 
-	if len(conf.Listens) == 0 && conf.DNS == "" && len(conf.Services) == 0 {
+	if len(conf.Listens) == 0 && conf.DNS == "" && len(conf.Services) == 0 && conf.route == "" {
 		// flag.Usage()
 		fmt.Fprintf(os.Stderr, "ERROR: listen url must be specified.\n")
 		os.Exit(-1)
@@ -134,20 +99,120 @@ check=disable: disable health check`)
 		proxy.UDPBufSize = conf.UDPBufSize
 	}
 
-	loadRules(conf)
+	// api server
+	if conf.API.Listen == "" && conf.ServerPort != "" {
+		conf.API.Listen = ":" + conf.ServerPort
+	}
+
+	if err := loadRules(flag, conf); err != nil {
+		log.Fatal(err)
+	}
 	return conf
 }
 
-func loadRules(conf *Config) {
+// reloadConfig parses the command line and config files again like parseConfig,
+// but returns an error instead of exiting the process.
+func reloadConfig() (*Config, error) {
+	conf := &Config{}
+
+	fs := conflag.New()
+	fs.Init(os.Args[0], stdflag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.String("scheme", "", "")
+	fs.Bool("example", false, "")
+	fs.String("route", "", "")
+	defineFlags(fs, conf)
+
+	if err := fs.Parse(); err != nil {
+		return nil, err
+	}
+
+	if conf.API.Listen == "" && conf.ServerPort != "" {
+		conf.API.Listen = ":" + conf.ServerPort
+	}
+
+	if err := loadRules(fs, conf); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+// defineFlags defines all the config flags of conf in fs.
+func defineFlags(fs *conflag.Conflag, conf *Config) {
+	fs.BoolVar(&conf.Verbose, "verbose", false, "verbose mode")
+	fs.IntVar(&conf.LogFlags, "logflags", 19, "do not change it if you do not know what it is, ref: https://pkg.go.dev/log#pkg-constants")
+	fs.IntVar(&conf.TCPBufSize, "tcpbufsize", 32768, "tcp buffer size in Bytes")
+	fs.IntVar(&conf.UDPBufSize, "udpbufsize", 2048, "udp buffer size in Bytes")
+	fs.StringSliceUniqVar(&conf.Listens, "listen", nil, "listen url, see the URL section below")
+	fs.IntVar(&conf.ShutdownTimeout, "shutdowntimeout", 10, "time to wait for tcp connections to finish when shutting down(seconds), connections left will be closed, udp sessions are not waited for")
+
+	fs.StringSliceVar(&conf.Forwards, "forward", nil, "forward url, see the URL section below")
+	fs.StringVar(&conf.Strategy.Strategy, "strategy", "rr", `rr: Round Robin mode
+ha: High Availability mode
+lha: Latency based High Availability mode
+dh: Destination Hashing mode
+api: API controlled mode (requires -apilisten)`)
+	fs.StringVar(&conf.Strategy.Check, "check", "http://www.msftconnecttest.com/connecttest.txt#expect=200",
+		`check=tcp[://HOST:PORT]: tcp port connect check
+check=http://HOST[:PORT][/URI][#expect=REGEX_MATCH_IN_RESP_LINE]
+check=https://HOST[:PORT][/URI][#expect=REGEX_MATCH_IN_RESP_LINE]
+check=file://SCRIPT_PATH: run a check script, healthy when exitcode=0, env vars: FORWARDER_ADDR,FORWARDER_URL
+check=disable: disable health check`)
+	fs.IntVar(&conf.Strategy.CheckInterval, "checkinterval", 30, "fowarder check interval(seconds)")
+	fs.IntVar(&conf.Strategy.CheckTimeout, "checktimeout", 10, "fowarder check timeout(seconds)")
+	fs.IntVar(&conf.Strategy.CheckTolerance, "checktolerance", 0, "fowarder check tolerance(ms), switch only when new_latency < old_latency - tolerance, only used in lha mode")
+	fs.IntVar(&conf.Strategy.CheckLatencySamples, "checklatencysamples", 10, "use the average latency of the latest N checks")
+	fs.BoolVar(&conf.Strategy.CheckDisabledOnly, "checkdisabledonly", false, "check disabled fowarders only")
+	fs.IntVar(&conf.Strategy.MaxFailures, "maxfailures", 3, "max failures to change forwarder status to disabled")
+	fs.IntVar(&conf.Strategy.DialTimeout, "dialtimeout", 3, "dial timeout(seconds)")
+	fs.IntVar(&conf.Strategy.RelayTimeout, "relaytimeout", 0, "relay timeout(seconds)")
+	fs.StringVar(&conf.Strategy.IntFace, "interface", "", "source ip or source interface")
+	fs.IntVar(&conf.Strategy.RotateInterval, "rotateinterval", 0, "rotate the current forwarder every N seconds, only used in api mode")
+	fs.IntVar(&conf.Strategy.RotateConns, "rotateconns", 0, "rotate the current forwarder every N new connections, only used in api mode")
+	fs.BoolVar(&conf.Strategy.RotateOnFailure, "rotateonfailure", false, "rotate the current forwarder when it failed to dial, only used in api mode")
+	fs.IntVar(&conf.Strategy.SessionTTL, "sessionttl", 600, "sticky session expires when not used for N seconds, 0 means never, only used in api mode")
+
+	fs.StringSliceUniqVar(&conf.RuleFiles, "rulefile", nil, "rule file path")
+	fs.StringVar(&conf.RulesDir, "rules-dir", "", "rule file folder")
+	fs.StringVar(&conf.RuleList, "rulelist", "", "ordered rule list file path, rules like DOMAIN-SUFFIX,google.com,GROUP are checked from top to bottom before rule files")
+	fs.StringVar(&conf.GeoIPDB, "geoipdb", "", "geoip database file path in MaxMind DB(mmdb) format, used by geoip rules")
+
+	// dns configs
+	fs.StringVar(&conf.DNS, "dns", "", "local dns server listen address")
+	fs.StringSliceUniqVar(&conf.DNSConfig.Servers, "dnsserver", []string{"8.8.8.8:53"}, "remote dns server address")
+	fs.BoolVar(&conf.DNSConfig.AlwaysTCP, "dnsalwaystcp", false, "always use tcp to query upstream dns servers no matter there is a forwarder or not")
+	fs.IntVar(&conf.DNSConfig.Timeout, "dnstimeout", 3, "timeout value used in multiple dnsservers switch(seconds)")
+	fs.IntVar(&conf.DNSConfig.MaxTTL, "dnsmaxttl", 1800, "maximum TTL value for entries in the CACHE(seconds)")
+	fs.IntVar(&conf.DNSConfig.MinTTL, "dnsminttl", 0, "minimum TTL value for entries in the CACHE(seconds)")
+	fs.IntVar(&conf.DNSConfig.CacheSize, "dnscachesize", 4096, "max number of dns response in CACHE")
+	fs.BoolVar(&conf.DNSConfig.CacheLog, "dnscachelog", false, "show query log of dns cache")
+	fs.BoolVar(&conf.DNSConfig.NoAAAA, "dnsnoaaaa", false, "disable AAAA query")
+	fs.StringSliceUniqVar(&conf.DNSConfig.Records, "dnsrecord", nil, "custom dns record, format: domain/ip")
+
+	// service configs
+	fs.StringSliceUniqVar(&conf.Services, "service", nil, "run specified services, format: SERVICE_NAME[,SERVICE_CONFIG]")
+
+	// API server configs
+	fs.StringVar(&conf.ServerPort, "serverPort", "", "API server port for remote management (e.g., 8080), listen on all interfaces, use apilisten instead")
+	fs.StringVar(&conf.API.Listen, "apilisten", "", "API server listen address for remote management (e.g., 127.0.0.1:8080)")
+	fs.StringSliceUniqVar(&conf.API.Auth, "apiauth", nil, "API admin credential, format: TOKEN for bearer auth or USER:PASS for basic auth")
+	fs.StringSliceUniqVar(&conf.API.ReadOnlyAuth, "apireadonlyauth", nil, "API read-only credential, only GET requests are allowed, format: TOKEN or USER:PASS")
+	fs.StringVar(&conf.API.CertFile, "apicert", "", "API server tls cert file path, enable https when apicert and apikey are set")
+	fs.StringVar(&conf.API.KeyFile, "apikey", "", "API server tls key file path")
+	fs.StringVar(&conf.API.StateFile, "apistatefile", "", "file to save the proxy selections and forwarders changed by API, restored on startup")
+	fs.StringVar(&conf.API.AuditFile, "apiauditfile", "", "file to append the audit log of all the API requests which change the state, in json lines format")
+}
+
+func loadRules(fs *conflag.Conflag, conf *Config) error {
 	// rulefiles
 	for _, ruleFile := range conf.RuleFiles {
 		if !path.IsAbs(ruleFile) {
-			ruleFile = path.Join(flag.ConfDir(), ruleFile)
+			ruleFile = path.Join(fs.ConfDir(), ruleFile)
 		}
 
 		rule, err := rule.NewConfFromFile(ruleFile)
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
 
 		conf.rules = append(conf.rules, rule)
@@ -155,18 +220,53 @@ func loadRules(conf *Config) {
 
 	if conf.RulesDir != "" {
 		if !path.IsAbs(conf.RulesDir) {
-			conf.RulesDir = path.Join(flag.ConfDir(), conf.RulesDir)
+			conf.RulesDir = path.Join(fs.ConfDir(), conf.RulesDir)
 		}
 
 		ruleFolderFiles, _ := rule.ListDir(conf.RulesDir, ".rule")
 		for _, ruleFile := range ruleFolderFiles {
 			rule, err := rule.NewConfFromFile(ruleFile)
 			if err != nil {
-				log.Fatal(err)
+				return err
 			}
 			conf.rules = append(conf.rules, rule)
 		}
 	}
+
+	// rule list
+	if conf.RuleList != "" {
+		if !path.IsAbs(conf.RuleList) {
+			conf.RuleList = path.Join(fs.ConfDir(), conf.RuleList)
+		}
+
+		list, err := rule.NewListFromFile(conf.RuleList)
+		if err != nil {
+			return err
+		}
+		if err := list.CheckGroups(conf.rules); err != nil {
+			return err
+		}
+		conf.list = list
+	}
+
+	// geoip database
+	if conf.GeoIPDB != "" {
+		if !path.IsAbs(conf.GeoIPDB) {
+			conf.GeoIPDB = path.Join(fs.ConfDir(), conf.GeoIPDB)
+		}
+
+		db, err := geoip.Open(conf.GeoIPDB)
+		if err != nil {
+			return fmt.Errorf("failed to open geoip database: %w", err)
+		}
+		conf.geoip = db
+
+		meta := db.Metadata()
+		log.F("[geoip] loaded %s, type: %s, built at %s", conf.GeoIPDB, meta.DatabaseType,
+			time.Unix(int64(meta.BuildEpoch), 0).Format(time.DateTime))
+	}
+
+	return nil
 }
 
 func usage() {
@@ -177,6 +277,7 @@ func usage() {
 
 var usage1 = `
 Usage: glider [-listen URL]... [-forward URL]... [OPTION]...
+       glider ctl [OPTION]... COMMAND [ARGS]    (manage a running glider through its api server)
 
   e.g. glider -config /etc/glider/glider.conf
        glider -listen :8443 -forward socks5://serverA:1080 -forward socks5://serverB:1080 -verbose
@@ -206,10 +307,12 @@ SCHEME:
 Forwarder Options: FORWARD_URL#OPTIONS
    priority : the priority of that forwarder, the larger the higher, default: 0
    interface: the local interface or ip address used to connect remote server.
+   tag      : a name of that forwarder, used to select it in api mode.
 
    e.g. -forward socks5://server:1080#priority=100
         -forward socks5://server:1080#interface=eth0
         -forward socks5://server:1080#priority=100&interface=192.168.1.99
+        -forward socks5://server:1080#tag=hk1
 
 Services:
    dhcpd: service=dhcpd,INTERFACE,START_IP,END_IP,LEASE_MINUTES[,MAC=IP,MAC=IP...]
@@ -3,7 +3,8 @@
 # Glider API Mode Test Script
 # This script tests the API endpoints of Glider
 
-API_BASE="http://localhost:9000"
+API_BASE="${API_BASE:-http://localhost:9000}"
+API_TOKEN="${API_TOKEN:-change-me-admin-token}"
 
 echo "🚀 Testing Glider API Mode..."
 echo "=================================="
@@ -21,9 +22,9 @@ call_api() {
     echo "   Response:"
     
     if [ "$method" = "POST" ]; then
-        curl -s -X POST "$API_BASE$endpoint" | python3 -m json.tool 2>/dev/null || curl -s -X POST "$API_BASE$endpoint"
+        curl -s -H "Authorization: Bearer $API_TOKEN" -X POST "$API_BASE$endpoint" | python3 -m json.tool 2>/dev/null || curl -s -H "Authorization: Bearer $API_TOKEN" -X POST "$API_BASE$endpoint"
     else
-        curl -s "$API_BASE$endpoint" | python3 -m json.tool 2>/dev/null || curl -s "$API_BASE$endpoint"
+        curl -s -H "Authorization: Bearer $API_TOKEN" "$API_BASE$endpoint" | python3 -m json.tool 2>/dev/null || curl -s -H "Authorization: Bearer $API_TOKEN" "$API_BASE$endpoint"
     fi
     
     echo ""
@@ -65,5 +66,5 @@ echo "   - GET  /api/proxy/current  - Get currently selected proxy"
 echo "   - POST /api/proxy/change   - Switch to a different proxy"
 echo ""
 echo "💡 You can also test manually with:"
-echo "   curl http://localhost:9000/api/proxy/current"
-echo "   curl -X POST http://localhost:9000/api/proxy/change"
+echo "   curl -H 'Authorization: Bearer $API_TOKEN' http://localhost:9000/api/proxy/current"
+echo "   curl -H 'Authorization: Bearer $API_TOKEN' -X POST http://localhost:9000/api/proxy/change"
@@ -0,0 +1,671 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	stdflag "flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nadoo/glider/api"
+)
+
+var ctlUsage = `Usage: glider ctl [-api URL] [-auth CRED] [-group NAME] [-json] COMMAND [ARGS]
+
+Manage a running glider through its API server.
+
+Commands:
+  groups              list the forwarder groups
+  list                list the forwarders of the group
+  current             show the current forwarder of the group
+  change              switch the group to a random forwarder
+  select SELECTOR     switch the group to the forwarder
+  next, previous      switch the group to the next or previous enabled forwarder
+  check [SELECTOR]    check the forwarders of the group now, all groups if -group is not set
+  enable SELECTOR     resume a forwarder disabled through the api
+  disable SELECTOR    disable a forwarder, health checks won't enable it again
+  add URL             add a forwarder to the group, URL is the same as -forward
+  remove SELECTOR     remove a forwarder from the group
+  conns [ADDRESS]     list the relayed connections, only those via ADDRESS if set
+  close ID|ADDRESS    close a connection, or all the connections via ADDRESS
+  sessions            list the sticky sessions, of the group if -group is set
+  expire ID           expire a sticky session
+  reroll ID           pick a new forwarder for a sticky session
+  reload              reload the config file
+  dns                 show the dns cache statistics
+  dns cache           list the records in dns cache
+  dns lookup DOMAIN [TYPE]
+                      show the cached record of DOMAIN, TYPE is A(default), AAAA or a number
+  dns delete DOMAIN [-suffix]
+                      delete the cached records of DOMAIN, and its subdomains with -suffix
+  dns flush           delete all the cached records except custom records
+  dns add DOMAIN/IP   add a custom record, the same as -dnsrecord
+  dns remove DOMAIN   remove the custom records of DOMAIN
+  dhcp [leases]       list the dhcp leases
+  dhcp reserve MAC IP reserve IP as the static ip of MAC
+  dhcp unreserve MAC  remove the static ip of MAC
+  dhcp release MAC    release the dynamic lease of MAC
+                      append @IFACE to the dhcp commands to specify the interface
+  route ADDR [NETWORK] [src=IP] [listener=LISTENER]
+                      show the rule and forwarder the request to ADDR(HOST:PORT) is routed to
+  audit [USER] [N]    show the last N(default 20) audit entries, of USER and the group if set
+  events              print the api events until interrupted
+
+SELECTOR is a forwarder address, a forward url (contains "://"), a list index
+(digits), or one of address=ADDR, url=URL, index=N, tag=TAG.
+
+Flags:
+`
+
+// runCtl 运行 glider ctl 子命令，返回进程退出码
+func runCtl(args []string) int {
+	fs := stdflag.NewFlagSet("ctl", stdflag.ExitOnError)
+	base := fs.String("api", envOr("GLIDER_API", "127.0.0.1:9000"), "api server address or url, env GLIDER_API")
+	cred := fs.String("auth", os.Getenv("GLIDER_API_AUTH"), "api credential, TOKEN or USER:PASS, env GLIDER_API_AUTH")
+	group := fs.String("group", "", "forwarder group, default is "+defaultGroup)
+	asJSON := fs.Bool("json", false, "print the result as json")
+	timeout := fs.Duration("timeout", 30*time.Second, "request timeout, events are not limited")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), ctlUsage)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	cmd, cmdArgs := fs.Arg(0), fs.Args()[1:]
+	if cmd != "events" {
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	c := &ctl{
+		client: api.NewClient(*base, *cred),
+		group:  *group,
+		json:   *asJSON,
+		out:    os.Stdout,
+	}
+
+	if err := c.run(ctx, cmd, cmdArgs); err != nil {
+		fmt.Fprintln(os.Stderr, "glider ctl:", err)
+		return 1
+	}
+	return 0
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// ctl glider ctl 子命令的执行环境
+type ctl struct {
+	client *api.Client
+	group  string
+	json   bool
+	out    io.Writer
+}
+
+// run 执行一条命令
+func (c *ctl) run(ctx context.Context, cmd string, args []string) error {
+	// arg 返回第 i 个参数，缺少参数时返回错误
+	arg := func(i int, name string) (string, error) {
+		if len(args) <= i {
+			return "", fmt.Errorf("%s: %s must be specified", cmd, name)
+		}
+		return args[i], nil
+	}
+
+	switch cmd {
+	case "groups":
+		groups, err := c.client.Groups(ctx)
+		if err != nil {
+			return err
+		}
+		return c.print(groups, func(w io.Writer) {
+			fmt.Fprintln(w, "NAME\tSTRATEGY\tENABLED\tTOTAL\tCURRENT")
+			for _, g := range groups {
+				cur := "-"
+				if g.CurrentProxy != nil {
+					cur = g.CurrentProxy.Address
+				}
+				fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\n", g.Name, g.Strategy, g.Enabled, g.Total, cur)
+			}
+		})
+
+	case "list":
+		proxies, err := c.client.Forwarders(ctx, c.group)
+		if err != nil {
+			return err
+		}
+		// 当前代理只在 api 策略下存在，获取失败时不标记
+		var cur string
+		if p, _, err := c.client.Current(ctx, c.group); err == nil && p != nil {
+			cur = p.Address
+		}
+		return c.print(proxies, func(w io.Writer) {
+			fmt.Fprintln(w, "\tINDEX\tADDRESS\tTAG\tPRIORITY\tSTATUS\tLATENCY")
+			for i, p := range proxies {
+				mark := ""
+				if p.Address == cur {
+					mark = "*"
+				}
+				fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%d\t%s\t%s\n", mark, i, p.Address, p.Tag, p.Priority, proxyStatus(&p), latency(p.Latency))
+			}
+		})
+
+	case "current":
+		p, rot, err := c.client.Current(ctx, c.group)
+		if err != nil {
+			return err
+		}
+		if c.json {
+			return c.print(struct {
+				Proxy    *api.ProxyInfo    `json:"proxy"`
+				Rotation *api.RotationInfo `json:"rotation,omitempty"`
+			}{p, rot}, nil)
+		}
+		c.printProxy(p)
+		if rot != nil {
+			fmt.Fprintf(c.out, "rotations: %d, connections since last rotation: %d\n", rot.Rotations, rot.Connections)
+		}
+		return nil
+
+	case "change":
+		p, err := c.client.Change(ctx, c.group)
+		if err != nil {
+			return err
+		}
+		return c.print(p, func(io.Writer) { c.printProxy(p) })
+
+	case "select", "next", "previous":
+		sel := api.ProxySelector{Step: cmd}
+		if cmd == "select" {
+			s, err := arg(0, "selector")
+			if err != nil {
+				return err
+			}
+			if sel, err = parseSelector(s); err != nil {
+				return err
+			}
+		}
+		p, err := c.client.Select(ctx, c.group, sel)
+		if err != nil {
+			return err
+		}
+		return c.print(p, func(io.Writer) { c.printProxy(p) })
+
+	case "check":
+		var sel api.ProxySelector
+		if len(args) > 0 {
+			var err error
+			if sel, err = parseSelector(args[0]); err != nil {
+				return err
+			}
+		}
+
+		var checks []api.CheckInfo
+		var err error
+		if c.group == "" && len(args) == 0 {
+			checks, err = c.client.CheckAll(ctx)
+		} else {
+			checks, err = c.client.Check(ctx, c.group, sel)
+		}
+		if err != nil {
+			return err
+		}
+		return c.print(checks, func(w io.Writer) {
+			fmt.Fprintln(w, "GROUP\tADDRESS\tRESULT\tELAPSED")
+			for _, ck := range checks {
+				result := "SUCCESS"
+				if ck.Error != "" {
+					result = "FAILED: " + ck.Error
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", ck.Group, ck.Proxy.Address, result, latency(ck.Elapsed))
+			}
+		})
+
+	case "enable", "disable":
+		s, err := arg(0, "selector")
+		if err != nil {
+			return err
+		}
+		sel, err := parseSelector(s)
+		if err != nil {
+			return err
+		}
+		enabled := cmd == "enable"
+		p, err := c.client.UpdateForwarder(ctx, c.group, sel, api.ForwarderUpdate{Enabled: &enabled})
+		if err != nil {
+			return err
+		}
+		return c.print(p, func(io.Writer) { c.printProxy(p) })
+
+	case "add":
+		u, err := arg(0, "url")
+		if err != nil {
+			return err
+		}
+		p, err := c.client.AddForwarder(ctx, c.group, u)
+		if err != nil {
+			return err
+		}
+		return c.print(p, func(io.Writer) { c.printProxy(p) })
+
+	case "remove":
+		s, err := arg(0, "selector")
+		if err != nil {
+			return err
+		}
+		sel, err := parseSelector(s)
+		if err != nil {
+			return err
+		}
+		p, err := c.client.RemoveForwarder(ctx, c.group, sel)
+		if err != nil {
+			return err
+		}
+		return c.print(p, func(io.Writer) { c.printProxy(p) })
+
+	case "conns":
+		var forwarder string
+		if len(args) > 0 {
+			forwarder = args[0]
+		}
+		conns, err := c.client.Connections(ctx, forwarder)
+		if err != nil {
+			return err
+		}
+		return c.print(conns, func(w io.Writer) {
+			fmt.Fprintln(w, "ID\tNETWORK\tCLIENT\tTARGET\tFORWARDER\tDURATION\tUPLOAD\tDOWNLOAD")
+			for _, cn := range conns {
+				fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%d\t%d\n", cn.ID, cn.Network, cn.Client, cn.Target,
+					cn.Forwarder, time.Since(cn.Start).Round(time.Second), cn.Upload, cn.Download)
+			}
+		})
+
+	case "close":
+		s, err := arg(0, "connection id or forwarder address")
+		if err != nil {
+			return err
+		}
+		if id, err := strconv.ParseUint(s, 10, 64); err == nil {
+			_, err = c.client.CloseConnection(ctx, id)
+			return err
+		}
+		return c.client.CloseConnections(ctx, s)
+
+	case "sessions":
+		sessions, err := c.client.Sessions(ctx, c.group)
+		if err != nil {
+			return err
+		}
+		return c.print(sessions, func(w io.Writer) {
+			fmt.Fprintln(w, "ID\tGROUP\tADDRESS\tLAST USED\tEXPIRES")
+			for _, s := range sessions {
+				expires := "never"
+				if s.Expires != nil {
+					expires = time.Until(*s.Expires).Round(time.Second).String()
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s ago\t%s\n", s.ID, s.Group, s.Proxy.Address,
+					time.Since(s.LastUsed).Round(time.Second), expires)
+			}
+		})
+
+	case "expire":
+		id, err := arg(0, "session id")
+		if err != nil {
+			return err
+		}
+		return c.client.ExpireSession(ctx, id, c.group)
+
+	case "reroll":
+		id, err := arg(0, "session id")
+		if err != nil {
+			return err
+		}
+		sessions, err := c.client.RerollSession(ctx, id, c.group)
+		if err != nil {
+			return err
+		}
+		return c.print(sessions, func(w io.Writer) {
+			for _, s := range sessions {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", s.ID, s.Group, s.Proxy.Address)
+			}
+		})
+
+	case "reload":
+		groups, err := c.client.Reload(ctx)
+		if err != nil {
+			return err
+		}
+		return c.print(groups, func(w io.Writer) {
+			fmt.Fprintf(w, "config reloaded, %d groups\n", len(groups))
+		})
+
+	case "dns":
+		if len(args) > 0 {
+			return c.runDNS(ctx, args[0], args[1:])
+		}
+		info, err := c.client.DNS(ctx)
+		if err != nil {
+			return err
+		}
+		return c.print(info, func(w io.Writer) {
+			fmt.Fprintf(w, "entries: %d, hits: %d, misses: %d\n", info.Entries, info.Hits, info.Misses)
+		})
+
+	case "dhcp":
+		return c.runDHCP(ctx, args)
+
+	case "route":
+		if len(args) == 0 {
+			return errors.New("route needs an address, HOST:PORT")
+		}
+		q := api.RouteQuery{Addr: args[0]}
+		for _, a := range args[1:] {
+			key, value, ok := strings.Cut(a, "=")
+			switch {
+			case !ok:
+				q.Network = a
+			case key == "src":
+				q.Src = value
+			case key == "listener":
+				q.Listener = value
+			default:
+				return fmt.Errorf("unknown route argument: %s", a)
+			}
+		}
+		info, err := c.client.Route(ctx, q)
+		if err != nil {
+			return err
+		}
+		return c.print(info, func(w io.Writer) { printRoute(w, info) })
+
+	case "audit":
+		q := api.AuditQuery{Group: c.group, Limit: 20}
+		for _, a := range args {
+			if n, err := strconv.Atoi(a); err == nil {
+				q.Limit = n
+			} else {
+				q.User = a
+			}
+		}
+		entries, err := c.client.Audit(ctx, q)
+		if err != nil {
+			return err
+		}
+		return c.print(entries, func(w io.Writer) {
+			fmt.Fprintln(w, "TIME\tUSER\tREMOTE\tREQUEST\tSTATUS\tCHANGE")
+			for _, e := range entries {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s %s\t%d\t%s\n", e.Time.Format(time.DateTime), e.User, e.Remote,
+					e.Method, e.Path, e.Status, auditChange(&e))
+			}
+		})
+
+	case "events":
+		err := c.client.Events(ctx, c.group, func(ev api.APIEvent) {
+			if c.json {
+				json.NewEncoder(c.out).Encode(ev)
+				return
+			}
+			fmt.Fprintf(c.out, "%s %s %s", ev.Time.Format(time.TimeOnly), ev.Group, ev.Type)
+			if ev.Proxy != nil {
+				fmt.Fprintf(c.out, " %s", ev.Proxy.Address)
+			}
+			if ev.Error != "" {
+				fmt.Fprintf(c.out, " %s", ev.Error)
+			}
+			fmt.Fprintln(c.out)
+		})
+		// 被 Ctrl-C 中断是正常退出
+		if errors.Is(err, context.Canceled) {
+			return nil
+		}
+		return err
+	}
+
+	return fmt.Errorf("unknown command: %s, see glider ctl -h", cmd)
+}
+
+// runDNS 执行 dns 命令的子命令
+func (c *ctl) runDNS(ctx context.Context, cmd string, args []string) error {
+	if len(args) == 0 && cmd != "cache" && cmd != "flush" {
+		return fmt.Errorf("dns %s: domain must be specified", cmd)
+	}
+
+	switch cmd {
+	case "cache":
+		records, err := c.client.DNSCache(ctx)
+		if err != nil {
+			return err
+		}
+		return c.print(records, func(w io.Writer) { printDNSRecords(w, records...) })
+
+	case "lookup":
+		var qtype string
+		if len(args) > 1 {
+			qtype = args[1]
+		}
+		rec, err := c.client.LookupDNSCache(ctx, args[0], qtype)
+		if err != nil {
+			return err
+		}
+		return c.print(rec, func(w io.Writer) { printDNSRecords(w, *rec) })
+
+	case "delete":
+		suffix := len(args) > 1 && args[1] == "-suffix"
+		return c.client.DeleteDNSCache(ctx, args[0], suffix)
+
+	case "flush":
+		return c.client.FlushDNSCache(ctx)
+
+	case "add":
+		rec, err := c.client.AddDNSRecord(ctx, args[0])
+		if err != nil || rec == nil {
+			return err
+		}
+		return c.print(rec, func(w io.Writer) { printDNSRecords(w, *rec) })
+
+	case "remove":
+		return c.client.RemoveDNSRecord(ctx, args[0])
+	}
+
+	return fmt.Errorf("unknown dns command: %s, see glider ctl -h", cmd)
+}
+
+// auditChange 返回审计记录中组当前代理的变化
+func auditChange(e *api.AuditEntry) string {
+	addr := func(st *api.AuditState) string {
+		if st == nil || st.Current == nil {
+			return "-"
+		}
+		return st.Current.Address
+	}
+	if before, after := addr(e.Before), addr(e.After); before != after {
+		return before + " -> " + after
+	}
+	return ""
+}
+
+// runDHCP 执行 dhcp 命令，参数中最后的 @IFACE 指定接口
+func (c *ctl) runDHCP(ctx context.Context, args []string) error {
+	var iface string
+	if n := len(args); n > 0 && strings.HasPrefix(args[n-1], "@") {
+		iface, args = args[n-1][1:], args[:n-1]
+	}
+
+	cmd := "leases"
+	if len(args) > 0 {
+		cmd, args = args[0], args[1:]
+	}
+
+	switch cmd {
+	case "leases":
+		leases, err := c.client.DHCPLeases(ctx, iface)
+		if err != nil {
+			return err
+		}
+		return c.print(leases, func(w io.Writer) { printDHCPLeases(w, leases...) })
+
+	case "reserve":
+		if len(args) < 2 {
+			return errors.New("dhcp reserve: mac and ip must be specified")
+		}
+		l, err := c.client.AddDHCPStatic(ctx, api.DHCPReservation{Interface: iface, MAC: args[0], IP: args[1]})
+		if err != nil || l == nil {
+			return err
+		}
+		return c.print(l, func(w io.Writer) { printDHCPLeases(w, *l) })
+
+	case "unreserve", "release":
+		if len(args) < 1 {
+			return fmt.Errorf("dhcp %s: mac must be specified", cmd)
+		}
+		if cmd == "release" {
+			return c.client.ReleaseDHCPLease(ctx, args[0], iface)
+		}
+		return c.client.RemoveDHCPStatic(ctx, args[0], iface)
+	}
+
+	return fmt.Errorf("unknown dhcp command: %s, see glider ctl -h", cmd)
+}
+
+// printDHCPLeases 输出租约表格
+func printDHCPLeases(w io.Writer, leases ...api.DHCPLease) {
+	fmt.Fprintln(w, "INTERFACE\tMAC\tIP\tEXPIRES")
+	for _, l := range leases {
+		expires := "static"
+		if l.Expires != nil {
+			expires = time.Until(*l.Expires).Round(time.Second).String()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", l.Interface, l.MAC, l.IP, expires)
+	}
+}
+
+// printDNSRecords 输出DNS记录表格
+func printDNSRecords(w io.Writer, records ...api.DNSRecord) {
+	fmt.Fprintln(w, "DOMAIN\tTYPE\tTTL\tIPS")
+	for _, r := range records {
+		ttl := strconv.Itoa(r.TTL) + "s"
+		if r.Custom {
+			ttl = "custom"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.Domain, r.Type, ttl, strings.Join(r.IPs, ","))
+	}
+}
+
+// printRoute 输出路由查询结果
+func printRoute(w io.Writer, r *api.RouteInfo) {
+	fmt.Fprintf(w, "addr:\t%s %s\n", r.Network, r.Addr)
+	fmt.Fprintf(w, "group:\t%s\n", r.Group)
+	if r.RuleFile != "" {
+		fmt.Fprintf(w, "rule file:\t%s\n", r.RuleFile)
+	}
+	switch {
+	case r.Directive == "":
+		fmt.Fprintf(w, "rule:\tno rule matched\n")
+	case r.Value == "":
+		fmt.Fprintf(w, "rule:\t%s\n", r.Directive)
+	default:
+		fmt.Fprintf(w, "rule:\t%s=%s\n", r.Directive, r.Value)
+	}
+	if p := r.Forwarder; p != nil {
+		fmt.Fprintf(w, "forwarder:\t%s", p.Address)
+		if p.Tag != "" {
+			fmt.Fprintf(w, " [%s]", p.Tag)
+		}
+		fmt.Fprintf(w, " %s, latency %s\n", proxyStatus(p), latency(p.Latency))
+	}
+}
+
+// print 输出结果，使用 -json 时输出 JSON，否则调用 table 输出对齐的文本
+func (c *ctl) print(v any, table func(w io.Writer)) error {
+	if c.json || table == nil {
+		enc := json.NewEncoder(c.out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+
+	w := tabwriter.NewWriter(c.out, 0, 0, 2, ' ', 0)
+	table(w)
+	return w.Flush()
+}
+
+// printProxy 输出一个代理的信息
+func (c *ctl) printProxy(p *api.ProxyInfo) {
+	if p == nil {
+		return
+	}
+	fmt.Fprintf(c.out, "%s", p.Address)
+	if p.Tag != "" {
+		fmt.Fprintf(c.out, " [%s]", p.Tag)
+	}
+	fmt.Fprintf(c.out, " %s, latency %s\n", proxyStatus(p), latency(p.Latency))
+}
+
+// proxyStatus 返回代理的状态描述
+func proxyStatus(p *api.ProxyInfo) string {
+	switch {
+	case p.Suspended:
+		return "suspended"
+	case p.Enabled:
+		return "enabled"
+	default:
+		return "disabled"
+	}
+}
+
+// latency 将纳秒格式化为毫秒
+func latency(ns int64) string {
+	return strconv.FormatInt(ns/int64(time.Millisecond), 10) + "ms"
+}
+
+// parseSelector 解析命令行中的代理选择器
+func parseSelector(s string) (api.ProxySelector, error) {
+	var sel api.ProxySelector
+	key, value, _ := strings.Cut(s, "=")
+	switch key {
+	case "address", "url", "index", "tag":
+	default:
+		switch {
+		case strings.Contains(s, "://"):
+			key, value = "url", s
+		case strings.Trim(s, "0123456789") == "":
+			key, value = "index", s
+		default:
+			key, value = "address", s
+		}
+	}
+
+	switch key {
+	case "address":
+		sel.Address = value
+	case "url":
+		sel.URL = value
+	case "tag":
+		sel.Tag = value
+	case "index":
+		idx, err := strconv.Atoi(value)
+		if err != nil {
+			return sel, errors.New("invalid index: " + value)
+		}
+		sel.Index = &idx
+	}
+	return sel, nil
+}
@@ -2,6 +2,7 @@ package dns
 
 import (
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -13,6 +14,16 @@ type LruCache struct {
 	tail  *item
 	cache map[string]*item
 	store map[string][]byte
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+// CacheStats is the statistics of LruCache.
+type CacheStats struct {
+	Hits    uint64 // lookups found in cache, including expired items
+	Misses  uint64 // lookups not found in cache
+	Entries int    // items in cache, including custom records
 }
 
 // item is the struct of cache item.
@@ -24,28 +35,40 @@ type item struct {
 	next *item
 }
 
+// CacheEntry is an entry in LruCache.
+type CacheEntry struct {
+	Key     string
+	Value   []byte
+	Expires time.Time // zero for the items set with ttl 0, they never expire
+}
+
 // NewLruCache returns a new LruCache.
 func NewLruCache(size int) *LruCache {
-	// init 2 items here, it doesn't matter cuz they will be deleted when the cache is full
-	head, tail := &item{key: "head"}, &item{key: "tail"}
-	head.next, tail.prev = tail, head
 	c := &LruCache{
 		size:  size,
-		head:  head,
-		tail:  tail,
-		cache: make(map[string]*item, size),
 		store: make(map[string][]byte),
 	}
-	c.cache[head.key], c.cache[tail.key] = head, tail
+	c.reset()
 	return c
 }
 
+// reset removes all the items with ttl from cache.
+func (c *LruCache) reset() {
+	// init 2 items here, it doesn't matter cuz they will be deleted when the cache is full
+	head, tail := &item{key: "head"}, &item{key: "tail"}
+	head.next, tail.prev = tail, head
+	c.head, c.tail = head, tail
+	c.cache = make(map[string]*item, c.size)
+	c.cache[head.key], c.cache[tail.key] = head, tail
+}
+
 // Get gets an item from cache.
 func (c *LruCache) Get(k string) (v []byte, expired bool) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	if v, ok := c.store[k]; ok {
+		c.hits.Add(1)
 		return v, false
 	}
 
@@ -55,10 +78,108 @@ func (c *LruCache) Get(k string) (v []byte, expired bool) {
 			expired = true
 		}
 		c.moveToHead(it)
+		c.hits.Add(1)
+		return
 	}
+
+	c.misses.Add(1)
 	return
 }
 
+// Stats returns the statistics of cache.
+func (c *LruCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// exclude the 2 init items if they are still in cache
+	entries := len(c.cache) + len(c.store)
+	for _, k := range []string{"head", "tail"} {
+		if _, ok := c.cache[k]; ok {
+			entries--
+		}
+	}
+
+	return CacheStats{Hits: c.hits.Load(), Misses: c.misses.Load(), Entries: entries}
+}
+
+// Lookup returns the entry of key k, it does not affect the statistics and order of cache.
+func (c *LruCache) Lookup(k string) (CacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if v, ok := c.store[k]; ok {
+		return CacheEntry{Key: k, Value: v}, true
+	}
+
+	if it, ok := c.cache[k]; ok && !isInitItem(it) {
+		return CacheEntry{Key: k, Value: it.val, Expires: time.Unix(it.exp, 0)}, true
+	}
+
+	return CacheEntry{}, false
+}
+
+// Entries returns all the entries in cache, the items set with ttl 0 come first,
+// then the items with ttl from the most recently used.
+func (c *LruCache) Entries() []CacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entries := make([]CacheEntry, 0, len(c.store)+len(c.cache))
+	for k, v := range c.store {
+		entries = append(entries, CacheEntry{Key: k, Value: v})
+	}
+	for it := c.head; it != nil; it = it.next {
+		if !isInitItem(it) {
+			entries = append(entries, CacheEntry{Key: it.key, Value: it.val, Expires: time.Unix(it.exp, 0)})
+		}
+	}
+	return entries
+}
+
+// DeleteFunc removes the items with ttl whose key matches from cache,
+// and returns the number of removed items.
+func (c *LruCache) DeleteFunc(match func(k string) bool) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := 0
+	for k, it := range c.cache {
+		if !isInitItem(it) && match(k) {
+			c.remove(it)
+			n++
+		}
+	}
+	return n
+}
+
+// Flush removes all the items with ttl from cache, and returns the number of them.
+// The items set with ttl 0 are kept.
+func (c *LruCache) Flush() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := 0
+	for _, it := range c.cache {
+		if !isInitItem(it) {
+			n++
+		}
+	}
+	c.reset()
+	return n
+}
+
+// Unset removes the item set with ttl 0.
+func (c *LruCache) Unset(k string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.store[k]; !ok {
+		return false
+	}
+	delete(c.store, k)
+	return true
+}
+
 // Set sets an item with key, value, and ttl(seconds).
 // if the ttl is zero, this item will be set and never be deleted.
 // if the key exists, update it with value and exp and move it to head.
@@ -95,7 +216,11 @@ func (c *LruCache) putToHead(k string, v []byte, exp int64) {
 	it := &item{key: k, val: v, exp: exp, prev: nil, next: c.head}
 	it.prev = nil
 	it.next = c.head
-	c.head.prev = it
+	if c.head != nil {
+		c.head.prev = it
+	} else {
+		c.tail = it
+	}
 	c.head = it
 
 	c.cache[k] = it
@@ -120,8 +245,28 @@ func (c *LruCache) moveToHead(it *item) {
 
 // removeTail removes the tail from cache.
 func (c *LruCache) removeTail() {
-	delete(c.cache, c.tail.key)
+	c.remove(c.tail)
+}
+
+// remove removes an existing item from cache.
+func (c *LruCache) remove(it *item) {
+	delete(c.cache, it.key)
+
+	if it.prev != nil {
+		it.prev.next = it.next
+	} else {
+		c.head = it.next
+	}
+
+	if it.next != nil {
+		it.next.prev = it.prev
+	} else {
+		c.tail = it.prev
+	}
+	it.prev, it.next = nil, nil
+}
 
-	c.tail.prev.next = nil
-	c.tail = c.tail.prev
+// isInitItem reports whether it is one of the 2 init items.
+func isInitItem(it *item) bool {
+	return it.val == nil && (it.key == "head" || it.key == "tail")
 }
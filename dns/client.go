@@ -8,6 +8,7 @@ import (
 	"net/netip"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/nadoo/glider/pkg/log"
@@ -15,8 +16,9 @@ import (
 	"github.com/nadoo/glider/proxy"
 )
 
-// AnswerHandler function handles the dns TypeA or TypeAAAA answer.
-type AnswerHandler func(domain string, ip netip.Addr) error
+// AnswerHandler function handles the dns TypeA or TypeAAAA answer,
+// ttl is the ttl in seconds the answer is cached for.
+type AnswerHandler func(domain string, ip netip.Addr, ttl int) error
 
 // Config for dns.
 type Config struct {
@@ -38,6 +40,7 @@ type Client struct {
 	config      *Config
 	upStream    *UPStream
 	upStreamMap map[string]*UPStream
+	upStreamMu  sync.RWMutex
 	handlers    []AnswerHandler
 }
 
@@ -129,23 +132,28 @@ func (c *Client) handleAnswer(respBytes []byte, clientAddr, dnsServer, network,
 		ttl = 1800
 	}
 
+	addrs := make([]string, len(ips))
+	for i, ip := range ips {
+		for _, h := range c.handlers {
+			h(resp.Question.QNAME, ip, ttl)
+		}
+		addrs[i] = ip.String()
+	}
+
 	c.cache.Set(qKey(resp.Question), valCopy(respBytes), ttl)
 	log.F("[dns] %s <-> %s(%s) via %s, %s/%d: %s, ttl: %ds",
-		clientAddr, dnsServer, network, dialerAddr, resp.Question.QNAME, resp.Question.QTYPE, strings.Join(ips, ","), ttl)
+		clientAddr, dnsServer, network, dialerAddr, resp.Question.QNAME, resp.Question.QTYPE, strings.Join(addrs, ","), ttl)
 
 	return nil
 }
 
-func (c *Client) extractAnswer(resp *Message) ([]string, int) {
-	var ips []string
+func (c *Client) extractAnswer(resp *Message) ([]netip.Addr, int) {
+	var ips []netip.Addr
 	ttl := c.config.MinTTL
 	for _, answer := range resp.Answers {
 		if answer.TYPE == QTypeA || answer.TYPE == QTypeAAAA {
 			if answer.IP.IsValid() && !answer.IP.IsUnspecified() {
-				for _, h := range c.handlers {
-					h(resp.Question.QNAME, answer.IP)
-				}
-				ips = append(ips, answer.IP.String())
+				ips = append(ips, answer.IP)
 			}
 			if answer.TTL != 0 {
 				ttl = int(answer.TTL)
@@ -263,11 +271,29 @@ func (c *Client) exchangeUDP(rc net.Conn, reqBytes []byte) ([]byte, error) {
 
 // SetServers sets upstream dns servers for the given domain.
 func (c *Client) SetServers(domain string, servers []string) {
+	c.upStreamMu.Lock()
+	defer c.upStreamMu.Unlock()
 	c.upStreamMap[strings.ToLower(domain)] = NewUPStream(servers)
 }
 
+// ReplaceServers replaces all the custom dns servers set by SetServers,
+// servers is a map of domain to its dns servers.
+func (c *Client) ReplaceServers(servers map[string][]string) {
+	m := make(map[string]*UPStream, len(servers))
+	for domain, s := range servers {
+		m[strings.ToLower(domain)] = NewUPStream(s)
+	}
+
+	c.upStreamMu.Lock()
+	defer c.upStreamMu.Unlock()
+	c.upStreamMap = m
+}
+
 // UpStream returns upstream dns server for the given domain.
 func (c *Client) UpStream(domain string) *UPStream {
+	c.upStreamMu.RLock()
+	defer c.upStreamMu.RUnlock()
+
 	domain = strings.ToLower(domain)
 	for i := len(domain); i != -1; {
 		i = strings.LastIndexByte(domain[:i], '.')
@@ -278,6 +304,84 @@ func (c *Client) UpStream(domain string) *UPStream {
 	return c.upStream
 }
 
+// CacheStats returns the statistics of dns cache.
+func (c *Client) CacheStats() CacheStats {
+	return c.cache.Stats()
+}
+
+// CacheRecord is a dns answer in cache.
+type CacheRecord struct {
+	Domain string
+	Type   uint16
+	IPs    []string
+	TTL    int  // remaining ttl in seconds, negative if expired
+	Custom bool // added by AddRecord, never expires
+}
+
+// newCacheRecord parses the cache entry, the answer is not parsed if it's invalid.
+func newCacheRecord(e CacheEntry) CacheRecord {
+	r := CacheRecord{Domain: e.Key, Custom: e.Expires.IsZero()}
+	if i := strings.LastIndexByte(e.Key, '/'); i >= 0 {
+		r.Domain = e.Key[:i]
+		qtype, _ := strconv.ParseUint(e.Key[i+1:], 10, 16)
+		r.Type = uint16(qtype)
+	}
+
+	if !r.Custom {
+		r.TTL = int(e.Expires.Unix() - time.Now().Unix())
+	}
+
+	if m, err := UnmarshalMessage(e.Value); err == nil {
+		for _, answer := range m.Answers {
+			if answer.IP.IsValid() {
+				r.IPs = append(r.IPs, answer.IP.String())
+			}
+		}
+	}
+
+	return r
+}
+
+// CacheRecords returns all the records in dns cache, custom records come first.
+func (c *Client) CacheRecords() []CacheRecord {
+	entries := c.cache.Entries()
+	records := make([]CacheRecord, len(entries))
+	for i, e := range entries {
+		records[i] = newCacheRecord(e)
+	}
+	return records
+}
+
+// LookupCache returns the cached record of domain and qtype without querying upstream servers.
+func (c *Client) LookupCache(domain string, qtype uint16) (CacheRecord, bool) {
+	e, ok := c.cache.Lookup(qKey(NewQuestion(qtype, domain)))
+	if !ok {
+		return CacheRecord{}, false
+	}
+	return newCacheRecord(e), true
+}
+
+// DeleteCache removes the cached records of domain, if suffix is true, the records
+// of its subdomains are removed too. Custom records are not affected, use RemoveRecord.
+// It returns the number of removed records.
+func (c *Client) DeleteCache(domain string, suffix bool) int {
+	domain = strings.ToLower(domain)
+	return c.cache.DeleteFunc(func(k string) bool {
+		name := k
+		if i := strings.LastIndexByte(k, '/'); i >= 0 {
+			name = k[:i]
+		}
+		name = strings.ToLower(name)
+		return name == domain || suffix && strings.HasSuffix(name, "."+domain)
+	})
+}
+
+// FlushCache removes all the cached records except custom records,
+// and returns the number of removed records.
+func (c *Client) FlushCache() int {
+	return c.cache.Flush()
+}
+
 // AddHandler adds a custom handler to handle the resolved result (A and AAAA).
 func (c *Client) AddHandler(h AnswerHandler) {
 	c.handlers = append(c.handlers, h)
@@ -309,6 +413,18 @@ func (c *Client) AddRecord(record string) error {
 	return nil
 }
 
+// RemoveRecord removes the custom records of domain added by AddRecord,
+// and returns the number of removed records.
+func (c *Client) RemoveRecord(domain string) int {
+	n := 0
+	for _, qtype := range []uint16{QTypeA, QTypeAAAA} {
+		if c.cache.Unset(qKey(NewQuestion(qtype, domain))) {
+			n++
+		}
+	}
+	return n
+}
+
 // MakeResponse makes a dns response message for the given domain and ip address.
 // Note: you should make sure ttl > 0.
 func MakeResponse(domain, ip string, ttl uint32) (*Message, error) {
@@ -20,6 +20,8 @@ type Server struct {
 	addr string
 	// Client is used to communicate with upstream dns servers
 	*Client
+
+	listeners proxy.Listeners
 }
 
 // NewServer returns a new dns server.
@@ -47,6 +49,11 @@ func (s *Server) Start() {
 	wg.Wait()
 }
 
+// Close stops the dns server, queries being served are not affected.
+func (s *Server) Close() error {
+	return s.listeners.Close()
+}
+
 // ListenAndServeUDP listen and serves on udp port.
 func (s *Server) ListenAndServeUDP(wg *sync.WaitGroup) {
 	pc, err := net.ListenPacket("udp", s.addr)
@@ -57,14 +64,21 @@ func (s *Server) ListenAndServeUDP(wg *sync.WaitGroup) {
 	}
 	defer pc.Close()
 
+	if !s.listeners.Add(pc) {
+		return
+	}
+
 	log.F("[dns] listening UDP on %s", s.addr)
 
 	for {
 		reqBytes := pool.GetBuffer(UDPMaxLen)
 		n, caddr, err := pc.ReadFrom(reqBytes)
 		if err != nil {
-			log.F("[dns] local read error: %v", err)
 			pool.PutBuffer(reqBytes)
+			if s.listeners.Closed() {
+				return
+			}
+			log.F("[dns] local read error: %v", err)
 			continue
 		}
 		go s.ServePacket(pc, caddr, reqBytes[:n])
@@ -101,11 +115,18 @@ func (s *Server) ListenAndServeTCP(wg *sync.WaitGroup) {
 	}
 	defer l.Close()
 
+	if !s.listeners.Add(l) {
+		return
+	}
+
 	log.F("[dns-tcp] listening TCP on %s", s.addr)
 
 	for {
 		c, err := l.Accept()
 		if err != nil {
+			if s.listeners.Closed() {
+				return
+			}
 			log.F("[dns-tcp] error: failed to accept: %v", err)
 			continue
 		}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
@@ -14,53 +15,81 @@ import (
 	"github.com/nadoo/glider/proxy"
 	"github.com/nadoo/glider/rule"
 	"github.com/nadoo/glider/service"
+	"github.com/nadoo/glider/service/dhcpd"
 )
 
 var (
 	version = "0.17.0"
-	config  = parseConfig()
+	config  *Config
 )
 
 func main() {
+	// glider ctl manages a running glider through its api server
+	if len(os.Args) > 1 && os.Args[1] == "ctl" {
+		os.Exit(runCtl(os.Args[2:]))
+	}
+	config = parseConfig()
+
+	// glider -route explains the rules without starting anything
+	if config.route != "" {
+		os.Exit(runRoute(config))
+	}
+
+	// config can not be reloaded until all the proxy servers started
+	reloadMu.Lock()
+	loadedConf = config
+
 	// global rule proxy
-	pxy := rule.NewProxy(config.Forwards, &config.Strategy, config.rules)
-	
+	pxy := rule.NewProxy(config.Forwards, &config.Strategy, config.rules, config.geoip, config.list)
+	rulePxy.Store(pxy)
+
+	// restore the runtime state changed through api
+	if config.API.Listen != "" && config.API.StateFile != "" {
+		stateFile = newStateStore(config.API.StateFile)
+		stateFile.apply(pxy)
+	}
+
 	// setup API manager for API strategy mode
-	if config.ServerPort != "" {
-		// 设置全局API管理器
-		rule.SetAPIManager(GetAPIManager())
-		
-		// 启动API服务器
-		StartAPIServer(config.ServerPort)
-		log.F("[main] API server enabled on port %s", config.ServerPort)
+	var apiServer *http.Server
+	if config.API.Listen != "" {
+		// 打开审计日志
+		if config.API.AuditFile != "" {
+			var err error
+			if auditLog, err = openAuditStore(config.API.AuditFile); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		// 设置API管理器管理的转发器组
+		GetAPIManager().SetProxy(pxy)
+
+		// 启动API服务器，实时统计连接的流量
+		proxy.CountBytes(true)
+		var err error
+		if apiServer, err = StartAPIServer(&config.API); err != nil {
+			log.Fatal(err)
+		}
+		log.F("[main] API server enabled on %s", config.API.Listen)
 	}
 
 	// ipset manager
-	ipsetM, _ := ipset.NewManager(config.rules)
+	if m, err := ipset.NewManager(config.rules); err == nil {
+		ipsetM.Store(m)
+	}
 
 	// check and setup dns server
+	var d *dns.Server
 	if config.DNS != "" {
-		d, err := dns.NewServer(config.DNS, pxy, &config.DNSConfig)
-		if err != nil {
+		var err error
+		if d, err = dns.NewServer(config.DNS, rulePxy, &config.DNSConfig); err != nil {
 			log.Fatal(err)
 		}
 
-		// rules
-		for _, r := range config.rules {
-			if len(r.DNSServers) > 0 {
-				for _, domain := range r.Domain {
-					d.SetServers(domain, r.DNSServers)
-				}
-			}
-		}
-
-		// add a handler to update proxy rules when a domain resolved
-		d.AddHandler(pxy.AddDomainIP)
-		if ipsetM != nil {
-			d.AddHandler(ipsetM.AddDomainIP)
-		}
+		// rules, and handlers to update proxy rules when a domain resolved
+		setupDNS(d, config.rules)
 
 		d.Start()
+		GetAPIManager().SetDNS(d)
 
 		// custom resolver
 		net.DefaultResolver = &net.Resolver{
@@ -74,6 +103,7 @@ func main() {
 
 	for _, r := range config.rules {
 		r.IP, r.CIDR, r.Domain = nil, nil, nil
+		r.DomainFull, r.DomainKeyword, r.DomainRegex = nil, nil, nil
 	}
 
 	// enable checkers
@@ -81,42 +111,41 @@ func main() {
 
 	// run proxy servers
 	for _, listen := range config.Listens {
-		local, err := proxy.ServerFromURL(listen, pxy)
-		if err != nil {
+		if err := startServer(listen); err != nil {
 			log.Fatal(err)
 		}
-		go local.ListenAndServe()
 	}
+	reloadMu.Unlock()
 
 	// run services
+	var services []service.Service
 	for _, s := range config.Services {
 		service, err := service.New(s)
 		if err != nil {
 			log.Fatal(err)
 		}
+		services = append(services, service)
 		go service.Run()
-	}
-	
-	// setup proxy list for API manager if API server is enabled
-	if config.ServerPort != "" {
-		setupAPIProxyList(pxy)
+
+		// dhcp leases can be managed through api
+		if m, ok := service.(dhcpd.Manager); ok {
+			GetAPIManager().AddDHCP(m)
+		}
 	}
 
 	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
-	<-sigCh
-}
-
-// setupAPIProxyList 设置API管理器的代理列表
-func setupAPIProxyList(pxy *rule.Proxy) {
-	// 获取主转发器组的代理列表
-	if mainGroup := pxy.GetMainGroup(); mainGroup != nil {
-		proxies := mainGroup.GetForwarders()
-		if len(proxies) > 0 {
-			GetAPIManager().SetProxyList(proxies)
-			log.F("[main] API manager initialized with %d proxies", len(proxies))
-		} else {
-			log.F("[main] Warning: No proxies available for API manager")
+	signal.Notify(sigCh, append([]os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP}, checkSignals...)...)
+	for sig := range sigCh {
+		switch sig {
+		case syscall.SIGINT, syscall.SIGTERM:
+			shutdown(sigCh, apiServer, d, services)
+			return
+		case syscall.SIGHUP:
+			if err := reload(); err != nil {
+				log.Printf("[reload] failed to reload config: %v", err)
+			}
+		default:
+			go checkAll()
 		}
 	}
 }
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nadoo/glider/proxy"
+)
+
+// listenerProxy 包装监听器使用的 proxy.Proxy，统计每个监听器的连接数
+type listenerProxy struct {
+	proxy.Proxy
+	name  string
+	conns atomic.Uint64
+}
+
+var (
+	listenersMu sync.Mutex
+	listeners   []*listenerProxy
+)
+
+// newListenerProxy 返回监听器 listen 使用的 proxy.Proxy
+func newListenerProxy(listen string, p proxy.Proxy) *listenerProxy {
+	lp := &listenerProxy{Proxy: p, name: listenerName(listen)}
+
+	listenersMu.Lock()
+	listeners = append(listeners, lp)
+	listenersMu.Unlock()
+
+	return lp
+}
+
+// removeListenerProxy 监听器停止后将其从统计中移除
+func removeListenerProxy(lp *listenerProxy) {
+	listenersMu.Lock()
+	defer listenersMu.Unlock()
+	listeners = slices.DeleteFunc(listeners, func(l *listenerProxy) bool { return l == lp })
+}
+
+// listenerName 去掉监听URL中的用户名、密码和参数，只保留协议和地址
+func listenerName(listen string) string {
+	var names []string
+	for _, s := range strings.Split(listen, ",") {
+		if !strings.Contains(s, "://") {
+			s = "mixed://" + s
+		}
+		u, err := url.Parse(s)
+		if err != nil {
+			names = append(names, s[:strings.Index(s, ":")])
+			continue
+		}
+		names = append(names, u.Scheme+"://"+u.Host)
+	}
+	return strings.Join(names, ",")
+}
+
+// meta 返回加上监听器名称的请求元数据，规则可以按监听器匹配
+func (p *listenerProxy) meta(meta *proxy.Metadata) *proxy.Metadata {
+	m := &proxy.Metadata{}
+	if meta != nil {
+		*m = *meta
+	}
+	m.Listener = p.name
+	return m
+}
+
+// Dial implements proxy.Proxy.
+func (p *listenerProxy) Dial(network, addr string) (net.Conn, proxy.Dialer, error) {
+	p.conns.Add(1)
+	return p.Proxy.DialMeta(p.meta(nil), network, addr)
+}
+
+// DialMeta implements proxy.Proxy.
+func (p *listenerProxy) DialMeta(meta *proxy.Metadata, network, addr string) (net.Conn, proxy.Dialer, error) {
+	p.conns.Add(1)
+	return p.Proxy.DialMeta(p.meta(meta), network, addr)
+}
+
+// DialUDP implements proxy.Proxy.
+func (p *listenerProxy) DialUDP(network, addr string) (net.PacketConn, proxy.UDPDialer, error) {
+	p.conns.Add(1)
+	return p.Proxy.DialUDPMeta(p.meta(nil), network, addr)
+}
+
+// DialUDPMeta implements proxy.Proxy.
+func (p *listenerProxy) DialUDPMeta(meta *proxy.Metadata, network, addr string) (net.PacketConn, proxy.UDPDialer, error) {
+	p.conns.Add(1)
+	return p.Proxy.DialUDPMeta(p.meta(meta), network, addr)
+}
+
+// NextDialer implements proxy.Proxy.
+func (p *listenerProxy) NextDialer(dstAddr string) proxy.Dialer {
+	p.conns.Add(1)
+	return p.Proxy.NextDialerMeta(p.meta(nil), "", dstAddr)
+}
+
+// NextDialerMeta implements proxy.Proxy.
+func (p *listenerProxy) NextDialerMeta(meta *proxy.Metadata, network, dstAddr string) proxy.Dialer {
+	p.conns.Add(1)
+	return p.Proxy.NextDialerMeta(p.meta(meta), network, dstAddr)
+}
+
+// metricsWriter 按 Prometheus 文本格式输出监控指标
+type metricsWriter struct {
+	w io.Writer
+}
+
+// metric 输出指标的 HELP 和 TYPE 行
+func (m *metricsWriter) metric(name, typ, help string) {
+	fmt.Fprintf(m.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// sample 输出一个样本，labels 为 key, value 交替排列
+func (m *metricsWriter) sample(name string, value float64, labels ...string) {
+	io.WriteString(m.w, name)
+	if len(labels) > 0 {
+		io.WriteString(m.w, "{")
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				io.WriteString(m.w, ",")
+			}
+			io.WriteString(m.w, labels[i]+`="`+escapeLabel(labels[i+1])+`"`)
+		}
+		io.WriteString(m.w, "}")
+	}
+	io.WriteString(m.w, " "+strconv.FormatFloat(value, 'g', -1, 64)+"\n")
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// handleMetrics 处理 Prometheus 监控指标请求
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIResponse(w, http.StatusMethodNotAllowed, APIResponse{
+			Success: false,
+			Message: "Method not allowed, use GET",
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m := &metricsWriter{w: w}
+
+	m.metric("glider_build_info", "gauge", "Build information of glider.")
+	m.sample("glider_build_info", 1, "version", version)
+
+	writeForwarderMetrics(m)
+	writeListenerMetrics(m)
+
+	upload, download := proxy.RelayedBytes()
+	m.metric("glider_relay_bytes_total", "counter", "Total bytes relayed between clients and remote servers.")
+	m.sample("glider_relay_bytes_total", float64(upload), "direction", "upload")
+	m.sample("glider_relay_bytes_total", float64(download), "direction", "download")
+
+	m.metric("glider_active_connections", "gauge", "Number of connections being relayed.")
+	m.sample("glider_active_connections", float64(len(proxy.Connections())))
+
+	if d := apiManager.DNS(); d != nil {
+		stats := d.CacheStats()
+		m.metric("glider_dns_cache_hits_total", "counter", "Total dns queries answered from cache.")
+		m.sample("glider_dns_cache_hits_total", float64(stats.Hits))
+		m.metric("glider_dns_cache_misses_total", "counter", "Total dns queries not found in cache.")
+		m.sample("glider_dns_cache_misses_total", float64(stats.Misses))
+		m.metric("glider_dns_cache_entries", "gauge", "Number of entries in dns cache.")
+		m.sample("glider_dns_cache_entries", float64(stats.Entries))
+	}
+}
+
+// writeForwarderMetrics 输出所有转发器组中转发器的指标
+func writeForwarderMetrics(m *metricsWriter) {
+	type fwdrSample struct {
+		labels                  []string
+		enabled                 bool
+		priority, failures      uint32
+		latency                 int64
+		checkSuccess, checkFail uint64
+	}
+
+	var samples []fwdrSample
+	for _, g := range apiManager.Groups() {
+		// 同一组中可能有地址和标签都相同的转发器，用序号区分
+		for i, f := range g.GetForwarders() {
+			s := fwdrSample{
+				labels:   []string{"group", g.Name(), "index", strconv.Itoa(i), "forwarder", f.Addr(), "tag", f.Tag()},
+				enabled:  f.Enabled(),
+				priority: f.Priority(),
+				failures: f.Failures(),
+				latency:  f.Latency(),
+			}
+			s.checkSuccess, s.checkFail = f.CheckResults()
+			samples = append(samples, s)
+		}
+	}
+
+	m.metric("glider_forwarder_enabled", "gauge", "Whether the forwarder is enabled (1) or disabled (0).")
+	for _, s := range samples {
+		m.sample("glider_forwarder_enabled", boolValue(s.enabled), s.labels...)
+	}
+
+	m.metric("glider_forwarder_priority", "gauge", "Priority of the forwarder.")
+	for _, s := range samples {
+		m.sample("glider_forwarder_priority", float64(s.priority), s.labels...)
+	}
+
+	m.metric("glider_forwarder_latency_seconds", "gauge", "Average latency of the forwarder measured by health checks.")
+	for _, s := range samples {
+		m.sample("glider_forwarder_latency_seconds", time.Duration(s.latency).Seconds(), s.labels...)
+	}
+
+	m.metric("glider_forwarder_failures", "gauge", "Current consecutive failures of the forwarder.")
+	for _, s := range samples {
+		m.sample("glider_forwarder_failures", float64(s.failures), s.labels...)
+	}
+
+	m.metric("glider_forwarder_checks_total", "counter", "Total health checks of the forwarder by result.")
+	for _, s := range samples {
+		m.sample("glider_forwarder_checks_total", float64(s.checkSuccess), append(s.labels, "result", "success")...)
+		m.sample("glider_forwarder_checks_total", float64(s.checkFail), append(s.labels, "result", "failure")...)
+	}
+}
+
+// writeListenerMetrics 输出每个监听器的连接数
+func writeListenerMetrics(m *metricsWriter) {
+	listenersMu.Lock()
+	defer listenersMu.Unlock()
+
+	m.metric("glider_listener_connections_total", "counter", "Total connections handled by the listener.")
+	for _, l := range listeners {
+		m.sample("glider_listener_connections_total", float64(l.conns.Load()), "listener", l.name)
+	}
+}
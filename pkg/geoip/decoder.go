@@ -0,0 +1,210 @@
+package geoip
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/big"
+)
+
+// data field types.
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeFloat64
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEndMarker
+	typeBool
+	typeFloat32
+)
+
+// max nesting depth of maps, arrays and pointers.
+const maxDepth = 32
+
+var errOutOfRange = errors.New("data out of range")
+
+// decoder decodes the data section of the database.
+type decoder struct {
+	buf []byte
+}
+
+// bytes returns n bytes at offset.
+func (d decoder) bytes(offset, n int) ([]byte, error) {
+	if n < 0 || offset+n > len(d.buf) {
+		return nil, errOutOfRange
+	}
+	return d.buf[offset : offset+n], nil
+}
+
+// uintFrom decodes the big-endian unsigned integer in b.
+func uintFrom(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+// control decodes the control byte(s) at offset, returns the type and the size
+// of the field and the offset of its payload. For pointers, size is the pointer.
+func (d decoder) control(offset int) (typ, size, next int, err error) {
+	b, err := d.bytes(offset, 1)
+	if err != nil {
+		return
+	}
+	c, next := b[0], offset+1
+
+	typ = int(c >> 5)
+	if typ == typeExtended {
+		if b, err = d.bytes(next, 1); err != nil {
+			return
+		}
+		typ, next = 7+int(b[0]), next+1
+	}
+
+	if typ == typePointer {
+		n := int(c>>3&0x3) + 1
+		if b, err = d.bytes(next, n); err != nil {
+			return
+		}
+		next += n
+		switch n {
+		case 1:
+			size = int(c&0x7)<<8 | int(b[0])
+		case 2:
+			size = (int(c&0x7)<<16 | int(uintFrom(b))) + 2048
+		case 3:
+			size = (int(c&0x7)<<24 | int(uintFrom(b))) + 526336
+		default:
+			size = int(uintFrom(b))
+		}
+		return
+	}
+
+	size = int(c & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		if b, err = d.bytes(next, n); err != nil {
+			return
+		}
+		next += n
+		switch n {
+		case 1:
+			size = 29 + int(b[0])
+		case 2:
+			size = 285 + int(uintFrom(b))
+		default:
+			size = 65821 + int(uintFrom(b))
+		}
+	}
+	return
+}
+
+// decode decodes the field at offset, returns its value and the offset of the next field.
+func (d decoder) decode(offset, depth int) (any, int, error) {
+	if depth > maxDepth {
+		return nil, 0, errors.New("data nested too deep")
+	}
+
+	typ, size, next, err := d.control(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch typ {
+	case typePointer:
+		v, _, err := d.decode(size, depth+1)
+		return v, next, err
+
+	case typeMap:
+		m := make(map[string]any, min(size, 1024))
+		for range size {
+			var k, v any
+			if k, next, err = d.decode(next, depth+1); err != nil {
+				return nil, 0, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, 0, errors.New("map key is not a string")
+			}
+			if v, next, err = d.decode(next, depth+1); err != nil {
+				return nil, 0, err
+			}
+			m[key] = v
+		}
+		return m, next, nil
+
+	case typeArray:
+		a := make([]any, 0, min(size, 1024))
+		for range size {
+			var v any
+			if v, next, err = d.decode(next, depth+1); err != nil {
+				return nil, 0, err
+			}
+			a = append(a, v)
+		}
+		return a, next, nil
+
+	case typeBool:
+		return size != 0, next, nil
+	}
+
+	b, err := d.bytes(next, size)
+	if err != nil {
+		return nil, 0, err
+	}
+	next += size
+
+	switch typ {
+	case typeString:
+		return string(b), next, nil
+	case typeBytes:
+		return append([]byte(nil), b...), next, nil
+	case typeFloat64:
+		if size != 8 {
+			return nil, 0, errors.New("invalid double size")
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), next, nil
+	case typeFloat32:
+		if size != 4 {
+			return nil, 0, errors.New("invalid float size")
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(b)), next, nil
+	case typeUint16:
+		if size > 2 {
+			return nil, 0, errors.New("invalid uint16 size")
+		}
+		return uint16(uintFrom(b)), next, nil
+	case typeUint32:
+		if size > 4 {
+			return nil, 0, errors.New("invalid uint32 size")
+		}
+		return uint32(uintFrom(b)), next, nil
+	case typeInt32:
+		if size > 4 {
+			return nil, 0, errors.New("invalid int32 size")
+		}
+		return int32(uint32(uintFrom(b))), next, nil
+	case typeUint64:
+		if size > 8 {
+			return nil, 0, errors.New("invalid uint64 size")
+		}
+		return uintFrom(b), next, nil
+	case typeUint128:
+		if size > 16 {
+			return nil, 0, errors.New("invalid uint128 size")
+		}
+		return new(big.Int).SetBytes(b), next, nil
+	}
+
+	return nil, 0, errors.New("unsupported data type")
+}
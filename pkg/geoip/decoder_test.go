@@ -0,0 +1,165 @@
+package geoip
+
+import (
+	"bytes"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReaderRecord(t *testing.T) {
+	tests := []struct {
+		size        uint
+		node        []byte
+		left, right uint
+	}{
+		{24, []byte{0x01, 0x02, 0x03, 0xfe, 0xdc, 0xba}, 0x010203, 0xfedcba},
+		// the middle byte holds the high nibbles of the left and right records
+		{28, []byte{0x01, 0x02, 0x03, 0xa5, 0xfe, 0xdc, 0xba}, 0xa010203, 0x5fedcba},
+		{28, []byte{0xff, 0xff, 0xff, 0x0f, 0x00, 0x00, 0x01}, 0x0ffffff, 0xf000001},
+		{32, []byte{0x81, 0x02, 0x03, 0x04, 0xfe, 0xdc, 0xba, 0x98}, 0x81020304, 0xfedcba98},
+	}
+
+	for _, tt := range tests {
+		// the record of the second node
+		r := &Reader{meta: Metadata{RecordSize: tt.size, NodeCount: 2}}
+		r.tree = append(make([]byte, len(tt.node)), tt.node...)
+
+		if left, right := r.record(1, 0), r.record(1, 1); left != tt.left || right != tt.right {
+			t.Errorf("record size %d: record() = %#x, %#x, want %#x, %#x", tt.size, left, right, tt.left, tt.right)
+		}
+	}
+}
+
+// withField returns a data section with the field b at offset and a string
+// "target" right after it.
+func withField(offset int, b []byte) []byte {
+	buf := make([]byte, offset)
+	return append(append(buf, b...), 0x46, 't', 'a', 'r', 'g', 'e', 't')
+}
+
+func TestDecoderPointer(t *testing.T) {
+	tests := []struct {
+		name   string
+		field  []byte
+		target int
+	}{
+		{"size 1", []byte{0x21, 0x02}, 0x102},
+		{"size 2", []byte{0x29, 0x00, 0x10}, 0x10010 + 2048},
+		{"size 3", []byte{0x30, 0x00, 0x00, 0x05}, 0x05 + 526336},
+		{"size 4", []byte{0x38, 0x00, 0x00, 0x00, 0x10}, 0x10},
+		// the 3 low bits of the control byte are ignored for size 4
+		{"size 4 with value bits", []byte{0x3f, 0x00, 0x00, 0x00, 0x10}, 0x10},
+	}
+
+	for _, tt := range tests {
+		// the pointer at offset 0 points to a string at target
+		buf := make([]byte, tt.target+7)
+		copy(buf, tt.field)
+		copy(buf[tt.target:], []byte{0x46, 't', 'a', 'r', 'g', 'e', 't'})
+
+		v, next, err := decoder{buf}.decode(0, 0)
+		if err != nil || v != "target" || next != len(tt.field) {
+			t.Errorf("%s: decode() = %v, %d, %v, want target, %d", tt.name, v, next, err, len(tt.field))
+		}
+
+		// pointing out of the data section
+		if _, _, err := (decoder{buf[:tt.target]}).decode(0, 0); err == nil {
+			t.Errorf("%s: decode() of pointer out of range succeeded", tt.name)
+		}
+	}
+}
+
+func TestDecoderTypes(t *testing.T) {
+	long := strings.Repeat("x", 300)
+	huge := strings.Repeat("y", 70000)
+
+	tests := []struct {
+		name  string
+		field []byte
+		want  any
+	}{
+		{"string", []byte{0x43, 'a', 'b', 'c'}, "abc"},
+		{"empty string", []byte{0x40}, ""},
+		{"string size 29+", append([]byte{0x5d, 0x01}, strings.Repeat("s", 30)...), strings.Repeat("s", 30)},
+		{"string size 285+", append([]byte{0x5e, 0x00, 0x0f}, long...), long},
+		{"string size 65821+", append([]byte{0x5f, 0x00, 0x10, 0x53}, huge...), huge},
+		{"double", []byte{0x68, 0x40, 0x04, 0, 0, 0, 0, 0, 0}, 2.5},
+		{"bytes", []byte{0x82, 0x01, 0x02}, []byte{1, 2}},
+		{"uint16", []byte{0xa2, 0x01, 0x00}, uint16(256)},
+		{"uint16 zero", []byte{0xa0}, uint16(0)},
+		{"uint32", []byte{0xc3, 0x01, 0x11, 0x70}, uint32(70000)},
+		{"map", []byte{0xe2, 0x41, 'a', 0xa1, 0x01, 0x41, 'b', 0x41, 'c'}, map[string]any{"a": uint16(1), "b": "c"}},
+		// extended types
+		{"int32", []byte{0x04, 0x01, 0xff, 0xff, 0xff, 0xfb}, int32(-5)},
+		{"int32 short", []byte{0x01, 0x01, 0x05}, int32(5)},
+		{"uint64", []byte{0x05, 0x02, 0x01, 0x00, 0x00, 0x00, 0x00}, uint64(1) << 32},
+		{"array", []byte{0x02, 0x04, 0x43, 'a', 'b', 'c', 0xa1, 0x05}, []any{"abc", uint16(5)}},
+		{"empty array", []byte{0x00, 0x04}, []any{}},
+		{"bool true", []byte{0x01, 0x07}, true},
+		{"bool false", []byte{0x00, 0x07}, false},
+		{"float", []byte{0x04, 0x08, 0x3f, 0xc0, 0x00, 0x00}, float32(1.5)},
+	}
+
+	for _, tt := range tests {
+		for _, offset := range []int{0, 5} {
+			v, next, err := decoder{withField(offset, tt.field)}.decode(offset, 0)
+			if err != nil {
+				t.Errorf("%s: decode() error: %v", tt.name, err)
+				continue
+			}
+			if !reflect.DeepEqual(v, tt.want) {
+				t.Errorf("%s: decode() = %#v, want %#v", tt.name, v, tt.want)
+			}
+			if next != offset+len(tt.field) {
+				t.Errorf("%s: next = %d, want %d", tt.name, next, offset+len(tt.field))
+			}
+		}
+	}
+
+	v, _, err := decoder{[]byte{0x03, 0x03, 0x01, 0x00, 0x01}}.decode(0, 0)
+	if n, ok := v.(*big.Int); err != nil || !ok || n.Int64() != 0x10001 {
+		t.Errorf("uint128: decode() = %v, %v, want 65537", v, err)
+	}
+}
+
+func TestDecoderInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		field []byte
+	}{
+		{"empty", nil},
+		{"truncated extended type", []byte{0x01}},
+		{"truncated pointer", []byte{0x38, 0x00}},
+		{"truncated size", []byte{0x5f, 0x00}},
+		{"truncated string", []byte{0x45, 'a'}},
+		{"truncated map", []byte{0xe2, 0x41, 'a', 0x41, 'b'}},
+		{"truncated array", []byte{0x03, 0x04, 0x41, 'a'}},
+		{"non-string map key", []byte{0xe1, 0xa1, 0x01, 0x41, 'a'}},
+		{"invalid double", []byte{0x64, 0, 0, 0, 0}},
+		{"invalid float", []byte{0x08, 0x08, 0, 0, 0, 0, 0, 0, 0, 0}},
+		{"invalid uint16", []byte{0xa3, 0, 0, 1}},
+		{"invalid uint32", []byte{0xc5, 0, 0, 0, 0, 1}},
+		{"invalid int32", []byte{0x05, 0x01, 0, 0, 0, 0, 1}},
+		{"invalid uint64", []byte{0x09, 0x02, 0, 0, 0, 0, 0, 0, 0, 0, 1}},
+		{"invalid uint128", []byte{0x11, 0x03, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}},
+		{"container", []byte{0x00, 0x05}},
+		{"end marker", []byte{0x00, 0x06}},
+		{"unknown extended type", []byte{0x00, 0x20}},
+		{"pointer loop", []byte{0x20, 0x00}},
+		{"huge map", []byte{0xff, 0xff, 0xff, 0xff}},
+	}
+
+	for _, tt := range tests {
+		if v, _, err := (decoder{tt.field}).decode(0, 0); err == nil {
+			t.Errorf("%s: decode() = %#v, want error", tt.name, v)
+		}
+	}
+
+	// nested too deep
+	deep := bytes.Repeat([]byte{0x01, 0x04}, maxDepth+2)
+	if _, _, err := (decoder{deep}).decode(0, 0); err == nil {
+		t.Errorf("decode() of deeply nested arrays succeeded")
+	}
+}
@@ -0,0 +1,237 @@
+// Package geoip implements a reader of MaxMind DB (mmdb) files, which is
+// used to find the country of an ip address.
+//
+// The file format is described in https://maxmind.github.io/MaxMind-DB/
+package geoip
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"sync"
+)
+
+// metadataStart is the marker before the metadata section.
+var metadataStart = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// the metadata section is in the last 128KiB of the file.
+const metadataMaxSize = 128 * 1024
+
+// size of the zero bytes between the search tree and the data section.
+const dataSectionSeparator = 16
+
+// ErrInvalidDatabase is returned when the database file is corrupted.
+var ErrInvalidDatabase = errors.New("invalid mmdb database")
+
+// Metadata is the metadata of the database.
+type Metadata struct {
+	DatabaseType string
+	BuildEpoch   uint64
+	IPVersion    uint
+	NodeCount    uint
+	RecordSize   uint
+}
+
+// Reader is a reader of MaxMind DB files, it's safe for concurrent use.
+type Reader struct {
+	meta      Metadata
+	tree      []byte
+	data      decoder
+	ipv4Start uint
+
+	// cache of the country codes by data offset, there are only a few
+	// hundreds of different records in country databases.
+	countries sync.Map
+}
+
+// Open reads the database file at path.
+func Open(path string) (*Reader, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return FromBytes(b)
+}
+
+// FromBytes returns a reader of the database in b.
+func FromBytes(b []byte) (*Reader, error) {
+	from := max(len(b)-metadataMaxSize, 0)
+	i := bytes.LastIndex(b[from:], metadataStart)
+	if i == -1 {
+		return nil, fmt.Errorf("%w: metadata not found", ErrInvalidDatabase)
+	}
+	metaStart := from + i + len(metadataStart)
+
+	v, _, err := decoder{b[metaStart:]}.decode(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%w: metadata: %v", ErrInvalidDatabase, err)
+	}
+	m, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: metadata is not a map", ErrInvalidDatabase)
+	}
+
+	meta := Metadata{
+		DatabaseType: asString(m["database_type"]),
+		BuildEpoch:   asUint(m["build_epoch"]),
+		IPVersion:    uint(asUint(m["ip_version"])),
+		NodeCount:    uint(asUint(m["node_count"])),
+		RecordSize:   uint(asUint(m["record_size"])),
+	}
+
+	switch meta.RecordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("%w: unsupported record size %d", ErrInvalidDatabase, meta.RecordSize)
+	}
+	if meta.IPVersion != 4 && meta.IPVersion != 6 {
+		return nil, fmt.Errorf("%w: unsupported ip version %d", ErrInvalidDatabase, meta.IPVersion)
+	}
+
+	// a node takes at least 6 bytes, check it first to avoid overflow
+	if meta.NodeCount > uint(from+i)/6 {
+		return nil, fmt.Errorf("%w: search tree out of range", ErrInvalidDatabase)
+	}
+	treeSize := meta.NodeCount * meta.RecordSize / 4
+	if treeSize+dataSectionSeparator > uint(from+i) {
+		return nil, fmt.Errorf("%w: search tree out of range", ErrInvalidDatabase)
+	}
+
+	r := &Reader{
+		meta: meta,
+		tree: b[:treeSize],
+		data: decoder{b[treeSize+dataSectionSeparator : from+i]},
+	}
+
+	// ipv4 addresses are stored in ::/96 of ipv6 databases.
+	if meta.IPVersion == 6 {
+		for n := 0; n < 96 && r.ipv4Start < meta.NodeCount; n++ {
+			r.ipv4Start = r.record(r.ipv4Start, 0)
+		}
+	}
+
+	return r, nil
+}
+
+// Metadata returns the metadata of the database.
+func (r *Reader) Metadata() Metadata { return r.meta }
+
+// record returns the left(bit 0) or right(bit 1) record of node.
+func (r *Reader) record(node uint, bit byte) uint {
+	switch r.meta.RecordSize {
+	case 24:
+		b := r.tree[node*6+uint(bit)*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		b := r.tree[node*7:]
+		if bit == 0 {
+			return uint(b[3]&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		b := r.tree[node*8+uint(bit)*4:]
+		return uint(b[0])<<24 | uint(b[1])<<16 | uint(b[2])<<8 | uint(b[3])
+	}
+}
+
+// find returns the offset of the data record of ip in the data section.
+func (r *Reader) find(ip netip.Addr) (int, bool, error) {
+	ip = ip.Unmap()
+
+	var node uint
+	var addr []byte
+	switch {
+	case ip.Is4() && r.meta.IPVersion == 6:
+		a := ip.As4()
+		node, addr = r.ipv4Start, a[:]
+	case ip.Is4():
+		a := ip.As4()
+		addr = a[:]
+	case r.meta.IPVersion == 6:
+		a := ip.As16()
+		addr = a[:]
+	default:
+		return 0, false, nil
+	}
+
+	for i := 0; i < len(addr)*8 && node < r.meta.NodeCount; i++ {
+		node = r.record(node, addr[i>>3]>>(7-i&7)&1)
+	}
+
+	switch {
+	case node == r.meta.NodeCount:
+		return 0, false, nil
+	case node > r.meta.NodeCount:
+		offset := node - r.meta.NodeCount - dataSectionSeparator
+		if offset >= uint(len(r.data.buf)) {
+			return 0, false, fmt.Errorf("%w: data offset out of range", ErrInvalidDatabase)
+		}
+		return int(offset), true, nil
+	}
+
+	return 0, false, fmt.Errorf("%w: invalid node in search tree", ErrInvalidDatabase)
+}
+
+// Lookup returns the record of ip, it's nil when ip is not in the database.
+// Maps are decoded as map[string]any and arrays as []any.
+func (r *Reader) Lookup(ip netip.Addr) (any, error) {
+	offset, ok, err := r.find(ip)
+	if !ok || err != nil {
+		return nil, err
+	}
+	v, _, err := r.data.decode(offset, 0)
+	return v, err
+}
+
+// Country returns the ISO 3166-1 country code of ip in upper case,
+// it's empty when the country of ip is unknown.
+func (r *Reader) Country(ip netip.Addr) string {
+	offset, ok, err := r.find(ip)
+	if !ok || err != nil {
+		return ""
+	}
+
+	if code, ok := r.countries.Load(offset); ok {
+		return code.(string)
+	}
+
+	var code string
+	if v, _, err := r.data.decode(offset, 0); err == nil {
+		if m, ok := v.(map[string]any); ok {
+			code = isoCode(m["country"])
+			if code == "" {
+				code = isoCode(m["registered_country"])
+			}
+		}
+	}
+
+	r.countries.Store(offset, code)
+	return code
+}
+
+// isoCode returns the iso_code field of v.
+func isoCode(v any) string {
+	if m, ok := v.(map[string]any); ok {
+		return asString(m["iso_code"])
+	}
+	return ""
+}
+
+func asString(v any) string {
+	s, _ := v.(string)
+	return s
+}
+
+func asUint(v any) uint64 {
+	switch v := v.(type) {
+	case uint64:
+		return v
+	case uint32:
+		return uint64(v)
+	case uint16:
+		return uint64(v)
+	}
+	return 0
+}
@@ -0,0 +1,310 @@
+package geoip
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the test databases in testdata")
+
+// testNetworks are the networks in the test databases.
+var testNetworks = []testNetwork{
+	{"1.0.0.0/24", dmap{{"country", dmap{{"iso_code", "AU"}}}}},
+	{"1.0.1.0/24", dmap{{"country", dmap{{"iso_code", "CN"}}}}},
+	{"2.0.0.0/8", dmap{{"registered_country", dmap{{"iso_code", "FR"}}}}},
+	{"10.0.0.0/8", dmap{}},
+	{"81.2.69.0/24", dmap{
+		{"country", dmap{{"iso_code", "GB"}}},
+		{"registered_country", dmap{{"iso_code", "FR"}}},
+		{"extra", dmap{
+			{"uint64", uint64(1) << 40},
+			{"uint128", new(big.Int).Lsh(big.NewInt(1), 100)},
+			{"int32", int32(-5)},
+			{"bool", true},
+			{"float", float32(1.5)},
+			{"double", 2.5},
+			{"bytes", []byte{1, 2, 3}},
+			{"array", []any{"a", uint32(70000), uint16(0)}},
+		}},
+	}},
+	{"2001:db8::/32", dmap{{"country", dmap{{"iso_code", "US"}}}}},
+	{"2001:db9::/32", dmap{{"country", dmap{{"iso_code", "AU"}}}}},
+}
+
+// testDatabases are the test databases in testdata by file name.
+var testDatabases = map[string]testDB{
+	"test-ipv4-24.mmdb": {ipVersion: 4, recordSize: 24, networks: testNetworks[:5]},
+	"test-ipv6-24.mmdb": {ipVersion: 6, recordSize: 24, networks: testNetworks},
+	"test-ipv6-28.mmdb": {ipVersion: 6, recordSize: 28, networks: testNetworks},
+	"test-ipv6-32.mmdb": {ipVersion: 6, recordSize: 32, networks: testNetworks},
+}
+
+// openTestDB opens the test database in testdata, the file is rewritten with -update.
+func openTestDB(t *testing.T, name string) ([]byte, *Reader) {
+	t.Helper()
+
+	path := filepath.Join("testdata", name)
+	want := testDatabases[name].build()
+	if *update {
+		if err := os.WriteFile(path, want, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, want) {
+		t.Fatalf("%s is out of date, run go test -update", path)
+	}
+
+	r, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open(%s): %v", path, err)
+	}
+	return b, r
+}
+
+func TestReaderCountry(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{"1.0.0.1", "AU"},
+		{"1.0.0.255", "AU"},
+		{"1.0.1.1", "CN"},
+		{"1.0.2.1", ""},
+		{"2.200.3.4", "FR"}, // registered country only
+		{"10.1.2.3", ""},    // no country in record
+		{"81.2.69.160", "GB"},
+		{"127.0.0.1", ""},
+		{"::ffff:1.0.0.1", "AU"},
+		{"2001:db8::1", "US"},
+		{"2001:db9:ffff::1", "AU"},
+		{"2001:dba::1", ""},
+	}
+
+	for name, db := range testDatabases {
+		t.Run(name, func(t *testing.T) {
+			_, r := openTestDB(t, name)
+
+			m := r.Metadata()
+			if m.IPVersion != uint(db.ipVersion) || m.RecordSize != uint(db.recordSize) ||
+				m.DatabaseType != "Glider-Test" || m.BuildEpoch != 1700000000 {
+				t.Errorf("Metadata() = %+v", m)
+			}
+
+			for _, tt := range tests {
+				ip := netip.MustParseAddr(tt.ip)
+				want := tt.want
+				if db.ipVersion == 4 && ip.Is6() && !ip.Is4In6() {
+					want = ""
+				}
+				// twice to hit the cache
+				for range 2 {
+					if got := r.Country(ip); got != want {
+						t.Errorf("Country(%s) = %q, want %q", tt.ip, got, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestReaderIPv4Start(t *testing.T) {
+	_, r := openTestDB(t, "test-ipv6-24.mmdb")
+	if r.ipv4Start == 0 || r.ipv4Start >= r.meta.NodeCount {
+		t.Fatalf("ipv4Start = %d, want a node in the tree", r.ipv4Start)
+	}
+
+	// ipv4 addresses are looked up in ::/96, whatever form they are in
+	for _, s := range []string{"1.0.0.1", "::1.0.0.1", "::ffff:1.0.0.1"} {
+		if got := r.Country(netip.MustParseAddr(s)); got != "AU" {
+			t.Errorf("Country(%s) = %q, want AU", s, got)
+		}
+	}
+
+	// a database without ipv4 networks
+	b := testDB{ipVersion: 6, recordSize: 24, networks: testNetworks[5:]}.build()
+	r, err := FromBytes(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.ipv4Start < r.meta.NodeCount {
+		t.Errorf("ipv4Start = %d, want no node", r.ipv4Start)
+	}
+	if got := r.Country(netip.MustParseAddr("1.0.0.1")); got != "" {
+		t.Errorf("Country(1.0.0.1) = %q, want empty", got)
+	}
+}
+
+func TestReaderLookup(t *testing.T) {
+	for name := range testDatabases {
+		t.Run(name, func(t *testing.T) {
+			_, r := openTestDB(t, name)
+
+			v, err := r.Lookup(netip.MustParseAddr("81.2.69.1"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			m, _ := v.(map[string]any)
+			if isoCode(m["country"]) != "GB" || isoCode(m["registered_country"]) != "FR" {
+				t.Errorf("Lookup(81.2.69.1) = %v", v)
+			}
+
+			extra, _ := m["extra"].(map[string]any)
+			if n, ok := extra["uint128"].(*big.Int); !ok || n.Cmp(new(big.Int).Lsh(big.NewInt(1), 100)) != 0 {
+				t.Errorf("uint128 = %v", extra["uint128"])
+			}
+			delete(extra, "uint128")
+
+			want := map[string]any{
+				"uint64": uint64(1) << 40,
+				"int32":  int32(-5),
+				"bool":   true,
+				"float":  float32(1.5),
+				"double": 2.5,
+				"bytes":  []byte{1, 2, 3},
+				"array":  []any{"a", uint32(70000), uint16(0)},
+			}
+			if !reflect.DeepEqual(extra, want) {
+				t.Errorf("extra = %#v, want %#v", extra, want)
+			}
+
+			if v, err := r.Lookup(netip.MustParseAddr("127.0.0.1")); v != nil || err != nil {
+				t.Errorf("Lookup(127.0.0.1) = %v, %v, want nil", v, err)
+			}
+		})
+	}
+}
+
+func TestFromBytesInvalid(t *testing.T) {
+	networks := testNetworks[:1]
+	tests := []struct {
+		name string
+		db   []byte
+	}{
+		{"empty", nil},
+		{"no metadata", []byte("not a database")},
+		{"metadata not a map", append(bytes.Clone(metadataStart), 0x43, 'a', 'b', 'c')},
+		{"truncated metadata", append(bytes.Clone(metadataStart), 0xe9)},
+		{"record size", testDB{ipVersion: 6, recordSize: 24, networks: networks, meta: dmap{{"record_size", uint16(20)}}}.build()},
+		{"ip version", testDB{ipVersion: 6, recordSize: 24, networks: networks, meta: dmap{{"ip_version", uint16(5)}}}.build()},
+		{"node count", testDB{ipVersion: 6, recordSize: 24, networks: networks, meta: dmap{{"node_count", uint32(1 << 30)}}}.build()},
+		{"huge node count", testDB{ipVersion: 6, recordSize: 32, networks: networks, meta: dmap{{"node_count", uint64(1) << 62}}}.build()},
+	}
+
+	for _, tt := range tests {
+		if _, err := FromBytes(tt.db); !errors.Is(err, ErrInvalidDatabase) {
+			t.Errorf("%s: FromBytes() error = %v, want ErrInvalidDatabase", tt.name, err)
+		}
+	}
+}
+
+func TestReaderInvalidData(t *testing.T) {
+	tests := []struct {
+		name string
+		data any
+	}{
+		{"offset out of range", pointer(1000)},
+		{"truncated string", pointer(0)},
+		{"pointer loop", pointer(0)},
+		{"non-string map key", pointer(0)},
+		{"invalid double", pointer(0)},
+		{"unknown type", pointer(0)},
+	}
+	// data sections written by hand, used by the records pointing to offset 0
+	raw := map[string][]byte{
+		"truncated string":   {0x45, 'a', 'b'},
+		"pointer loop":       {0x20, 0x00},
+		"invalid double":     {0x64, 0, 0, 0, 0},
+		"unknown type":       {0x00, 0x09}, // extended type 16
+		"non-string map key": {0xe1, 0xa1, 0x01, 0x43, 'a', 'b', 'c'},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := testDB{ipVersion: 4, recordSize: 24, networks: []testNetwork{{"1.0.0.0/24", tt.data}}}.build()
+			if data, ok := raw[tt.name]; ok {
+				b = withData(t, b, data)
+			}
+
+			r, err := FromBytes(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ip := netip.MustParseAddr("1.0.0.1")
+			if v, err := r.Lookup(ip); err == nil {
+				t.Errorf("Lookup(1.0.0.1) = %v, want error", v)
+			}
+			if got := r.Country(ip); got != "" {
+				t.Errorf("Country(1.0.0.1) = %q, want empty", got)
+			}
+		})
+	}
+}
+
+// withData returns the database b with its data section replaced by data.
+func withData(t *testing.T, b, data []byte) []byte {
+	t.Helper()
+	r, err := FromBytes(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := len(r.tree) + dataSectionSeparator
+	meta := bytes.LastIndex(b, metadataStart)
+	return slices.Concat(b[:start], data, b[meta:])
+}
+
+func TestFromBytesTruncated(t *testing.T) {
+	for name := range testDatabases {
+		b, _ := openTestDB(t, name)
+
+		// no truncated or corrupted database panics
+		for n := range len(b) {
+			for _, db := range [][]byte{b[:n], corrupt(b, n)} {
+				r, err := FromBytes(db)
+				if err != nil {
+					continue
+				}
+				for _, s := range []string{"1.0.0.1", "2.1.1.1", "81.2.69.1", "2001:db8::1"} {
+					ip := netip.MustParseAddr(s)
+					r.Country(ip)
+					r.Lookup(ip)
+				}
+			}
+		}
+
+		// the metadata is at the end of the file
+		if _, err := FromBytes(b[:len(b)-1]); err == nil {
+			t.Errorf("%s: FromBytes() of truncated database succeeded", name)
+		}
+	}
+}
+
+// corrupt returns a copy of b with the byte at i flipped.
+func corrupt(b []byte, i int) []byte {
+	c := bytes.Clone(b)
+	c[i] ^= 0xFF
+	return c
+}
+
+func ExampleReader_Country() {
+	r, err := Open("testdata/test-ipv6-24.mmdb")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(r.Country(netip.MustParseAddr("81.2.69.160")))
+	// Output: GB
+}
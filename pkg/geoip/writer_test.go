@@ -0,0 +1,274 @@
+package geoip
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/big"
+	"net/netip"
+)
+
+// This file implements a minimal mmdb writer to synthesize the test databases.
+
+// kv is a map entry, maps are written as ordered entries to make the output stable.
+type kv struct {
+	key   string
+	value any
+}
+
+// dmap is a map in the data section.
+type dmap []kv
+
+// pointer is a pointer to the offset in the data section, written as is.
+type pointer int
+
+// testNetwork is a network and its data record.
+type testNetwork struct {
+	prefix string
+	data   any
+}
+
+// testDB describes a database to write.
+type testDB struct {
+	ipVersion  int
+	recordSize int
+	networks   []testNetwork
+	// metadata fields overriding the generated ones
+	meta dmap
+}
+
+// writer writes the data section, equal maps are written once and referenced by pointers.
+type writer struct {
+	buf   []byte
+	cache map[string]int
+}
+
+// control appends the control byte(s) of a field.
+func (w *writer) control(typ, size int) {
+	var ext []byte
+	c := byte(typ << 5)
+	if typ > 7 {
+		c, ext = 0, []byte{byte(typ - 7)}
+	}
+
+	switch {
+	case size < 29:
+		w.buf = append(w.buf, c|byte(size))
+		w.buf = append(w.buf, ext...)
+	case size < 285:
+		w.buf = append(w.buf, c|29)
+		w.buf = append(w.buf, ext...)
+		w.buf = append(w.buf, byte(size-29))
+	case size < 65821:
+		w.buf = append(w.buf, c|30)
+		w.buf = append(w.buf, ext...)
+		w.buf = binary.BigEndian.AppendUint16(w.buf, uint16(size-285))
+	default:
+		size -= 65821
+		w.buf = append(w.buf, c|31)
+		w.buf = append(w.buf, ext...)
+		w.buf = append(w.buf, byte(size>>16), byte(size>>8), byte(size))
+	}
+}
+
+// pointer appends a pointer with the smallest size.
+func (w *writer) pointer(p int) {
+	switch {
+	case p < 2048:
+		w.buf = append(w.buf, 0x20|byte(p>>8), byte(p))
+	case p < 526336:
+		p -= 2048
+		w.buf = append(w.buf, 0x28|byte(p>>16), byte(p>>8), byte(p))
+	case p < 134744064:
+		p -= 526336
+		w.buf = append(w.buf, 0x30|byte(p>>24), byte(p>>16), byte(p>>8), byte(p))
+	default:
+		w.buf = append(w.buf, 0x38)
+		w.buf = binary.BigEndian.AppendUint32(w.buf, uint32(p))
+	}
+}
+
+// uint appends an unsigned integer without leading zeros.
+func (w *writer) uint(typ int, v uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	i := 0
+	for i < 8 && b[i] == 0 {
+		i++
+	}
+	w.control(typ, 8-i)
+	w.buf = append(w.buf, b[i:]...)
+}
+
+// write appends v, nested maps already written are replaced by pointers.
+func (w *writer) write(v any, nested bool) {
+	if m, ok := v.(dmap); ok && nested {
+		key := fmt.Sprint(m)
+		if offset, ok := w.cache[key]; ok {
+			w.pointer(offset)
+			return
+		}
+		w.cache[key] = len(w.buf)
+	}
+
+	switch v := v.(type) {
+	case pointer:
+		w.pointer(int(v))
+	case string:
+		w.control(typeString, len(v))
+		w.buf = append(w.buf, v...)
+	case []byte:
+		w.control(typeBytes, len(v))
+		w.buf = append(w.buf, v...)
+	case float64:
+		w.control(typeFloat64, 8)
+		w.buf = binary.BigEndian.AppendUint64(w.buf, math.Float64bits(v))
+	case float32:
+		w.control(typeFloat32, 4)
+		w.buf = binary.BigEndian.AppendUint32(w.buf, math.Float32bits(v))
+	case uint16:
+		w.uint(typeUint16, uint64(v))
+	case uint32:
+		w.uint(typeUint32, uint64(v))
+	case uint64:
+		w.uint(typeUint64, v)
+	case int32:
+		w.control(typeInt32, 4)
+		w.buf = binary.BigEndian.AppendUint32(w.buf, uint32(v))
+	case *big.Int:
+		b := v.Bytes()
+		w.control(typeUint128, len(b))
+		w.buf = append(w.buf, b...)
+	case bool:
+		size := 0
+		if v {
+			size = 1
+		}
+		w.control(typeBool, size)
+	case dmap:
+		w.control(typeMap, len(v))
+		for _, e := range v {
+			w.write(e.key, true)
+			w.write(e.value, true)
+		}
+	case []any:
+		w.control(typeArray, len(v))
+		for _, e := range v {
+			w.write(e, true)
+		}
+	default:
+		panic(fmt.Sprintf("unsupported type %T", v))
+	}
+}
+
+// node is a node of the search tree, a child is a *node, a data offset(int) or nil.
+type node struct {
+	children [2]any
+}
+
+// insert inserts the network of addr with prefix bits.
+func (n *node) insert(addr []byte, bits int, offset int) {
+	for i := 0; ; i++ {
+		bit := addr[i>>3] >> (7 - i&7) & 1
+		if i == bits-1 {
+			n.children[bit] = offset
+			return
+		}
+		child, ok := n.children[bit].(*node)
+		if !ok {
+			child = &node{}
+			n.children[bit] = child
+		}
+		n = child
+	}
+}
+
+// build returns the database file.
+func (db testDB) build() []byte {
+	root := &node{}
+	w := &writer{cache: make(map[string]int)}
+
+	for _, n := range db.networks {
+		prefix := netip.MustParsePrefix(n.prefix)
+		addr, bits := prefix.Addr().AsSlice(), prefix.Bits()
+		if db.ipVersion == 6 && prefix.Addr().Is4() {
+			addr, bits = append(make([]byte, 12), addr...), bits+96
+		}
+
+		offset := len(w.buf)
+		if p, ok := n.data.(pointer); ok {
+			// the record points to the offset directly
+			offset = int(p)
+		} else {
+			w.write(n.data, false)
+		}
+		root.insert(addr, bits, offset)
+	}
+
+	// number the nodes in breadth first order
+	nodes := []*node{root}
+	index := map[*node]int{root: 0}
+	for i := 0; i < len(nodes); i++ {
+		for _, c := range nodes[i].children {
+			if c, ok := c.(*node); ok {
+				index[c] = len(nodes)
+				nodes = append(nodes, c)
+			}
+		}
+	}
+
+	count := len(nodes)
+	var tree []byte
+	for _, n := range nodes {
+		var rec [2]uint32
+		for i, c := range n.children {
+			switch c := c.(type) {
+			case *node:
+				rec[i] = uint32(index[c])
+			case int:
+				rec[i] = uint32(count + dataSectionSeparator + c)
+			default:
+				rec[i] = uint32(count)
+			}
+		}
+
+		switch db.recordSize {
+		case 24:
+			tree = append(tree, byte(rec[0]>>16), byte(rec[0]>>8), byte(rec[0]),
+				byte(rec[1]>>16), byte(rec[1]>>8), byte(rec[1]))
+		case 28:
+			tree = append(tree, byte(rec[0]>>16), byte(rec[0]>>8), byte(rec[0]),
+				byte(rec[0]>>24<<4)|byte(rec[1]>>24&0x0F),
+				byte(rec[1]>>16), byte(rec[1]>>8), byte(rec[1]))
+		default:
+			tree = binary.BigEndian.AppendUint32(tree, rec[0])
+			tree = binary.BigEndian.AppendUint32(tree, rec[1])
+		}
+	}
+
+	meta := dmap{
+		{"binary_format_major_version", uint16(2)},
+		{"binary_format_minor_version", uint16(0)},
+		{"build_epoch", uint64(1700000000)},
+		{"database_type", "Glider-Test"},
+		{"description", dmap{{"en", "glider test database"}}},
+		{"ip_version", uint16(db.ipVersion)},
+		{"languages", []any{"en"}},
+		{"node_count", uint32(count)},
+		{"record_size", uint16(db.recordSize)},
+	}
+	for _, e := range db.meta {
+		for i := range meta {
+			if meta[i].key == e.key {
+				meta[i].value = e.value
+			}
+		}
+	}
+	mw := &writer{cache: make(map[string]int)}
+	mw.write(meta, false)
+
+	b := append(tree, make([]byte, dataSectionSeparator)...)
+	b = append(b, w.buf...)
+	b = append(b, metadataStart...)
+	return append(b, mw.buf...)
+}
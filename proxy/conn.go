@@ -8,6 +8,7 @@ import (
 	"os"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/nadoo/glider/pkg/pool"
@@ -21,6 +22,14 @@ var (
 	UDPBufSize = 2 << 10
 )
 
+var uploadBytes, downloadBytes atomic.Uint64
+
+// RelayedBytes returns the total bytes relayed by Relay and TrackRelay,
+// upload is from client to remote, download is from remote to client.
+func RelayedBytes() (upload, download uint64) {
+	return uploadBytes.Load(), downloadBytes.Load()
+}
+
 // Conn is a connection with buffered reader.
 type Conn struct {
 	r *bufio.Reader
@@ -53,19 +62,46 @@ func (c *Conn) Close() error {
 
 // Relay relays between left and right.
 func Relay(left, right net.Conn) error {
-	var err, err1 error
+	return relay(left, right, nil)
+}
+
+// relay relays between left and right, the bytes are counted to conn if it's
+// not nil. They are counted while relaying if live counting is enabled by
+// CountBytes, otherwise when relay finished so the fast paths of Copy are kept.
+func relay(left, right net.Conn, conn *Connection) error {
+	var err1 error
 	var wg sync.WaitGroup
 	var wait = 5 * time.Second
 
+	live := conn != nil && countBytes.Load()
+	upload := func(n int64) { uploadBytes.Add(uint64(n)) }
+	download := func(n int64) { downloadBytes.Add(uint64(n)) }
+	if conn != nil {
+		upload, download = conn.AddUpload, conn.AddDownload
+	}
+
+	var up, down io.Writer = right, left
+	if live {
+		up = &countWriter{right, upload}
+		down = &countWriter{left, download}
+	}
+
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		_, err1 = Copy(right, left)
-		right.SetReadDeadline(time.Now().Add(wait)) // unblock read on right
+		n, err := Copy(up, left)
+		if !live {
+			upload(n)
+		}
+		err1 = err
+		conn.unblock(right, wait) // unblock read on right
 	}()
 
-	_, err = Copy(left, right)
-	left.SetReadDeadline(time.Now().Add(wait)) // unblock read on left
+	n, err := Copy(down, right)
+	if !live {
+		download(n)
+	}
+	conn.unblock(left, wait) // unblock read on left
 	wg.Wait()
 
 	if err1 != nil && !errors.Is(err1, os.ErrDeadlineExceeded) {
@@ -79,6 +115,18 @@ func Relay(left, right net.Conn) error {
 	return nil
 }
 
+// countWriter calls count with the bytes written to the writer.
+type countWriter struct {
+	io.Writer
+	count func(int64)
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	w.count(int64(n))
+	return n, err
+}
+
 // Copy copies from src to dst.
 func Copy(dst io.Writer, src io.Reader) (written int64, err error) {
 	dst = underlyingWriter(dst)
@@ -23,6 +23,8 @@ type HTTP struct {
 	user     string
 	password string
 	pretend  bool
+
+	listeners proxy.Listeners
 }
 
 func init() {
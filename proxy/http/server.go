@@ -27,11 +27,18 @@ func (s *HTTP) ListenAndServe() {
 	}
 	defer l.Close()
 
+	if !s.listeners.Add(l) {
+		return
+	}
+
 	log.F("[http] listening TCP on %s", s.addr)
 
 	for {
 		c, err := l.Accept()
 		if err != nil {
+			if s.listeners.Closed() {
+				return
+			}
 			log.F("[http] failed to accept: %v", err)
 			continue
 		}
@@ -40,6 +47,11 @@ func (s *HTTP) ListenAndServe() {
 	}
 }
 
+// Close stops listening, connections being served are not affected.
+func (s *HTTP) Close() error {
+	return s.listeners.Close()
+}
+
 // Serve serves a connection.
 func (s *HTTP) Serve(cc net.Conn) {
 	if c, ok := cc.(*net.TCPConn); ok {
@@ -66,24 +78,26 @@ func (s *HTTP) Serve(cc net.Conn) {
 
 func (s *HTTP) servRequest(req *request, c *proxy.Conn) {
 	// Auth
+	user, pass, ok := extractUserPass(req.auth)
 	if s.user != "" && s.password != "" {
-		if user, pass, ok := extractUserPass(req.auth); !ok || user != s.user || pass != s.password {
+		if name, _ := proxy.SplitUser(user); !ok || name != s.user || pass != s.password {
 			io.WriteString(c, "HTTP/1.1 407 Proxy Authentication Required\r\nProxy-Authenticate: Basic\r\n\r\n")
 			log.F("[http] auth failed from %s, auth info: %s:%s", c.RemoteAddr(), user, pass)
 			return
 		}
 	}
 
+	meta := &proxy.Metadata{User: user, SrcAddr: c.RemoteAddr()}
 	if req.method == "CONNECT" {
-		s.servHTTPS(req, c)
+		s.servHTTPS(req, c, meta)
 		return
 	}
 
-	s.servHTTP(req, c)
+	s.servHTTP(req, c, meta)
 }
 
-func (s *HTTP) servHTTPS(r *request, c net.Conn) {
-	rc, dialer, err := s.proxy.Dial("tcp", r.uri)
+func (s *HTTP) servHTTPS(r *request, c net.Conn, meta *proxy.Metadata) {
+	rc, dialer, err := s.proxy.DialMeta(meta, "tcp", r.uri)
 	if err != nil {
 		io.WriteString(c, r.proto+" 502 ERROR\r\n\r\n")
 		log.F("[http] %s <-> %s [c] via %s, error in dial: %v", c.RemoteAddr(), r.uri, dialer.Addr(), err)
@@ -95,7 +109,7 @@ func (s *HTTP) servHTTPS(r *request, c net.Conn) {
 
 	log.F("[http] %s <-> %s [c] via %s", c.RemoteAddr(), r.uri, dialer.Addr())
 
-	if err = proxy.Relay(c, rc); err != nil {
+	if err = proxy.TrackRelay("tcp", c, rc, r.uri, dialer.Addr()); err != nil {
 		log.F("[http] %s <-> %s via %s, relay error: %v", c.RemoteAddr(), r.uri, dialer.Addr(), err)
 		// record remote conn failure only
 		if !strings.Contains(err.Error(), s.addr) {
@@ -104,8 +118,8 @@ func (s *HTTP) servHTTPS(r *request, c net.Conn) {
 	}
 }
 
-func (s *HTTP) servHTTP(req *request, c *proxy.Conn) {
-	rc, dialer, err := s.proxy.Dial("tcp", req.target)
+func (s *HTTP) servHTTP(req *request, c *proxy.Conn, meta *proxy.Metadata) {
+	rc, dialer, err := s.proxy.DialMeta(meta, "tcp", req.target)
 	if err != nil {
 		fmt.Fprintf(c, "%s 502 ERROR\r\n\r\n", req.proto)
 		log.F("[http] %s <-> %s via %s, error in dial: %v", c.RemoteAddr(), req.target, dialer.Addr(), err)
@@ -118,15 +132,20 @@ func (s *HTTP) servHTTP(req *request, c *proxy.Conn) {
 
 	// send request to remote server
 	req.WriteBuf(buf)
-	_, err = rc.Write(buf.Bytes())
+	n, err := rc.Write(buf.Bytes())
 	if err != nil {
 		return
 	}
 
+	conn := proxy.Track("tcp", c, rc, req.target, dialer.Addr())
+	defer conn.Untrack()
+	conn.AddUpload(int64(n))
+
 	// copy the left request bytes to remote server. eg. length specificed or chunked body.
 	go func() {
 		if _, err := c.Reader().Peek(1); err == nil {
-			proxy.Copy(rc, c)
+			n, _ := proxy.Copy(rc, c)
+			conn.AddUpload(n)
 			rc.SetDeadline(time.Now())
 			c.SetDeadline(time.Now())
 		}
@@ -160,7 +179,9 @@ func (s *HTTP) servHTTP(req *request, c *proxy.Conn) {
 	writeHeaders(buf, header)
 
 	log.F("[http] %s <-> %s via %s", c.RemoteAddr(), req.target, dialer.Addr())
-	c.Write(buf.Bytes())
+	n, _ = c.Write(buf.Bytes())
+	conn.AddDownload(int64(n))
 
-	proxy.Copy(c, r)
+	written, _ := proxy.Copy(c, r)
+	conn.AddDownload(written)
 }
@@ -31,6 +31,8 @@ type KCP struct {
 	parityShards int
 
 	server proxy.Server
+
+	listeners proxy.Listeners
 }
 
 func init() {
@@ -168,11 +170,18 @@ func (s *KCP) ListenAndServe() {
 	}
 	defer l.Close()
 
+	if !s.listeners.Add(l) {
+		return
+	}
+
 	log.F("[kcp] listening on %s", s.addr)
 
 	for {
 		c, err := l.AcceptKCP()
 		if err != nil {
+			if s.listeners.Closed() {
+				return
+			}
 			log.F("[kcp] failed to accept: %v", err)
 			continue
 		}
@@ -183,6 +192,11 @@ func (s *KCP) ListenAndServe() {
 	}
 }
 
+// Close stops listening, connections being served are not affected.
+func (s *KCP) Close() error {
+	return s.listeners.Close()
+}
+
 // Serve serves connections.
 func (s *KCP) Serve(c net.Conn) {
 	if s.server != nil {
@@ -192,7 +206,7 @@ func (s *KCP) Serve(c net.Conn) {
 
 	defer c.Close()
 
-	rc, dialer, err := s.proxy.Dial("tcp", "")
+	rc, dialer, err := s.proxy.DialMeta(&proxy.Metadata{SrcAddr: c.RemoteAddr()}, "tcp", "")
 	if err != nil {
 		log.F("[kcp] %s <-> %s via %s, error in dial: %v", c.RemoteAddr(), s.addr, dialer.Addr(), err)
 		s.proxy.Record(dialer, false)
@@ -203,7 +217,7 @@ func (s *KCP) Serve(c net.Conn) {
 
 	log.F("[kcp] %s <-> %s", c.RemoteAddr(), dialer.Addr())
 
-	if err = proxy.Relay(c, rc); err != nil {
+	if err = proxy.TrackRelay("tcp", c, rc, rc.RemoteAddr().String(), dialer.Addr()); err != nil {
 		log.F("[kcp] %s <-> %s, relay error: %v", c.RemoteAddr(), dialer.Addr(), err)
 		// record remote conn failure only
 		if !strings.Contains(err.Error(), s.addr) {
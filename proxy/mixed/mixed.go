@@ -1,6 +1,7 @@
 package mixed
 
 import (
+	"errors"
 	"net"
 	"net/url"
 
@@ -17,6 +18,8 @@ type Mixed struct {
 
 	httpServer   *http.HTTP
 	socks5Server *socks5.Socks5
+
+	listeners proxy.Listeners
 }
 
 func init() {
@@ -64,11 +67,18 @@ func (m *Mixed) ListenAndServe() {
 		return
 	}
 
+	if !m.listeners.Add(l) {
+		return
+	}
+
 	log.F("[mixed] http & socks5 server listening TCP on %s", m.addr)
 
 	for {
 		c, err := l.Accept()
 		if err != nil {
+			if m.listeners.Closed() {
+				return
+			}
 			log.F("[mixed] failed to accept: %v", err)
 			continue
 		}
@@ -77,6 +87,11 @@ func (m *Mixed) ListenAndServe() {
 	}
 }
 
+// Close stops listening, connections being served are not affected.
+func (m *Mixed) Close() error {
+	return errors.Join(m.listeners.Close(), m.socks5Server.Close())
+}
+
 // Serve serves connections.
 func (m *Mixed) Serve(c net.Conn) {
 	conn := proxy.NewConn(c)
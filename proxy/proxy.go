@@ -10,16 +10,51 @@ type Proxy interface {
 	// Dial connects to the given address via the proxy.
 	Dial(network, addr string) (c net.Conn, dialer Dialer, err error)
 
+	// DialMeta connects to the given address via the proxy, the dialer is
+	// chosen with the metadata of the client request.
+	DialMeta(meta *Metadata, network, addr string) (c net.Conn, dialer Dialer, err error)
+
 	// DialUDP connects to the given address via the proxy.
 	DialUDP(network, addr string) (pc net.PacketConn, dialer UDPDialer, err error)
 
+	// DialUDPMeta connects to the given address via the proxy, the dialer is
+	// chosen with the metadata of the client request.
+	DialUDPMeta(meta *Metadata, network, addr string) (pc net.PacketConn, dialer UDPDialer, err error)
+
 	// Get the dialer by dstAddr.
 	NextDialer(dstAddr string) Dialer
 
+	// NextDialerMeta gets the dialer by dstAddr and the metadata of the client
+	// request, network is the network the dialer will be used to dial.
+	NextDialerMeta(meta *Metadata, network, dstAddr string) Dialer
+
 	// Record records result while using the dialer from proxy.
 	Record(dialer Dialer, success bool)
 }
 
+// Metadata is the information of a client request.
+type Metadata struct {
+	// User is the username authenticated by the server, it may carry a
+	// session id in the form of USER-session-ID.
+	User string
+
+	// SrcAddr is the address of the client, it may be nil.
+	SrcAddr net.Addr
+
+	// Listener is the name of the listener which accepted the request.
+	Listener string
+}
+
+// sessionSep separates the username and the session id.
+const sessionSep = "-session-"
+
+// SplitUser splits user in the form of USER-session-ID to the username and
+// the session id, session is empty if user does not carry a session id.
+func SplitUser(user string) (name, session string) {
+	name, session, _ = strings.Cut(user, sessionSep)
+	return
+}
+
 var (
 	msg    strings.Builder
 	usages = make(map[string]string)
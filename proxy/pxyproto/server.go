@@ -20,6 +20,8 @@ type PxyProtoServer struct {
 	addr   string
 	proxy  proxy.Proxy
 	server proxy.Server
+
+	listeners proxy.Listeners
 }
 
 // NewPxyProtoServer returns a PxyProtoServer struct.
@@ -53,11 +55,18 @@ func (s *PxyProtoServer) ListenAndServe() {
 	}
 	defer l.Close()
 
+	if !s.listeners.Add(l) {
+		return
+	}
+
 	log.F("[pxyproto] listening TCP on %s", s.addr)
 
 	for {
 		c, err := l.Accept()
 		if err != nil {
+			if s.listeners.Closed() {
+				return
+			}
 			log.F("[pxyproto] failed to accept: %v", err)
 			continue
 		}
@@ -66,6 +75,11 @@ func (s *PxyProtoServer) ListenAndServe() {
 	}
 }
 
+// Close stops listening, connections being served are not affected.
+func (s *PxyProtoServer) Close() error {
+	return s.listeners.Close()
+}
+
 // Serve serves a connection.
 func (s *PxyProtoServer) Serve(cc net.Conn) {
 	c, err := newServerConn(cc)
@@ -17,6 +17,8 @@ type RedirProxy struct {
 	proxy proxy.Proxy
 	addr  string
 	ipv6  bool
+
+	listeners proxy.Listeners
 }
 
 func init() {
@@ -60,11 +62,18 @@ func (s *RedirProxy) ListenAndServe() {
 		return
 	}
 
+	if !s.listeners.Add(l) {
+		return
+	}
+
 	log.F("[redir] listening TCP on %s", s.addr)
 
 	for {
 		c, err := l.Accept()
 		if err != nil {
+			if s.listeners.Closed() {
+				return
+			}
 			log.F("[redir] failed to accept: %v", err)
 			continue
 		}
@@ -73,6 +82,11 @@ func (s *RedirProxy) ListenAndServe() {
 	}
 }
 
+// Close stops listening, connections being served are not affected.
+func (s *RedirProxy) Close() error {
+	return s.listeners.Close()
+}
+
 // Serve serves connections.
 func (s *RedirProxy) Serve(cc net.Conn) {
 	defer cc.Close()
@@ -97,7 +111,7 @@ func (s *RedirProxy) Serve(cc net.Conn) {
 		return
 	}
 
-	rc, dialer, err := s.proxy.Dial("tcp", tgt)
+	rc, dialer, err := s.proxy.DialMeta(&proxy.Metadata{SrcAddr: c.RemoteAddr()}, "tcp", tgt)
 	if err != nil {
 		log.F("[redir] %s <-> %s via %s, error in dial: %v", c.RemoteAddr(), tgt, dialer.Addr(), err)
 		return
@@ -106,7 +120,7 @@ func (s *RedirProxy) Serve(cc net.Conn) {
 
 	log.F("[redir] %s <-> %s via %s", c.RemoteAddr(), tgt, dialer.Addr())
 
-	if err = proxy.Relay(c, rc); err != nil {
+	if err = proxy.TrackRelay("tcp", c, rc, tgt, dialer.Addr()); err != nil {
 		log.F("[redir] %s <-> %s via %s, relay error: %v", c.RemoteAddr(), tgt, dialer.Addr(), err)
 		// record remote conn failure only
 		if !strings.Contains(err.Error(), s.addr) {
@@ -2,9 +2,11 @@ package proxy
 
 import (
 	"errors"
+	"io"
 	"net"
 	"sort"
 	"strings"
+	"sync"
 )
 
 // Server interface.
@@ -14,6 +16,9 @@ type Server interface {
 
 	// Serve serves a connection
 	Serve(c net.Conn)
+
+	// Close stops listening, connections being served are not affected
+	Close() error
 }
 
 // PacketServer interface.
@@ -21,6 +26,52 @@ type PacketServer interface {
 	ServePacket(pc net.PacketConn)
 }
 
+// Listeners holds the listeners of a server so that they can be closed
+// from another goroutine.
+type Listeners struct {
+	mu     sync.Mutex
+	closed bool
+	ls     []io.Closer
+}
+
+// Add adds a listener, it closes l and returns false if Close has been called.
+func (s *Listeners) Add(l io.Closer) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		l.Close()
+		return false
+	}
+	s.ls = append(s.ls, l)
+	return true
+}
+
+// Closed reports whether Close has been called.
+func (s *Listeners) Closed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// Close closes all the listeners.
+func (s *Listeners) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+
+	var errs []error
+	for _, l := range s.ls {
+		if err := l.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	s.ls = nil
+
+	return errors.Join(errs...)
+}
+
 // ServerCreator is a function to create proxy servers.
 type ServerCreator func(s string, proxy Proxy) (Server, error)
 
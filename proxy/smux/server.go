@@ -15,6 +15,8 @@ type SmuxServer struct {
 	proxy  proxy.Proxy
 	addr   string
 	server proxy.Server
+
+	listeners proxy.Listeners
 }
 
 func init() {
@@ -54,11 +56,18 @@ func (s *SmuxServer) ListenAndServe() {
 	}
 	defer l.Close()
 
+	if !s.listeners.Add(l) {
+		return
+	}
+
 	log.F("[smux] listening mux on %s", s.addr)
 
 	for {
 		c, err := l.Accept()
 		if err != nil {
+			if s.listeners.Closed() {
+				return
+			}
 			log.F("[smux] failed to accept: %v", err)
 			continue
 		}
@@ -67,6 +76,11 @@ func (s *SmuxServer) ListenAndServe() {
 	}
 }
 
+// Close stops listening, connections being served are not affected.
+func (s *SmuxServer) Close() error {
+	return s.listeners.Close()
+}
+
 // Serve serves a connection.
 func (s *SmuxServer) Serve(c net.Conn) {
 	// we know the internal server will close the connection after serve
@@ -98,7 +112,7 @@ func (s *SmuxServer) ServeStream(c *smux.Stream) {
 
 	defer c.Close()
 
-	rc, dialer, err := s.proxy.Dial("tcp", "")
+	rc, dialer, err := s.proxy.DialMeta(&proxy.Metadata{SrcAddr: c.RemoteAddr()}, "tcp", "")
 	if err != nil {
 		log.F("[smux] %s <-> %s via %s, error in dial: %v", c.RemoteAddr(), s.addr, dialer.Addr(), err)
 		s.proxy.Record(dialer, false)
@@ -108,7 +122,7 @@ func (s *SmuxServer) ServeStream(c *smux.Stream) {
 
 	log.F("[smux] %s <-> %s", c.RemoteAddr(), dialer.Addr())
 
-	if err = proxy.Relay(c, rc); err != nil {
+	if err = proxy.TrackRelay("tcp", c, rc, rc.RemoteAddr().String(), dialer.Addr()); err != nil {
 		log.F("[smux] %s <-> %s, relay error: %v", c.RemoteAddr(), dialer.Addr(), err)
 		// record remote conn failure only
 		if !strings.Contains(err.Error(), s.addr) {
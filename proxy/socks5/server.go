@@ -4,6 +4,7 @@ import (
 	"errors"
 	"io"
 	"net"
+	"net/netip"
 	"strings"
 	"sync"
 	"time"
@@ -31,6 +32,11 @@ func (s *Socks5) ListenAndServe() {
 	s.ListenAndServeTCP()
 }
 
+// Close stops listening, connections being served are not affected.
+func (s *Socks5) Close() error {
+	return s.listeners.Close()
+}
+
 // ListenAndServeTCP listen and serve on tcp port.
 func (s *Socks5) ListenAndServeTCP() {
 	l, err := net.Listen("tcp", s.addr)
@@ -39,11 +45,18 @@ func (s *Socks5) ListenAndServeTCP() {
 		return
 	}
 
+	if !s.listeners.Add(l) {
+		return
+	}
+
 	log.F("[socks5] listening TCP on %s", s.addr)
 
 	for {
 		c, err := l.Accept()
 		if err != nil {
+			if s.listeners.Closed() {
+				return
+			}
 			log.F("[socks5] failed to accept: %v", err)
 			continue
 		}
@@ -60,10 +73,16 @@ func (s *Socks5) Serve(c net.Conn) {
 		c.SetKeepAlive(true)
 	}
 
-	tgt, err := s.handshake(c)
+	tgt, user, err := s.handshake(c)
 	if err != nil {
 		// UDP: keep the connection until disconnect then free the UDP socket
 		if err == socks.Errors[9] {
+			if user != "" {
+				key := associateKey(c.RemoteAddr(), tgt)
+				s.udpUsers.Store(key, user)
+				defer s.udpUsers.CompareAndDelete(key, user)
+			}
+
 			buf := pool.GetBuffer(1)
 			defer pool.PutBuffer(buf)
 			// block here
@@ -81,7 +100,7 @@ func (s *Socks5) Serve(c net.Conn) {
 		return
 	}
 
-	rc, dialer, err := s.proxy.Dial("tcp", tgt.String())
+	rc, dialer, err := s.proxy.DialMeta(&proxy.Metadata{User: user, SrcAddr: c.RemoteAddr()}, "tcp", tgt.String())
 	if err != nil {
 		log.F("[socks5] %s <-> %s via %s, error in dial: %v", c.RemoteAddr(), tgt, dialer.Addr(), err)
 		return
@@ -90,7 +109,7 @@ func (s *Socks5) Serve(c net.Conn) {
 
 	log.F("[socks5] %s <-> %s via %s", c.RemoteAddr(), tgt, dialer.Addr())
 
-	if err = proxy.Relay(c, rc); err != nil {
+	if err = proxy.TrackRelay("tcp", c, rc, tgt.String(), dialer.Addr()); err != nil {
 		log.F("[socks5] %s <-> %s via %s, relay error: %v", c.RemoteAddr(), tgt, dialer.Addr(), err)
 		// record remote conn failure only
 		if !strings.Contains(err.Error(), s.addr) {
@@ -108,6 +127,10 @@ func (s *Socks5) ListenAndServeUDP() {
 	}
 	defer lc.Close()
 
+	if !s.listeners.Add(lc) {
+		return
+	}
+
 	log.F("[socks5] listening UDP on %s", s.addr)
 
 	s.ServePacket(lc)
@@ -121,6 +144,9 @@ func (s *Socks5) ServePacket(pc net.PacketConn) {
 
 		n, srcAddr, dstAddr, err := c.readFrom(buf)
 		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
 			log.F("[socks5u] remote read error: %v", err)
 			continue
 		}
@@ -142,7 +168,8 @@ func (s *Socks5) ServePacket(pc net.PacketConn) {
 }
 
 func (s *Socks5) serveSession(session *Session) {
-	dstPC, dialer, err := s.proxy.DialUDP("udp", session.srcPC.target.String())
+	meta := &proxy.Metadata{User: s.udpUser(session.src), SrcAddr: session.src}
+	dstPC, dialer, err := s.proxy.DialUDPMeta(meta, "udp", session.srcPC.target.String())
 	if err != nil {
 		log.F("[socks5u] remote dial error: %v", err)
 		nm.Delete(session.key)
@@ -150,6 +177,9 @@ func (s *Socks5) serveSession(session *Session) {
 	}
 	defer dstPC.Close()
 
+	conn, dstPC := proxy.TrackPacket(session.src, dstPC, session.srcPC.target.String(), dialer.Addr())
+	defer conn.Untrack()
+
 	go func() {
 		proxy.CopyUDP(session.srcPC, nil, dstPC, 2*time.Minute, 5*time.Second)
 		nm.Delete(session.key)
@@ -173,6 +203,41 @@ func (s *Socks5) serveSession(session *Session) {
 	}
 }
 
+// associateKey returns the key of the udp association requested by client src,
+// addr is the address the client declared to send datagrams from. The key is
+// the declared address if its port is set, otherwise the ip of the client.
+func associateKey(src net.Addr, addr socks.Addr) string {
+	client, err := netip.ParseAddrPort(src.String())
+	if err != nil {
+		return src.String()
+	}
+	ip := client.Addr().Unmap()
+
+	if declared, err := netip.ParseAddrPort(addr.String()); err == nil && declared.Port() != 0 {
+		if !declared.Addr().IsUnspecified() {
+			ip = declared.Addr().Unmap()
+		}
+		return netip.AddrPortFrom(ip, declared.Port()).String()
+	}
+	return ip.String()
+}
+
+// udpUser returns the user authenticated by the udp associate request of src.
+func (s *Socks5) udpUser(src net.Addr) string {
+	client, err := netip.ParseAddrPort(src.String())
+	if err != nil {
+		return ""
+	}
+	client = netip.AddrPortFrom(client.Addr().Unmap(), client.Port())
+
+	for _, key := range []string{client.String(), client.Addr().String()} {
+		if user, ok := s.udpUsers.Load(key); ok {
+			return user.(string)
+		}
+	}
+	return ""
+}
+
 type message struct {
 	dst net.Addr
 	msg []byte
@@ -192,91 +257,94 @@ func newSession(key string, src, dst net.Addr, srcPC *PktConn) *Session {
 	return &Session{key, src, dst, srcPC, make(chan message, 32), make(chan struct{})}
 }
 
-// Handshake fast-tracks SOCKS initialization to get target address to connect.
-func (s *Socks5) handshake(c net.Conn) (socks.Addr, error) {
+// Handshake fast-tracks SOCKS initialization to get target address to connect
+// and the authenticated username.
+func (s *Socks5) handshake(c net.Conn) (socks.Addr, string, error) {
+	var user string
+
 	// Read RFC 1928 for request and reply structure and sizes
 	buf := pool.GetBuffer(socks.MaxAddrLen)
 	defer pool.PutBuffer(buf)
 
 	// read VER, NMETHODS, METHODS
 	if _, err := io.ReadFull(c, buf[:2]); err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	nmethods := buf[1]
 	if _, err := io.ReadFull(c, buf[:nmethods]); err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	// write VER METHOD
 	if s.user != "" && s.password != "" {
 		_, err := c.Write([]byte{Version, socks.AuthPassword})
 		if err != nil {
-			return nil, err
+			return nil, "", err
 		}
 
 		_, err = io.ReadFull(c, buf[:2])
 		if err != nil {
-			return nil, err
+			return nil, "", err
 		}
 
 		// Get username
 		userLen := int(buf[1])
 		if userLen <= 0 {
 			c.Write([]byte{1, 1})
-			return nil, errors.New("auth failed: wrong username length")
+			return nil, "", errors.New("auth failed: wrong username length")
 		}
 
 		if _, err := io.ReadFull(c, buf[:userLen]); err != nil {
-			return nil, errors.New("auth failed: cannot get username")
+			return nil, "", errors.New("auth failed: cannot get username")
 		}
-		user := string(buf[:userLen])
+		user = string(buf[:userLen])
 
 		// Get password
 		_, err = c.Read(buf[:1])
 		if err != nil {
-			return nil, errors.New("auth failed: cannot get password len")
+			return nil, "", errors.New("auth failed: cannot get password len")
 		}
 
 		passLen := int(buf[0])
 		if passLen <= 0 {
 			c.Write([]byte{1, 1})
-			return nil, errors.New("auth failed: wrong password length")
+			return nil, "", errors.New("auth failed: wrong password length")
 		}
 
 		_, err = io.ReadFull(c, buf[:passLen])
 		if err != nil {
-			return nil, errors.New("auth failed: cannot get password")
+			return nil, "", errors.New("auth failed: cannot get password")
 		}
 		pass := string(buf[:passLen])
 
 		// Verify
-		if user != s.user || pass != s.password {
+		if name, _ := proxy.SplitUser(user); name != s.user || pass != s.password {
 			_, err = c.Write([]byte{1, 1})
 			if err != nil {
-				return nil, err
+				return nil, "", err
 			}
-			return nil, errors.New("auth failed, authinfo: " + user + ":" + pass)
+			return nil, "", errors.New("auth failed, authinfo: " + user + ":" + pass)
 		}
 
 		// Response auth state
 		_, err = c.Write([]byte{1, 0})
 		if err != nil {
-			return nil, err
+			return nil, "", err
 		}
 
 	} else if _, err := c.Write([]byte{Version, socks.AuthNone}); err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	// read VER CMD RSV ATYP DST.ADDR DST.PORT
 	if _, err := io.ReadFull(c, buf[:3]); err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	cmd := buf[1]
 	addr, err := socks.ReadAddr(c)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	switch cmd {
 	case socks.CmdConnect:
@@ -288,12 +356,12 @@ func (s *Socks5) handshake(c net.Conn) (socks.Addr, error) {
 		}
 		_, err = c.Write(append([]byte{5, 0, 0}, listenAddr...)) // SOCKS v5, reply succeeded
 		if err != nil {
-			return nil, socks.Errors[7]
+			return nil, "", socks.Errors[7]
 		}
 		err = socks.Errors[9]
 	default:
-		return nil, socks.Errors[7]
+		return nil, "", socks.Errors[7]
 	}
 
-	return addr, err // skip VER, CMD, RSV fields
+	return addr, user, err // skip VER, CMD, RSV fields
 }
@@ -11,6 +11,7 @@ package socks5
 
 import (
 	"net/url"
+	"sync"
 
 	"github.com/nadoo/glider/pkg/log"
 	"github.com/nadoo/glider/proxy"
@@ -26,6 +27,11 @@ type Socks5 struct {
 	addr     string
 	user     string
 	password string
+
+	// users authenticated by the udp associate requests, keyed by associateKey
+	udpUsers sync.Map
+
+	listeners proxy.Listeners
 }
 
 // NewSocks5 returns a Proxy that makes SOCKS v5 connections to the given address.
@@ -1,6 +1,7 @@
 package ss
 
 import (
+	"errors"
 	"io"
 	"net"
 	"strings"
@@ -26,6 +27,11 @@ func (s *SS) ListenAndServe() {
 	s.ListenAndServeTCP()
 }
 
+// Close stops listening, connections being served are not affected.
+func (s *SS) Close() error {
+	return s.listeners.Close()
+}
+
 // ListenAndServeTCP serves tcp ss requests.
 func (s *SS) ListenAndServeTCP() {
 	l, err := net.Listen("tcp", s.addr)
@@ -34,11 +40,18 @@ func (s *SS) ListenAndServeTCP() {
 		return
 	}
 
+	if !s.listeners.Add(l) {
+		return
+	}
+
 	log.F("[ss] listening TCP on %s", s.addr)
 
 	for {
 		c, err := l.Accept()
 		if err != nil {
+			if s.listeners.Closed() {
+				return
+			}
 			log.F("[ss] failed to accept: %v", err)
 			continue
 		}
@@ -64,8 +77,7 @@ func (s *SS) Serve(c net.Conn) {
 		return
 	}
 
-	dialer := s.proxy.NextDialer(tgt.String())
-	rc, err := dialer.Dial("tcp", tgt.String())
+	rc, dialer, err := s.proxy.DialMeta(&proxy.Metadata{SrcAddr: c.RemoteAddr()}, "tcp", tgt.String())
 	if err != nil {
 		log.F("[ss] %s <-> %s via %s, error in dial: %v", c.RemoteAddr(), tgt, dialer.Addr(), err)
 		return
@@ -74,7 +86,7 @@ func (s *SS) Serve(c net.Conn) {
 
 	log.F("[ss] %s <-> %s via %s", c.RemoteAddr(), tgt, dialer.Addr())
 
-	if err = proxy.Relay(sc, rc); err != nil {
+	if err = proxy.TrackRelay("tcp", sc, rc, tgt.String(), dialer.Addr()); err != nil {
 		log.F("[ss] %s <-> %s via %s, relay error: %v", c.RemoteAddr(), tgt, dialer.Addr(), err)
 		// record remote conn failure only
 		if !strings.Contains(err.Error(), s.addr) {
@@ -92,6 +104,10 @@ func (s *SS) ListenAndServeUDP() {
 	}
 	defer lc.Close()
 
+	if !s.listeners.Add(lc) {
+		return
+	}
+
 	log.F("[ss] listening UDP on %s", s.addr)
 
 	s.ServePacket(lc)
@@ -106,6 +122,9 @@ func (s *SS) ServePacket(pc net.PacketConn) {
 
 		n, srcAddr, dstAddr, err := c.readFrom(buf)
 		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
 			log.F("[ssu] remote read error: %v", err)
 			continue
 		}
@@ -127,7 +146,7 @@ func (s *SS) ServePacket(pc net.PacketConn) {
 }
 
 func (s *SS) serveSession(session *Session) {
-	dstPC, dialer, err := s.proxy.DialUDP("udp", session.dst.String())
+	dstPC, dialer, err := s.proxy.DialUDPMeta(&proxy.Metadata{SrcAddr: session.src}, "udp", session.dst.String())
 	if err != nil {
 		log.F("[ssu] remote dial error: %v", err)
 		nm.Delete(session.key)
@@ -135,6 +154,9 @@ func (s *SS) serveSession(session *Session) {
 	}
 	defer dstPC.Close()
 
+	conn, dstPC := proxy.TrackPacket(session.src, dstPC, session.dst.String(), dialer.Addr())
+	defer conn.Untrack()
+
 	go func() {
 		proxy.CopyUDP(session.srcPC, nil, dstPC, 2*time.Minute, 5*time.Second)
 		nm.Delete(session.key)
@@ -15,6 +15,8 @@ type SS struct {
 	addr   string
 
 	cipher.Cipher
+
+	listeners proxy.Listeners
 }
 
 func init() {
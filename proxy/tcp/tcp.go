@@ -14,6 +14,8 @@ type TCP struct {
 	addr   string
 	dialer proxy.Dialer
 	proxy  proxy.Proxy
+
+	listeners proxy.Listeners
 }
 
 func init() {
@@ -57,11 +59,18 @@ func (s *TCP) ListenAndServe() {
 	}
 	defer l.Close()
 
+	if !s.listeners.Add(l) {
+		return
+	}
+
 	log.F("[tcp] listening TCP on %s", s.addr)
 
 	for {
 		c, err := l.Accept()
 		if err != nil {
+			if s.listeners.Closed() {
+				return
+			}
 			log.F("[tcp] failed to accept: %v", err)
 			continue
 		}
@@ -70,6 +79,11 @@ func (s *TCP) ListenAndServe() {
 	}
 }
 
+// Close stops listening, connections being served are not affected.
+func (s *TCP) Close() error {
+	return s.listeners.Close()
+}
+
 // Serve serves a connection.
 func (s *TCP) Serve(c net.Conn) {
 	defer c.Close()
@@ -78,7 +92,7 @@ func (s *TCP) Serve(c net.Conn) {
 		c.SetKeepAlive(true)
 	}
 
-	rc, dialer, err := s.proxy.Dial("tcp", "")
+	rc, dialer, err := s.proxy.DialMeta(&proxy.Metadata{SrcAddr: c.RemoteAddr()}, "tcp", "")
 	if err != nil {
 		log.F("[tcp] %s <-> %s via %s, error in dial: %v", c.RemoteAddr(), s.addr, dialer.Addr(), err)
 		s.proxy.Record(dialer, false)
@@ -88,7 +102,7 @@ func (s *TCP) Serve(c net.Conn) {
 
 	log.F("[tcp] %s <-> %s", c.RemoteAddr(), dialer.Addr())
 
-	if err = proxy.Relay(c, rc); err != nil {
+	if err = proxy.TrackRelay("tcp", c, rc, rc.RemoteAddr().String(), dialer.Addr()); err != nil {
 		log.F("[tcp] %s <-> %s, relay error: %v", c.RemoteAddr(), dialer.Addr(), err)
 		// record remote conn failure only
 		if !strings.Contains(err.Error(), s.addr) {
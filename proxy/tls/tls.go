@@ -31,6 +31,8 @@ type TLS struct {
 	alpn []string
 
 	server proxy.Server
+
+	listeners proxy.Listeners
 }
 
 func init() {
@@ -143,11 +145,18 @@ func (s *TLS) ListenAndServe() {
 	}
 	defer l.Close()
 
+	if !s.listeners.Add(l) {
+		return
+	}
+
 	log.F("[tls] listening TCP on %s with TLS", s.addr)
 
 	for {
 		c, err := l.Accept()
 		if err != nil {
+			if s.listeners.Closed() {
+				return
+			}
 			log.F("[tls] failed to accept: %v", err)
 			continue
 		}
@@ -156,6 +165,11 @@ func (s *TLS) ListenAndServe() {
 	}
 }
 
+// Close stops listening, connections being served are not affected.
+func (s *TLS) Close() error {
+	return s.listeners.Close()
+}
+
 // Serve serves a connection.
 func (s *TLS) Serve(cc net.Conn) {
 	c := stdtls.Server(cc, s.config)
@@ -167,7 +181,7 @@ func (s *TLS) Serve(cc net.Conn) {
 
 	defer c.Close()
 
-	rc, dialer, err := s.proxy.Dial("tcp", "")
+	rc, dialer, err := s.proxy.DialMeta(&proxy.Metadata{SrcAddr: c.RemoteAddr()}, "tcp", "")
 	if err != nil {
 		log.F("[tls] %s <-> %s via %s, error in dial: %v", c.RemoteAddr(), s.addr, dialer.Addr(), err)
 		s.proxy.Record(dialer, false)
@@ -177,7 +191,7 @@ func (s *TLS) Serve(cc net.Conn) {
 
 	log.F("[tls] %s <-> %s", c.RemoteAddr(), dialer.Addr())
 
-	if err = proxy.Relay(c, rc); err != nil {
+	if err = proxy.TrackRelay("tcp", c, rc, rc.RemoteAddr().String(), dialer.Addr()); err != nil {
 		log.F("[tls] %s <-> %s, relay error: %v", c.RemoteAddr(), dialer.Addr(), err)
 		// record remote conn failure only
 		if !strings.Contains(err.Error(), s.addr) {
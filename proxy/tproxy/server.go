@@ -3,6 +3,7 @@
 package tproxy
 
 import (
+	"errors"
 	"net"
 	"net/url"
 	"sync"
@@ -23,6 +24,8 @@ func init() {
 type TProxy struct {
 	proxy proxy.Proxy
 	addr  string
+
+	listeners proxy.Listeners
 }
 
 // NewTProxy returns a tproxy.
@@ -52,6 +55,11 @@ func (s *TProxy) ListenAndServe() {
 	s.ListenAndServeUDP()
 }
 
+// Close stops listening, connections being served are not affected.
+func (s *TProxy) Close() error {
+	return s.listeners.Close()
+}
+
 // ListenAndServeTCP listens and serves tcp.
 func (s *TProxy) ListenAndServeTCP() {
 	log.F("[tproxy] tcp mode not supported now, please use 'redir' instead")
@@ -77,12 +85,19 @@ func (s *TProxy) ListenAndServeUDP() {
 	}
 	defer lc.Close()
 
+	if !s.listeners.Add(lc) {
+		return
+	}
+
 	log.F("[tproxyu] listening UDP on %s", s.addr)
 
 	for {
 		buf := pool.GetBuffer(proxy.UDPBufSize)
 		n, srcAddr, dstAddr, err := ReadFromUDP(lc, buf)
 		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
 			log.F("[tproxyu] read error: %v", err)
 			continue
 		}
@@ -105,7 +120,7 @@ func (s *TProxy) ListenAndServeUDP() {
 
 // serveSession serves a udp session.
 func (s *TProxy) serveSession(session *session) {
-	dstPC, dialer, err := s.proxy.DialUDP("udp", session.dst.String())
+	dstPC, dialer, err := s.proxy.DialUDPMeta(&proxy.Metadata{SrcAddr: session.src}, "udp", session.dst.String())
 	if err != nil {
 		log.F("[tproxyu] dial to %s error: %v", session.dst, err)
 		nm.Delete(session.key)
@@ -113,6 +128,9 @@ func (s *TProxy) serveSession(session *session) {
 	}
 	defer dstPC.Close()
 
+	conn, dstPC := proxy.TrackPacket(session.src, dstPC, session.dst.String(), dialer.Addr())
+	defer conn.Untrack()
+
 	go func() {
 		timeout, step := 2*time.Minute, 5*time.Second
 		buf := pool.GetBuffer(proxy.UDPBufSize)
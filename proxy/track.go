@@ -0,0 +1,202 @@
+package proxy
+
+import (
+	"cmp"
+	"context"
+	"net"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	connID      atomic.Uint64
+	connections sync.Map // map[uint64]*Connection
+	countBytes  atomic.Bool
+)
+
+// CountBytes enables counting the bytes of tracked connections while relaying,
+// otherwise they are counted when the connections finished.
+func CountBytes(enable bool) { countBytes.Store(enable) }
+
+// Connection is a relayed connection tracked in the connection table.
+type Connection struct {
+	ID      uint64
+	Network string
+	Client  string
+	Target  string
+	Dialer  string
+	Start   time.Time
+
+	upload   atomic.Uint64
+	download atomic.Uint64
+
+	mu     sync.Mutex
+	closed bool
+	c, rc  net.Conn
+	pc     net.PacketConn // remote packet conn of a udp session
+}
+
+// Track adds the connection between client conn c and remote conn rc to the
+// connection table, Untrack must be called when the connection finished.
+func Track(network string, c, rc net.Conn, target, dialer string) *Connection {
+	conn := &Connection{
+		ID:      connID.Add(1),
+		Network: network,
+		Target:  target,
+		Dialer:  dialer,
+		Start:   time.Now(),
+		c:       c,
+		rc:      rc,
+	}
+	if addr := c.RemoteAddr(); addr != nil {
+		conn.Client = addr.String()
+	}
+	connections.Store(conn.ID, conn)
+	return conn
+}
+
+// TrackPacket adds the udp session of client src relayed over the remote packet
+// conn rc to the connection table, the bytes are counted when they are read from
+// or written to the returned packet conn. Untrack must be called when the session
+// finished.
+func TrackPacket(src net.Addr, rc net.PacketConn, target, dialer string) (*Connection, net.PacketConn) {
+	conn := &Connection{
+		ID:      connID.Add(1),
+		Network: "udp",
+		Client:  src.String(),
+		Target:  target,
+		Dialer:  dialer,
+		Start:   time.Now(),
+		pc:      rc,
+	}
+	connections.Store(conn.ID, conn)
+	return conn, &countPacketConn{rc, conn}
+}
+
+// countPacketConn counts the bytes relayed over the packet conn of a udp session.
+type countPacketConn struct {
+	net.PacketConn
+	conn *Connection
+}
+
+func (pc *countPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, addr, err := pc.PacketConn.ReadFrom(b)
+	pc.conn.AddDownload(int64(n))
+	return n, addr, err
+}
+
+func (pc *countPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	n, err := pc.PacketConn.WriteTo(b, addr)
+	pc.conn.AddUpload(int64(n))
+	return n, err
+}
+
+// Untrack removes the connection from the connection table.
+func (c *Connection) Untrack() { connections.Delete(c.ID) }
+
+// AddUpload adds n bytes sent from client to remote.
+func (c *Connection) AddUpload(n int64) {
+	c.upload.Add(uint64(n))
+	uploadBytes.Add(uint64(n))
+}
+
+// AddDownload adds n bytes sent from remote to client.
+func (c *Connection) AddDownload(n int64) {
+	c.download.Add(uint64(n))
+	downloadBytes.Add(uint64(n))
+}
+
+// Upload returns the bytes sent from client to remote.
+func (c *Connection) Upload() uint64 { return c.upload.Load() }
+
+// Download returns the bytes sent from remote to client.
+func (c *Connection) Download() uint64 { return c.download.Load() }
+
+// Close terminates the connection, the relay on it returns immediately
+// and the server which owns the connection closes both sides. The remote
+// packet conn of a udp session is closed directly to end the session.
+func (c *Connection) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+	if c.pc != nil {
+		c.pc.Close()
+		return
+	}
+	now := time.Now()
+	c.c.SetDeadline(now)
+	c.rc.SetDeadline(now)
+}
+
+// unblock sets the read deadline of conn after one direction of relay
+// finished, it won't postpone the deadline of a closed connection.
+func (c *Connection) unblock(conn net.Conn, wait time.Duration) {
+	if c == nil {
+		conn.SetReadDeadline(time.Now().Add(wait))
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.closed {
+		conn.SetReadDeadline(time.Now().Add(wait))
+	}
+}
+
+// Connections returns all tracked connections ordered by id.
+func Connections() []*Connection {
+	var conns []*Connection
+	connections.Range(func(_, v any) bool {
+		conns = append(conns, v.(*Connection))
+		return true
+	})
+	slices.SortFunc(conns, func(a, b *Connection) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return conns
+}
+
+// GetConnection returns the tracked connection with the given id.
+func GetConnection(id uint64) (*Connection, bool) {
+	v, ok := connections.Load(id)
+	if !ok {
+		return nil, false
+	}
+	return v.(*Connection), true
+}
+
+// TrackRelay relays between client conn c and remote conn rc like Relay,
+// the connection is tracked in the connection table until relay finished.
+func TrackRelay(network string, c, rc net.Conn, target, dialer string) error {
+	conn := Track(network, c, rc, target, dialer)
+	defer conn.Untrack()
+	return relay(c, rc, conn)
+}
+
+// Drain waits for all the tracked connections to finish until ctx is done,
+// then closes the remaining connections and returns the number of them.
+// Udp sessions are not waited for as they only finish by idle timeout.
+func Drain(ctx context.Context) int {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		conns := slices.DeleteFunc(Connections(), func(c *Connection) bool { return c.pc != nil })
+		if len(conns) == 0 {
+			return 0
+		}
+
+		select {
+		case <-ctx.Done():
+			for _, c := range conns {
+				c.Close()
+			}
+			return len(conns)
+		case <-ticker.C:
+		}
+	}
+}
@@ -66,11 +66,18 @@ func (s *Trojan) ListenAndServe() {
 	}
 	defer l.Close()
 
+	if !s.listeners.Add(l) {
+		return
+	}
+
 	log.F("[trojan] listening TCP on %s, with TLS: %v", s.addr, s.withTLS)
 
 	for {
 		c, err := l.Accept()
 		if err != nil {
+			if s.listeners.Closed() {
+				return
+			}
 			log.F("[trojan] failed to accept: %v", err)
 			continue
 		}
@@ -79,6 +86,11 @@ func (s *Trojan) ListenAndServe() {
 	}
 }
 
+// Close stops listening, connections being served are not affected.
+func (s *Trojan) Close() error {
+	return s.listeners.Close()
+}
+
 // Serve serves a connection.
 func (s *Trojan) Serve(c net.Conn) {
 	if c, ok := c.(*net.TCPConn); ok {
@@ -109,17 +121,18 @@ func (s *Trojan) Serve(c net.Conn) {
 	}
 
 	network := "tcp"
-	dialer := s.proxy.NextDialer(target.String())
-
 	if cmd == socks.CmdUDPAssociate {
-		// there is no upstream proxy, just serve it
-		if dialer.Addr() == "DIRECT" {
-			s.ServeUoT(c, target)
-			return
-		}
 		network = "udp"
 	}
 
+	dialer := s.proxy.NextDialerMeta(&proxy.Metadata{SrcAddr: c.RemoteAddr()}, network, target.String())
+
+	// there is no upstream proxy, just serve it
+	if cmd == socks.CmdUDPAssociate && dialer.Addr() == "DIRECT" {
+		s.ServeUoT(c, target)
+		return
+	}
+
 	rc, err := dialer.Dial(network, target.String())
 	if err != nil {
 		log.F("[trojan] %s <-> %s via %s, error in dial: %v", c.RemoteAddr(), target, dialer.Addr(), err)
@@ -129,7 +142,7 @@ func (s *Trojan) Serve(c net.Conn) {
 
 	log.F("[trojan] %s <-> %s via %s", c.RemoteAddr(), target, dialer.Addr())
 
-	if err = proxy.Relay(c, rc); err != nil {
+	if err = proxy.TrackRelay(network, c, rc, target.String(), dialer.Addr()); err != nil {
 		log.F("[trojan] %s <-> %s via %s, relay error: %v", c.RemoteAddr(), target, dialer.Addr(), err)
 		// record remote conn failure only
 		if !strings.Contains(err.Error(), s.addr) {
@@ -140,7 +153,7 @@ func (s *Trojan) Serve(c net.Conn) {
 
 func (s *Trojan) serveFallback(c net.Conn, tgt string, headBuf *bytes.Buffer) {
 	// TODO: should we access fallback directly or via proxy?
-	dialer := s.proxy.NextDialer(tgt)
+	dialer := s.proxy.NextDialerMeta(&proxy.Metadata{SrcAddr: c.RemoteAddr()}, "tcp", tgt)
 	rc, err := dialer.Dial("tcp", tgt)
 	if err != nil {
 		log.F("[trojan-fallback] %s <-> %s via %s, error in dial: %v", c.RemoteAddr(), tgt, dialer.Addr(), err)
@@ -156,7 +169,7 @@ func (s *Trojan) serveFallback(c net.Conn, tgt string, headBuf *bytes.Buffer) {
 
 	log.F("[trojan-fallback] %s <-> %s via %s", c.RemoteAddr(), tgt, dialer.Addr())
 
-	if err = proxy.Relay(c, rc); err != nil {
+	if err = proxy.TrackRelay("tcp", c, rc, tgt, dialer.Addr()); err != nil {
 		log.F("[trojan-fallback] %s <-> %s via %s, relay error: %v", c.RemoteAddr(), tgt, dialer.Addr(), err)
 	}
 }
@@ -29,6 +29,8 @@ type Trojan struct {
 	certFile   string
 	keyFile    string
 	fallback   string
+
+	listeners proxy.Listeners
 }
 
 // NewTrojan returns a trojan proxy.
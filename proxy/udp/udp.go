@@ -1,6 +1,7 @@
 package udp
 
 import (
+	"errors"
 	"net"
 	"net/url"
 	"sync"
@@ -24,6 +25,8 @@ type UDP struct {
 	uaddr  *net.UDPAddr
 	dialer proxy.Dialer
 	proxy  proxy.Proxy
+
+	listeners proxy.Listeners
 }
 
 // NewUDP returns a udp struct.
@@ -63,12 +66,19 @@ func (s *UDP) ListenAndServe() {
 	}
 	defer c.Close()
 
+	if !s.listeners.Add(c) {
+		return
+	}
+
 	log.F("[udp] listening UDP on %s", s.addr)
 
 	for {
 		buf := pool.GetBuffer(proxy.UDPBufSize)
 		n, srcAddr, err := c.ReadFrom(buf)
 		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
 			log.F("[udp] read error: %v", err)
 			continue
 		}
@@ -89,10 +99,15 @@ func (s *UDP) ListenAndServe() {
 	}
 }
 
+// Close stops listening, connections being served are not affected.
+func (s *UDP) Close() error {
+	return s.listeners.Close()
+}
+
 func (s *UDP) serveSession(session *session) {
 	// we know we are creating an udp tunnel, so the dial addr is meaningless,
 	// we use srcAddr here to help the unix client to identify the source socket.
-	dstPC, dialer, err := s.proxy.DialUDP("udp", session.src.String())
+	dstPC, dialer, err := s.proxy.DialUDPMeta(&proxy.Metadata{SrcAddr: session.src}, "udp", session.src.String())
 	if err != nil {
 		log.F("[udp] remote dial error: %v", err)
 		nm.Delete(session.key)
@@ -100,6 +115,9 @@ func (s *UDP) serveSession(session *session) {
 	}
 	defer dstPC.Close()
 
+	conn, dstPC := proxy.TrackPacket(session.src, dstPC, dialer.Addr(), dialer.Addr())
+	defer conn.Untrack()
+
 	go func() {
 		proxy.CopyUDP(session, session.src, dstPC, 2*time.Minute, 5*time.Second)
 		nm.Delete(session.key)
@@ -1,6 +1,7 @@
 package unix
 
 import (
+	"errors"
 	"net"
 	"os"
 	"strings"
@@ -42,6 +43,11 @@ func (s *Unix) ListenAndServe() {
 	s.ListenAndServeTCP()
 }
 
+// Close stops listening, connections being served are not affected.
+func (s *Unix) Close() error {
+	return s.listeners.Close()
+}
+
 // ListenAndServeTCP serves tcp requests.
 func (s *Unix) ListenAndServeTCP() {
 	os.Remove(s.addr)
@@ -52,11 +58,18 @@ func (s *Unix) ListenAndServeTCP() {
 	}
 	defer l.Close()
 
+	if !s.listeners.Add(l) {
+		return
+	}
+
 	log.F("[unix] Listen on %s", s.addr)
 
 	for {
 		c, err := l.Accept()
 		if err != nil {
+			if s.listeners.Closed() {
+				return
+			}
 			log.F("[unix] failed to accept: %v", err)
 			continue
 		}
@@ -74,7 +87,7 @@ func (s *Unix) Serve(c net.Conn) {
 
 	defer c.Close()
 
-	rc, dialer, err := s.proxy.Dial("unix", "")
+	rc, dialer, err := s.proxy.DialMeta(&proxy.Metadata{SrcAddr: c.RemoteAddr()}, "unix", "")
 	if err != nil {
 		log.F("[unix] %s <-> %s via %s, error in dial: %v", c.RemoteAddr(), s.addr, dialer.Addr(), err)
 		s.proxy.Record(dialer, false)
@@ -84,7 +97,7 @@ func (s *Unix) Serve(c net.Conn) {
 
 	log.F("[unix] %s <-> %s", c.RemoteAddr(), dialer.Addr())
 
-	if err = proxy.Relay(c, rc); err != nil {
+	if err = proxy.TrackRelay("unix", c, rc, rc.RemoteAddr().String(), dialer.Addr()); err != nil {
 		log.F("[unix] %s <-> %s, relay error: %v", c.RemoteAddr(), dialer.Addr(), err)
 		// record remote conn failure only
 		if !strings.Contains(err.Error(), s.addr) {
@@ -103,6 +116,10 @@ func (s *Unix) ListenAndServeUDP() {
 	}
 	defer c.Close()
 
+	if !s.listeners.Add(c) {
+		return
+	}
+
 	log.F("[unix] ListenPacket on %s", s.addru)
 
 	s.ServePacket(c)
@@ -119,6 +136,9 @@ func (s *Unix) ServePacket(pc net.PacketConn) {
 		buf := pool.GetBuffer(proxy.UDPBufSize)
 		n, srcAddr, err := pc.ReadFrom(buf)
 		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
 			log.F("[unix] read error: %v", err)
 			continue
 		}
@@ -140,7 +160,7 @@ func (s *Unix) ServePacket(pc net.PacketConn) {
 }
 
 func (s *Unix) serveSession(session *Session) {
-	dstPC, dialer, err := s.proxy.DialUDP("udp", "")
+	dstPC, dialer, err := s.proxy.DialUDPMeta(&proxy.Metadata{SrcAddr: session.src}, "udp", "")
 	if err != nil {
 		log.F("[unix] remote dial error: %v", err)
 		nm.Delete(session.key)
@@ -148,6 +168,9 @@ func (s *Unix) serveSession(session *Session) {
 	}
 	defer dstPC.Close()
 
+	conn, dstPC := proxy.TrackPacket(session.src, dstPC, dialer.Addr(), dialer.Addr())
+	defer conn.Untrack()
+
 	go func() {
 		proxy.CopyUDP(session.srcPC, session.src, dstPC, 2*time.Minute, 5*time.Second)
 		nm.Delete(session.key)
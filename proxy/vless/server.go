@@ -27,11 +27,18 @@ func (s *VLess) ListenAndServe() {
 	}
 	defer l.Close()
 
+	if !s.listeners.Add(l) {
+		return
+	}
+
 	log.F("[vless] listening TCP on %s", s.addr)
 
 	for {
 		c, err := l.Accept()
 		if err != nil {
+			if s.listeners.Closed() {
+				return
+			}
 			log.F("[vless] failed to accept: %v", err)
 			continue
 		}
@@ -40,6 +47,11 @@ func (s *VLess) ListenAndServe() {
 	}
 }
 
+// Close stops listening, connections being served are not affected.
+func (s *VLess) Close() error {
+	return s.listeners.Close()
+}
+
 // Serve serves a connection.
 func (s *VLess) Serve(c net.Conn) {
 	defer c.Close()
@@ -63,17 +75,18 @@ func (s *VLess) Serve(c net.Conn) {
 	c = NewServerConn(c)
 
 	network := "tcp"
-	dialer := s.proxy.NextDialer(target)
-
 	if cmd == CmdUDP {
-		// there is no upstream proxy, just serve it
-		if dialer.Addr() == "DIRECT" {
-			s.ServeUoT(c, target)
-			return
-		}
 		network = "udp"
 	}
 
+	dialer := s.proxy.NextDialerMeta(&proxy.Metadata{SrcAddr: c.RemoteAddr()}, network, target)
+
+	// there is no upstream proxy, just serve it
+	if cmd == CmdUDP && dialer.Addr() == "DIRECT" {
+		s.ServeUoT(c, target)
+		return
+	}
+
 	rc, err := dialer.Dial(network, target)
 	if err != nil {
 		log.F("[vless] %s <-> %s via %s, error in dial: %v", c.RemoteAddr(), target, dialer.Addr(), err)
@@ -83,7 +96,7 @@ func (s *VLess) Serve(c net.Conn) {
 
 	log.F("[vless] %s <-> %s via %s", c.RemoteAddr(), target, dialer.Addr())
 
-	if err = proxy.Relay(c, rc); err != nil {
+	if err = proxy.TrackRelay(network, c, rc, target, dialer.Addr()); err != nil {
 		log.F("[vless] %s <-> %s via %s, relay error: %v", c.RemoteAddr(), target, dialer.Addr(), err)
 		// record remote conn failure only
 		if !strings.Contains(err.Error(), s.addr) {
@@ -94,7 +107,7 @@ func (s *VLess) Serve(c net.Conn) {
 
 func (s *VLess) serveFallback(c net.Conn, tgt string, headBuf *bytes.Buffer) {
 	// TODO: should we access fallback directly or via proxy?
-	dialer := s.proxy.NextDialer(tgt)
+	dialer := s.proxy.NextDialerMeta(&proxy.Metadata{SrcAddr: c.RemoteAddr()}, "tcp", tgt)
 	rc, err := dialer.Dial("tcp", tgt)
 	if err != nil {
 		log.F("[vless-fallback] %s <-> %s via %s, error in dial: %v", c.RemoteAddr(), tgt, dialer.Addr(), err)
@@ -110,7 +123,7 @@ func (s *VLess) serveFallback(c net.Conn, tgt string, headBuf *bytes.Buffer) {
 
 	log.F("[vless-fallback] %s <-> %s via %s", c.RemoteAddr(), tgt, dialer.Addr())
 
-	if err = proxy.Relay(c, rc); err != nil {
+	if err = proxy.TrackRelay("tcp", c, rc, tgt, dialer.Addr()); err != nil {
 		log.F("[vless-fallback] %s <-> %s via %s, relay error: %v", c.RemoteAddr(), tgt, dialer.Addr(), err)
 	}
 }
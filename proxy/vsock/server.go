@@ -49,11 +49,18 @@ func (s *vsock) ListenAndServe() {
 	}
 	defer l.Close()
 
+	if !s.listeners.Add(l) {
+		return
+	}
+
 	log.F("[vsock] Listening on %s", l.Addr())
 
 	for {
 		c, err := l.Accept()
 		if err != nil {
+			if s.listeners.Closed() {
+				return
+			}
 			log.F("[vsock] failed to accept: %v", err)
 			continue
 		}
@@ -62,6 +69,11 @@ func (s *vsock) ListenAndServe() {
 	}
 }
 
+// Close stops listening, connections being served are not affected.
+func (s *vsock) Close() error {
+	return s.listeners.Close()
+}
+
 // Serve serves requests.
 func (s *vsock) Serve(c net.Conn) {
 	if s.server != nil {
@@ -71,7 +83,7 @@ func (s *vsock) Serve(c net.Conn) {
 
 	defer c.Close()
 
-	rc, dialer, err := s.proxy.Dial("tcp", "")
+	rc, dialer, err := s.proxy.DialMeta(&proxy.Metadata{SrcAddr: c.RemoteAddr()}, "tcp", "")
 	if err != nil {
 		log.F("[vsock] %s <-> %s via %s, error in dial: %v", c.RemoteAddr(), s.addr, dialer.Addr(), err)
 		s.proxy.Record(dialer, false)
@@ -81,7 +93,7 @@ func (s *vsock) Serve(c net.Conn) {
 
 	log.F("[vsock] %s <-> %s", c.RemoteAddr(), dialer.Addr())
 
-	if err = proxy.Relay(c, rc); err != nil {
+	if err = proxy.TrackRelay("tcp", c, rc, rc.RemoteAddr().String(), dialer.Addr()); err != nil {
 		log.F("[vsock] %s <-> %s, relay error: %v", c.RemoteAddr(), dialer.Addr(), err)
 		// record remote conn failure only
 		if !strings.Contains(err.Error(), s.addr) {
@@ -74,11 +74,18 @@ func (s *WS) ListenAndServe() {
 	}
 	defer l.Close()
 
+	if !s.listeners.Add(l) {
+		return
+	}
+
 	log.F("[ws] listening TCP on %s, with TLS: %v", s.addr, s.withTLS)
 
 	for {
 		c, err := l.Accept()
 		if err != nil {
+			if s.listeners.Closed() {
+				return
+			}
 			log.F("[ws] failed to accept: %v", err)
 			continue
 		}
@@ -87,6 +94,11 @@ func (s *WS) ListenAndServe() {
 	}
 }
 
+// Close stops listening, connections being served are not affected.
+func (s *WS) Close() error {
+	return s.listeners.Close()
+}
+
 // Serve serves a connection.
 func (s *WS) Serve(cc net.Conn) {
 	if s.withTLS {
@@ -113,7 +125,7 @@ func (s *WS) Serve(cc net.Conn) {
 
 	defer c.Close()
 
-	rc, dialer, err := s.proxy.Dial("tcp", "")
+	rc, dialer, err := s.proxy.DialMeta(&proxy.Metadata{SrcAddr: c.RemoteAddr()}, "tcp", "")
 	if err != nil {
 		log.F("[ws] %s <-> %s via %s, error in dial: %v", c.RemoteAddr(), s.addr, dialer.Addr(), err)
 		s.proxy.Record(dialer, false)
@@ -124,7 +136,7 @@ func (s *WS) Serve(cc net.Conn) {
 
 	log.F("[ws] %s <-> %s", c.RemoteAddr(), dialer.Addr())
 
-	if err = proxy.Relay(c, rc); err != nil {
+	if err = proxy.TrackRelay("tcp", c, rc, rc.RemoteAddr().String(), dialer.Addr()); err != nil {
 		log.F("[ws] %s <-> %s, relay error: %v", c.RemoteAddr(), dialer.Addr(), err)
 		// record remote conn failure only
 		if !strings.Contains(err.Error(), s.addr) {
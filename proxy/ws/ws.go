@@ -38,6 +38,8 @@ type WS struct {
 	certFile   string
 	keyFile    string
 	server     proxy.Server
+
+	listeners proxy.Listeners
 }
 
 // NewWS returns a websocket proxy.
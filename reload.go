@@ -0,0 +1,282 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/netip"
+	"reflect"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/nadoo/glider/dns"
+	"github.com/nadoo/glider/ipset"
+	"github.com/nadoo/glider/pkg/log"
+	"github.com/nadoo/glider/proxy"
+	"github.com/nadoo/glider/rule"
+)
+
+// switchProxy 可以在运行时原子替换的规则代理，监听器和DNS服务器都通过它访问当前的规则代理，
+// 替换后新的连接使用新的规则，已建立的连接不受影响
+type switchProxy struct {
+	atomic.Pointer[rule.Proxy]
+}
+
+// Dial implements proxy.Proxy.
+func (p *switchProxy) Dial(network, addr string) (net.Conn, proxy.Dialer, error) {
+	return p.Load().Dial(network, addr)
+}
+
+// DialMeta implements proxy.Proxy.
+func (p *switchProxy) DialMeta(meta *proxy.Metadata, network, addr string) (net.Conn, proxy.Dialer, error) {
+	return p.Load().DialMeta(meta, network, addr)
+}
+
+// DialUDP implements proxy.Proxy.
+func (p *switchProxy) DialUDP(network, addr string) (net.PacketConn, proxy.UDPDialer, error) {
+	return p.Load().DialUDP(network, addr)
+}
+
+// DialUDPMeta implements proxy.Proxy.
+func (p *switchProxy) DialUDPMeta(meta *proxy.Metadata, network, addr string) (net.PacketConn, proxy.UDPDialer, error) {
+	return p.Load().DialUDPMeta(meta, network, addr)
+}
+
+// NextDialer implements proxy.Proxy.
+func (p *switchProxy) NextDialer(dstAddr string) proxy.Dialer {
+	return p.Load().NextDialer(dstAddr)
+}
+
+// NextDialerMeta implements proxy.Proxy.
+func (p *switchProxy) NextDialerMeta(meta *proxy.Metadata, network, dstAddr string) proxy.Dialer {
+	return p.Load().NextDialerMeta(meta, network, dstAddr)
+}
+
+// Record implements proxy.Proxy.
+func (p *switchProxy) Record(dialer proxy.Dialer, success bool) {
+	p.Load().Record(dialer, success)
+}
+
+// AddDomainIP 实现 dns.AnswerHandler，更新当前规则代理从DNS解析结果学习到的IP
+func (p *switchProxy) AddDomainIP(domain string, ip netip.Addr, ttl int) error {
+	return p.Load().AddDomainIP(domain, ip, ttl)
+}
+
+var (
+	// 当前的规则代理
+	rulePxy = &switchProxy{}
+
+	// 当前的 ipset 管理器，未启用或不支持时为 nil
+	ipsetM atomic.Pointer[ipset.Manager]
+
+	// reloadMu 保护下面的运行时状态，保证同一时间只有一个重新加载
+	reloadMu sync.Mutex
+	// 最近一次加载的配置
+	loadedConf *Config
+	// 正在运行的监听器，key 为监听URL
+	servers = make(map[string]*runningServer)
+	// 是否正在关闭，关闭过程中不再重新加载配置
+	stopping bool
+)
+
+// runningServer 正在运行的监听器
+type runningServer struct {
+	server proxy.Server
+	lp     *listenerProxy
+}
+
+// addDomainIPSet 实现 dns.AnswerHandler，将解析结果加入当前 ipset 管理器的集合，集合中的IP不会过期
+func addDomainIPSet(domain string, ip netip.Addr, _ int) error {
+	if m := ipsetM.Load(); m != nil {
+		return m.AddDomainIP(domain, ip)
+	}
+	return nil
+}
+
+// startServer 启动监听器，必须持有 reloadMu
+func startServer(listen string) error {
+	lp := newListenerProxy(listen, rulePxy)
+	server, err := proxy.ServerFromURL(listen, lp)
+	if err != nil {
+		removeListenerProxy(lp)
+		return err
+	}
+
+	servers[listen] = &runningServer{server: server, lp: lp}
+	go server.ListenAndServe()
+
+	return nil
+}
+
+// stopServer 停止监听器，通过它建立的连接不受影响，必须持有 reloadMu
+func stopServer(listen string) {
+	s, ok := servers[listen]
+	if !ok {
+		return
+	}
+
+	if err := s.server.Close(); err != nil {
+		log.F("[reload] close listener %s error: %v", listenerName(listen), err)
+	}
+	removeListenerProxy(s.lp)
+	delete(servers, listen)
+}
+
+// dnsServers 返回规则文件中为域名指定的DNS服务器
+func dnsServers(rules []*rule.Config) map[string][]string {
+	servers := make(map[string][]string)
+	for _, r := range rules {
+		if len(r.DNSServers) > 0 {
+			for _, domain := range r.Domain {
+				servers[domain] = r.DNSServers
+			}
+		}
+	}
+	return servers
+}
+
+// checkForwarders 检查配置中所有的转发器URL，避免重建转发器组时因为错误的URL退出
+func checkForwarders(conf *Config) error {
+	forwards := slices.Clone(conf.Forwards)
+	for _, r := range conf.rules {
+		forwards = append(forwards, r.Forward...)
+	}
+
+	for _, s := range forwards {
+		f, err := rule.ForwarderFromURL(s, conf.Strategy.IntFace, 0, 0)
+		if err != nil {
+			return err
+		}
+		f.Close()
+	}
+	return nil
+}
+
+// reload 重新读取配置文件和规则文件，重建改变的转发器组和规则后原子替换当前的规则代理，
+// 并启动新增的监听器、停止删除的监听器，未改变的监听器和已建立的连接不受影响
+func reload() error {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	if stopping {
+		return errors.New("glider is shutting down")
+	}
+
+	log.F("[reload] reloading config")
+
+	conf, err := reloadConfig()
+	if err != nil {
+		return err
+	}
+
+	if err := checkForwarders(conf); err != nil {
+		return err
+	}
+
+	for _, listen := range conf.Listens {
+		if _, ok := servers[listen]; ok {
+			continue
+		}
+		if _, err := proxy.ServerFromURL(listen, rulePxy); err != nil {
+			return err
+		}
+	}
+
+	old := loadedConf
+	if old.DNS != conf.DNS || !reflect.DeepEqual(old.DNSConfig, conf.DNSConfig) {
+		log.Printf("[reload] dns settings changed, restart glider to apply them")
+	}
+	if !slices.Equal(old.Services, conf.Services) {
+		log.Printf("[reload] services changed, restart glider to apply them")
+	}
+	if !reflect.DeepEqual(old.API, conf.API) {
+		log.Printf("[reload] api settings changed, restart glider to apply them")
+	}
+
+	// 未改变的转发器组和转发器会被新的规则代理复用，保留健康状态、当前代理和粘性会话
+	pxy := rulePxy.Load().Renew(conf.Forwards, &conf.Strategy, conf.rules, conf.geoip, conf.list)
+
+	// 将当前状态保存后恢复到新的规则代理，通过 API 添加和禁用的代理在重新加载后仍然有效
+	if err := stateFile.save(); err != nil {
+		log.Printf("[state] failed to save state file: %v", err)
+	}
+	stateFile.apply(pxy)
+
+	if m, err := ipset.NewManager(conf.rules); err == nil {
+		ipsetM.Store(m)
+	}
+
+	if d := apiManager.DNS(); d != nil {
+		d.ReplaceServers(dnsServers(conf.rules))
+	}
+
+	for _, r := range conf.rules {
+		r.IP, r.CIDR, r.Domain = nil, nil, nil
+		r.DomainFull, r.DomainKeyword, r.DomainRegex = nil, nil, nil
+	}
+
+	pxy.Check()
+
+	// 缓存的 DNS 应答不会再次学习 IP，将已学习的 IP 按新规则迁移到新的规则代理
+	pxy.Relearn(rulePxy.Load())
+	oldPxy := rulePxy.Swap(pxy)
+	if loadedConf.API.Listen != "" {
+		apiManager.SetProxy(pxy)
+	}
+	oldPxy.Close()
+
+	for listen := range servers {
+		if !slices.Contains(conf.Listens, listen) {
+			log.F("[reload] stop listener %s", listenerName(listen))
+			stopServer(listen)
+		}
+	}
+
+	for _, listen := range conf.Listens {
+		if _, ok := servers[listen]; !ok {
+			log.F("[reload] start listener %s", listenerName(listen))
+			if err := startServer(listen); err != nil {
+				log.F("[reload] start listener %s error: %v", listenerName(listen), err)
+			}
+		}
+	}
+
+	loadedConf = conf
+	log.F("[reload] config reloaded, %d groups, %d listeners", len(pxy.Groups()), len(servers))
+
+	return nil
+}
+
+// setupDNS 设置DNS服务器使用的规则
+func setupDNS(d *dns.Server, rules []*rule.Config) {
+	d.ReplaceServers(dnsServers(rules))
+	d.AddHandler(rulePxy.AddDomainIP)
+	d.AddHandler(addDomainIPSet)
+}
+
+// handleReload 处理重新加载配置请求
+func handleReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeAPIResponse(w, http.StatusMethodNotAllowed, APIResponse{
+			Success: false,
+			Message: "Method not allowed, use POST",
+		})
+		return
+	}
+
+	if err := reload(); err != nil {
+		log.F("[reload] failed to reload config: %v", err)
+		writeAPIResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Failed to reload config: " + err.Error(),
+		})
+		return
+	}
+
+	writeAPIResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Config reloaded successfully",
+		Groups:  groupInfos(),
+	})
+}
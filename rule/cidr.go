@@ -0,0 +1,147 @@
+package rule
+
+import (
+	"math/bits"
+	"net/netip"
+)
+
+// cidrTrie is a path-compressed binary trie of cidrs with longest prefix match,
+// ipv4 and ipv6 cidrs are stored in separate trees. It is not safe for concurrent
+// writes, the rule proxy only writes it on creation.
+type cidrTrie struct {
+	v4, v6 *cidrNode
+}
+
+// cidrNode is a node of cidrTrie, group is nil for the nodes only used to branch.
+type cidrNode struct {
+	key      addrBits
+	bits     int
+	group    *FwdrGroup
+	children [2]*cidrNode
+}
+
+// addrBits is an ip address as a 128-bit integer, ipv4 addresses use the highest 32 bits.
+type addrBits struct {
+	hi, lo uint64
+}
+
+func newAddrBits(ip netip.Addr) addrBits {
+	if ip.Is4() {
+		b := ip.As4()
+		return addrBits{hi: uint64(b[0])<<56 | uint64(b[1])<<48 | uint64(b[2])<<40 | uint64(b[3])<<32}
+	}
+	b := ip.As16()
+	var a addrBits
+	for i := range 8 {
+		a.hi = a.hi<<8 | uint64(b[i])
+		a.lo = a.lo<<8 | uint64(b[i+8])
+	}
+	return a
+}
+
+// bit returns the bit i of a, counted from the highest bit.
+func (a addrBits) bit(i int) int {
+	if i < 64 {
+		return int(a.hi >> (63 - i) & 1)
+	}
+	return int(a.lo >> (127 - i) & 1)
+}
+
+// commonLen returns the length of the common prefix of a and b.
+func (a addrBits) commonLen(b addrBits) int {
+	if x := a.hi ^ b.hi; x != 0 {
+		return bits.LeadingZeros64(x)
+	}
+	return 64 + bits.LeadingZeros64(a.lo^b.lo)
+}
+
+// mask keeps the highest n bits of a.
+func (a addrBits) mask(n int) addrBits {
+	switch {
+	case n == 0:
+		return addrBits{}
+	case n < 64:
+		return addrBits{hi: a.hi &^ (1<<(64-n) - 1)}
+	case n < 128:
+		return addrBits{hi: a.hi, lo: a.lo &^ (1<<(128-n) - 1)}
+	}
+	return a
+}
+
+// root returns the root of the tree for ip.
+func (t *cidrTrie) root(ip netip.Addr) **cidrNode {
+	if ip.Is4() {
+		return &t.v4
+	}
+	return &t.v6
+}
+
+// insert adds cidr to the trie, the group of an existing cidr is replaced.
+// IPv4-mapped ipv6 cidrs are stored as ipv4 cidrs to match the lookup.
+func (t *cidrTrie) insert(cidr netip.Prefix, group *FwdrGroup) {
+	if addr := cidr.Addr(); addr.Is4In6() && cidr.Bits() >= 96 {
+		cidr = netip.PrefixFrom(addr.Unmap(), cidr.Bits()-96)
+	}
+	cidr = cidr.Masked()
+	key, n := newAddrBits(cidr.Addr()), cidr.Bits()
+
+	for p := t.root(cidr.Addr()); ; {
+		node := *p
+		if node == nil {
+			*p = &cidrNode{key: key, bits: n, group: group}
+			return
+		}
+
+		common := min(key.commonLen(node.key), node.bits, n)
+		switch {
+		case common == node.bits && common == n:
+			// the same cidr
+			node.group = group
+			return
+
+		case common == node.bits:
+			// node contains cidr
+			p = &node.children[key.bit(node.bits)]
+
+		case common == n:
+			// cidr contains node
+			leaf := &cidrNode{key: key, bits: n, group: group}
+			leaf.children[node.key.bit(n)] = node
+			*p = leaf
+			return
+
+		default:
+			// branch at the first different bit
+			branch := &cidrNode{key: key.mask(common), bits: common}
+			branch.children[node.key.bit(common)] = node
+			branch.children[key.bit(common)] = &cidrNode{key: key, bits: n, group: group}
+			*p = branch
+			return
+		}
+	}
+}
+
+// lookup returns the most specific cidr containing ip that accept accepts and
+// its group, group is nil if not found. IPv4-mapped ipv6 addresses are matched
+// as ipv4 addresses.
+func (t *cidrTrie) lookup(ip netip.Addr, accept func(*FwdrGroup) bool) (*FwdrGroup, netip.Prefix) {
+	ip = ip.Unmap()
+	key, n := newAddrBits(ip), ip.BitLen()
+
+	var ret *cidrNode
+	for node := *t.root(ip); node != nil && key.commonLen(node.key) >= node.bits; {
+		if node.group != nil && accept(node.group) {
+			ret = node
+		}
+		if node.bits == n {
+			break
+		}
+		node = node.children[key.bit(node.bits)]
+	}
+
+	if ret == nil {
+		return nil, netip.Prefix{}
+	}
+	cidr, _ := ip.Prefix(ret.bits)
+	return ret.group, cidr
+}
@@ -0,0 +1,134 @@
+package rule
+
+import (
+	"math/rand/v2"
+	"net/netip"
+	"sync"
+	"testing"
+)
+
+func TestCIDRTrieLookup(t *testing.T) {
+	groups := make(map[string]*FwdrGroup)
+	var trie cidrTrie
+	for _, s := range []string{
+		"0.0.0.0/0",
+		"10.0.0.0/8",
+		"10.1.0.0/16",
+		"10.1.2.0/24",
+		"10.1.2.3/32",
+		"192.168.0.0/16",
+		"192.168.1.128/25",
+		"::/0",
+		"2001:db8::/32",
+		"2001:db8:1::/48",
+		"2001:db8:1:2::/64",
+	} {
+		groups[s] = &FwdrGroup{name: s}
+		trie.insert(netip.MustParsePrefix(s), groups[s])
+	}
+
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{"10.1.2.3", "10.1.2.3/32"},
+		{"10.1.2.4", "10.1.2.0/24"},
+		{"10.1.3.1", "10.1.0.0/16"},
+		{"10.2.0.1", "10.0.0.0/8"},
+		{"11.0.0.1", "0.0.0.0/0"},
+		{"192.168.1.200", "192.168.1.128/25"},
+		{"192.168.1.100", "192.168.0.0/16"},
+		{"2001:db8:1:2::1", "2001:db8:1:2::/64"},
+		{"2001:db8:1:3::1", "2001:db8:1::/48"},
+		{"2001:db8:2::1", "2001:db8::/32"},
+		{"2001:db9::1", "::/0"},
+		// ipv4-mapped ipv6 addresses are matched as ipv4 addresses
+		{"::ffff:10.1.2.3", "10.1.2.3/32"},
+		{"::ffff:10.1.2.4", "10.1.2.0/24"},
+		{"::ffff:192.168.1.200", "192.168.1.128/25"},
+	}
+
+	for _, tt := range tests {
+		group, cidr := trie.lookup(netip.MustParseAddr(tt.ip), acceptAll)
+		if group != groups[tt.want] || cidr.String() != tt.want {
+			t.Errorf("lookup(%s) = %v, want %s", tt.ip, cidr, tt.want)
+		}
+	}
+
+	// the most specific accepted cidr wins
+	reject := func(g *FwdrGroup) bool { return g != groups["10.1.2.0/24"] }
+	if group, _ := trie.lookup(netip.MustParseAddr("10.1.2.4"), reject); group != groups["10.1.0.0/16"] {
+		t.Errorf("lookup(10.1.2.4) with 10.1.2.0/24 not accepted = %v, want 10.1.0.0/16", group)
+	}
+
+	// ipv4-mapped ipv6 cidrs are stored as ipv4 cidrs
+	mapped := &FwdrGroup{name: "mapped"}
+	trie.insert(netip.MustParsePrefix("::ffff:172.16.0.0/108"), mapped)
+	for _, ip := range []string{"172.16.1.1", "::ffff:172.31.1.1"} {
+		if group, cidr := trie.lookup(netip.MustParseAddr(ip), acceptAll); group != mapped || cidr.String() != "172.16.0.0/12" {
+			t.Errorf("lookup(%s) = %v, want 172.16.0.0/12", ip, cidr)
+		}
+	}
+	if group, _ := trie.lookup(netip.MustParseAddr("172.32.0.1"), acceptAll); group != groups["0.0.0.0/0"] {
+		t.Errorf("lookup(172.32.0.1) = %v, want 0.0.0.0/0", group)
+	}
+
+	// no cidr matches
+	var empty cidrTrie
+	empty.insert(netip.MustParsePrefix("10.0.0.0/8"), groups["10.0.0.0/8"])
+	if group, _ := empty.lookup(netip.MustParseAddr("11.0.0.1"), acceptAll); group != nil {
+		t.Errorf("lookup(11.0.0.1) = %v, want nil", group)
+	}
+	if group, _ := empty.lookup(netip.MustParseAddr("2001:db8::1"), acceptAll); group != nil {
+		t.Errorf("lookup(2001:db8::1) = %v, want nil", group)
+	}
+}
+
+// randomCIDRs returns n random ipv4 cidrs with prefix lengths from 8 to 32.
+func randomCIDRs(r *rand.Rand, n int) []netip.Prefix {
+	cidrs := make([]netip.Prefix, n)
+	for i := range cidrs {
+		ip := netip.AddrFrom4([4]byte{byte(r.IntN(256)), byte(r.IntN(256)), byte(r.IntN(256)), byte(r.IntN(256))})
+		cidrs[i], _ = ip.Prefix(8 + r.IntN(25))
+	}
+	return cidrs
+}
+
+func BenchmarkCIDRLookup(b *testing.B) {
+	r := rand.New(rand.NewPCG(1, 2))
+	cidrs := randomCIDRs(r, 200000)
+	group := &FwdrGroup{}
+
+	ips := make([]netip.Addr, 1024)
+	for i := range ips {
+		ips[i] = netip.AddrFrom4([4]byte{byte(r.IntN(256)), byte(r.IntN(256)), byte(r.IntN(256)), byte(r.IntN(256))})
+	}
+
+	b.Run("trie", func(b *testing.B) {
+		var trie cidrTrie
+		for _, cidr := range cidrs {
+			trie.insert(cidr, group)
+		}
+
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			trie.lookup(ips[i%len(ips)], acceptAll)
+		}
+	})
+
+	// the linear scan of sync.Map used before the trie
+	b.Run("scan", func(b *testing.B) {
+		var m sync.Map
+		for _, cidr := range cidrs {
+			m.Store(cidr, group)
+		}
+
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			ip := ips[i%len(ips)]
+			m.Range(func(key, value any) bool {
+				return !(key.(netip.Prefix).Contains(ip) && acceptAll(value.(*FwdrGroup)))
+			})
+		}
+	})
+}
@@ -0,0 +1,190 @@
+package rule
+
+import (
+	"net"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/nadoo/glider/pkg/log"
+	"github.com/nadoo/glider/proxy"
+)
+
+// conditions are the request conditions of a rule file, a request matches
+// when it matches any value of every kind of condition set in the file.
+// A kind of condition is set even if all its values are invalid, so that
+// a typo never makes the rule file match all the requests.
+type conditions struct {
+	ports     []portRange
+	networks  []string
+	srcCIDRs  []netip.Prefix
+	listeners []string
+}
+
+// portRange is a range of ports, both ends are included.
+type portRange struct {
+	from, to uint16
+}
+
+// newConditions returns the request conditions of rule file r, or nil if r has none.
+func newConditions(r *Config) *conditions {
+	if len(r.DstPort) == 0 && len(r.Network) == 0 && len(r.SrcIP) == 0 &&
+		len(r.SrcCIDR) == 0 && len(r.Listener) == 0 {
+		return nil
+	}
+
+	c := &conditions{}
+
+	if len(r.DstPort) > 0 {
+		c.ports = make([]portRange, 0, len(r.DstPort))
+		for _, s := range r.DstPort {
+			pr, err := parsePortRange(s)
+			if err != nil {
+				log.F("[rule] parse dstport error: %s", err)
+				continue
+			}
+			c.ports = append(c.ports, pr)
+		}
+	}
+
+	if len(r.Network) > 0 {
+		c.networks = make([]string, 0, len(r.Network))
+		for _, s := range r.Network {
+			c.networks = append(c.networks, strings.ToLower(strings.TrimSpace(s)))
+		}
+	}
+
+	if len(r.SrcIP) > 0 || len(r.SrcCIDR) > 0 {
+		c.srcCIDRs = make([]netip.Prefix, 0, len(r.SrcIP)+len(r.SrcCIDR))
+		for _, s := range r.SrcIP {
+			ip, err := netip.ParseAddr(s)
+			if err != nil {
+				log.F("[rule] parse srcip error: %s", err)
+				continue
+			}
+			c.srcCIDRs = append(c.srcCIDRs, netip.PrefixFrom(ip.Unmap(), ip.Unmap().BitLen()))
+		}
+		for _, s := range r.SrcCIDR {
+			cidr, err := netip.ParsePrefix(s)
+			if err != nil {
+				log.F("[rule] parse srccidr error: %s", err)
+				continue
+			}
+			c.srcCIDRs = append(c.srcCIDRs, cidr.Masked())
+		}
+	}
+
+	if len(r.Listener) > 0 {
+		c.listeners = slices.Clone(r.Listener)
+	}
+
+	return c
+}
+
+// parsePortRange parses a port or a port range like 8000-9000.
+func parsePortRange(s string) (portRange, error) {
+	from, to, ok := strings.Cut(strings.TrimSpace(s), "-")
+	if !ok {
+		to = from
+	}
+
+	f, err := strconv.ParseUint(from, 10, 16)
+	if err != nil {
+		return portRange{}, err
+	}
+
+	t, err := strconv.ParseUint(to, 10, 16)
+	if err != nil {
+		return portRange{}, err
+	}
+
+	return portRange{uint16(min(f, t)), uint16(max(f, t))}, nil
+}
+
+// match reports whether the request matches the conditions.
+func (c *conditions) match(meta *proxy.Metadata, network, dstAddr string) bool {
+	if c.ports != nil && !c.matchPort(dstAddr) {
+		return false
+	}
+
+	if c.networks != nil && !slices.Contains(c.networks, strings.TrimRight(network, "46")) {
+		return false
+	}
+
+	if c.srcCIDRs != nil && !c.matchSrc(meta) {
+		return false
+	}
+
+	if c.listeners != nil && !c.matchListener(meta) {
+		return false
+	}
+
+	return true
+}
+
+func (c *conditions) matchPort(dstAddr string) bool {
+	port, ok := dstPort(dstAddr)
+	return ok && slices.ContainsFunc(c.ports, func(pr portRange) bool { return pr.contains(port) })
+}
+
+func (c *conditions) matchSrc(meta *proxy.Metadata) bool {
+	ip, ok := srcIP(meta)
+	return ok && slices.ContainsFunc(c.srcCIDRs, func(cidr netip.Prefix) bool {
+		return cidr.Contains(ip)
+	})
+}
+
+// contains reports whether port is in the range.
+func (pr portRange) contains(port uint16) bool {
+	return port >= pr.from && port <= pr.to
+}
+
+// dstPort returns the port of dstAddr.
+func dstPort(dstAddr string) (uint16, bool) {
+	_, port, err := net.SplitHostPort(dstAddr)
+	if err != nil {
+		return 0, false
+	}
+
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return 0, false
+	}
+
+	return uint16(p), true
+}
+
+// srcIP returns the ip of the client in meta.
+func srcIP(meta *proxy.Metadata) (netip.Addr, bool) {
+	if meta == nil || meta.SrcAddr == nil {
+		return netip.Addr{}, false
+	}
+
+	// String works with nil *net.TCPAddr and *net.UDPAddr too.
+	src, err := netip.ParseAddrPort(meta.SrcAddr.String())
+	if err != nil {
+		return netip.Addr{}, false
+	}
+
+	return src.Addr().Unmap(), true
+}
+
+// matchListener matches the listener name like socks5://:1080 or its address like :1080.
+func (c *conditions) matchListener(meta *proxy.Metadata) bool {
+	if meta == nil || meta.Listener == "" {
+		return false
+	}
+
+	// the address of the first listener in the chain, without user info and parameters
+	first, _, _ := strings.Cut(meta.Listener, ",")
+	_, addr, _ := strings.Cut(first, "://")
+	addr, _, _ = strings.Cut(addr, "?")
+	if i := strings.LastIndexByte(addr, '@'); i >= 0 {
+		addr = addr[i+1:]
+	}
+
+	return slices.ContainsFunc(c.listeners, func(l string) bool {
+		return l == meta.Listener || l == addr
+	})
+}
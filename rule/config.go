@@ -17,9 +17,19 @@ type Config struct {
 	DNSServers []string
 	IPSet      string
 
-	Domain []string
-	IP     []string
-	CIDR   []string
+	Domain        []string
+	DomainFull    []string
+	DomainKeyword []string
+	DomainRegex   []string
+	IP            []string
+	CIDR          []string
+	GeoIP         []string
+
+	DstPort  []string
+	Network  []string
+	SrcIP    []string
+	SrcCIDR  []string
+	Listener []string
 }
 
 // Strategy configurations.
@@ -35,6 +45,14 @@ type Strategy struct {
 	DialTimeout         int
 	RelayTimeout        int
 	IntFace             string
+
+	// rotation policies of the current forwarder, api strategy only
+	RotateInterval  int
+	RotateConns     int
+	RotateOnFailure bool
+
+	// idle time before a sticky session expires, api strategy only
+	SessionTTL int
 }
 
 // NewConfFromFile returns a new config from file.
@@ -54,13 +72,27 @@ func NewConfFromFile(ruleFile string) (*Config, error) {
 	f.IntVar(&p.Strategy.DialTimeout, "dialtimeout", 3, "dial timeout(seconds)")
 	f.IntVar(&p.Strategy.RelayTimeout, "relaytimeout", 0, "relay timeout(seconds)")
 	f.StringVar(&p.Strategy.IntFace, "interface", "", "source ip or source interface")
+	f.IntVar(&p.Strategy.RotateInterval, "rotateinterval", 0, "rotate the current forwarder every N seconds, only used in api mode")
+	f.IntVar(&p.Strategy.RotateConns, "rotateconns", 0, "rotate the current forwarder every N new connections, only used in api mode")
+	f.BoolVar(&p.Strategy.RotateOnFailure, "rotateonfailure", false, "rotate the current forwarder when it failed to dial, only used in api mode")
+	f.IntVar(&p.Strategy.SessionTTL, "sessionttl", 600, "sticky session expires when not used for N seconds, 0 means never, only used in api mode")
 
 	f.StringSliceUniqVar(&p.DNSServers, "dnsserver", nil, "remote dns server")
 	f.StringVar(&p.IPSet, "ipset", "", "ipset NAME, will create 2 sets: NAME for ipv4 and NAME6 for ipv6")
 
 	f.StringSliceVar(&p.Domain, "domain", nil, "domain")
+	f.StringSliceVar(&p.DomainFull, "domain-full", nil, "domain, exact match only")
+	f.StringSliceVar(&p.DomainKeyword, "domain-keyword", nil, "keyword in domain")
+	f.StringSliceVar(&p.DomainRegex, "domain-regex", nil, "regular expression of domain")
 	f.StringSliceVar(&p.IP, "ip", nil, "ip")
 	f.StringSliceVar(&p.CIDR, "cidr", nil, "cidr")
+	f.StringSliceVar(&p.GeoIP, "geoip", nil, "country code of ip in the geoip database, use !CODE to match ips of other countries")
+
+	f.StringSliceVar(&p.DstPort, "dstport", nil, "destination port or port range of request, e.g. 22 or 8000-9000")
+	f.StringSliceVar(&p.Network, "network", nil, "network of request: tcp|udp")
+	f.StringSliceVar(&p.SrcIP, "srcip", nil, "source ip of request")
+	f.StringSliceVar(&p.SrcCIDR, "srccidr", nil, "source cidr of request")
+	f.StringSliceVar(&p.Listener, "listener", nil, "listener which accepted the request, format: ADDRESS or SCHEME://ADDRESS, e.g. :1080 or socks5://:1080")
 
 	err := f.Parse()
 	if err != nil {
@@ -70,6 +102,12 @@ func NewConfFromFile(ruleFile string) (*Config, error) {
 	return p, err
 }
 
+// hasDestination reports whether the rule file has any destination rules.
+func (c *Config) hasDestination() bool {
+	return len(c.Domain) > 0 || len(c.DomainFull) > 0 || len(c.DomainKeyword) > 0 ||
+		len(c.DomainRegex) > 0 || len(c.IP) > 0 || len(c.CIDR) > 0 || len(c.GeoIP) > 0
+}
+
 // ListDir returns file list named with suffix in dirPth.
 func ListDir(dirPth string, suffix string) (files []string, err error) {
 	files = make([]string, 0, 10)
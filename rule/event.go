@@ -0,0 +1,75 @@
+package rule
+
+import (
+	"net"
+	"time"
+)
+
+// EventType is the type of a forwarder event.
+type EventType string
+
+// Forwarder event types.
+const (
+	EventEnabled  EventType = "enabled"
+	EventDisabled EventType = "disabled"
+	EventCheck    EventType = "check"
+	EventDial     EventType = "dial"
+)
+
+// Event is an event of a forwarder in group.
+type Event struct {
+	Type      EventType
+	Group     string
+	Forwarder *Forwarder
+	Elapsed   time.Duration // elapsed time of health check, EventCheck only
+	Err       error         // error of health check or dial, EventCheck and EventDial only
+}
+
+// EventHandler function will be called when a forwarder in group changed
+// its status, finished a health check or dialed a new connection, it should
+// not block.
+type EventHandler func(Event)
+
+// Watch adds an event handler to the group.
+func (p *FwdrGroup) Watch(h EventHandler) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.handlers = append(p.handlers, h)
+}
+
+// emit calls event handlers, it must be called without holding p.mu.
+func (p *FwdrGroup) emit(ev Event) {
+	if ev.Forwarder.Closed() {
+		return
+	}
+
+	p.mu.RLock()
+	handlers := p.handlers
+	p.mu.RUnlock()
+
+	ev.Group = p.name
+	for _, h := range handlers {
+		h(ev)
+	}
+}
+
+// eventDialer is a forwarder returned by NextDialerMeta, it emits the dial
+// events of the group as the servers dial with it directly.
+type eventDialer struct {
+	*Forwarder
+	group *FwdrGroup
+}
+
+// Dial connects to the address addr on the network net via the forwarder.
+func (d *eventDialer) Dial(network, addr string) (net.Conn, error) {
+	c, err := d.Forwarder.Dial(network, addr)
+	d.group.emitDial(d.Forwarder, err)
+	return c, err
+}
+
+// DialUDP connects to the given address via the forwarder.
+func (d *eventDialer) DialUDP(network, addr string) (net.PacketConn, error) {
+	pc, err := d.Forwarder.DialUDP(network, addr)
+	d.group.emitDial(d.Forwarder, err)
+	return pc, err
+}
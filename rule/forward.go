@@ -5,6 +5,7 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -23,15 +24,22 @@ type Forwarder struct {
 	priority    uint32
 	maxFailures uint32 // maxfailures to set to Disabled
 	disabled    uint32
+	suspended   atomic.Bool // disabled manually
 	failures    uint32
 	latency     int64
-	intface     string // local interface or ip address
+	checkOK     atomic.Uint64
+	checkFailed atomic.Uint64
+	intface     string                 // local interface or ip address
+	tag         atomic.Pointer[string] // user defined name, used to select the forwarder by api
+	handlerMu   sync.RWMutex
 	handlers    []StatusHandler
+	done        chan struct{}
+	closeOnce   sync.Once
 }
 
 // ForwarderFromURL parses `forward=` command value and returns a new forwarder.
 func ForwarderFromURL(s, intface string, dialTimeout, relayTimeout time.Duration) (f *Forwarder, err error) {
-	f = &Forwarder{url: s}
+	f = &Forwarder{url: s, done: make(chan struct{})}
 
 	ss := strings.Split(s, "#")
 	if len(ss) > 1 {
@@ -81,7 +89,7 @@ func DirectForwarder(intface string, dialTimeout, relayTimeout time.Duration) (*
 	if err != nil {
 		return nil, err
 	}
-	return &Forwarder{Dialer: d, addr: d.Addr()}, nil
+	return &Forwarder{Dialer: d, addr: d.Addr(), done: make(chan struct{})}, nil
 }
 
 func (f *Forwarder) parseOption(option string) error {
@@ -98,6 +106,7 @@ func (f *Forwarder) parseOption(option string) error {
 	f.SetPriority(uint32(priority))
 
 	f.intface = query.Get("interface")
+	f.SetTag(query.Get("tag"))
 
 	return err
 }
@@ -113,6 +122,39 @@ func (f *Forwarder) URL() string {
 	return f.url
 }
 
+// Tag returns the forwarder's tag.
+func (f *Forwarder) Tag() string {
+	if tag := f.tag.Load(); tag != nil {
+		return *tag
+	}
+	return ""
+}
+
+// SetTag sets the forwarder's tag.
+func (f *Forwarder) SetTag(tag string) {
+	f.tag.Store(&tag)
+}
+
+// Close marks the forwarder as removed, it stops the health checking of forwarder.
+func (f *Forwarder) Close() {
+	f.closeOnce.Do(func() { close(f.done) })
+}
+
+// Done returns a channel that's closed when the forwarder is removed.
+func (f *Forwarder) Done() <-chan struct{} {
+	return f.done
+}
+
+// Closed returns whether the forwarder has been removed.
+func (f *Forwarder) Closed() bool {
+	select {
+	case <-f.done:
+		return true
+	default:
+		return false
+	}
+}
+
 // Dial dials to addr and returns conn.
 func (f *Forwarder) Dial(network, addr string) (c net.Conn, err error) {
 	c, err = f.Dialer.Dial(network, addr)
@@ -144,15 +186,37 @@ func (f *Forwarder) IncFailures() {
 
 // AddHandler adds a custom handler to handle the status change event.
 func (f *Forwarder) AddHandler(h StatusHandler) {
+	f.handlerMu.Lock()
+	defer f.handlerMu.Unlock()
 	f.handlers = append(f.handlers, h)
 }
 
-// Enable the forwarder.
+// resetHandlers removes all the status handlers, it's called when the
+// forwarder is moved to a new group on reload.
+func (f *Forwarder) resetHandlers() {
+	f.handlerMu.Lock()
+	defer f.handlerMu.Unlock()
+	f.handlers = nil
+}
+
+// notify calls the status handlers.
+func (f *Forwarder) notify() {
+	f.handlerMu.RLock()
+	handlers := f.handlers
+	f.handlerMu.RUnlock()
+
+	for _, h := range handlers {
+		h(f)
+	}
+}
+
+// Enable the forwarder, it does nothing if the forwarder is suspended.
 func (f *Forwarder) Enable() {
+	if f.suspended.Load() {
+		return
+	}
 	if atomic.CompareAndSwapUint32(&f.disabled, 1, 0) {
-		for _, h := range f.handlers {
-			h(f)
-		}
+		f.notify()
 	}
 	atomic.StoreUint32(&f.failures, 0)
 }
@@ -160,12 +224,26 @@ func (f *Forwarder) Enable() {
 // Disable the forwarder.
 func (f *Forwarder) Disable() {
 	if atomic.CompareAndSwapUint32(&f.disabled, 0, 1) {
-		for _, h := range f.handlers {
-			h(f)
-		}
+		f.notify()
 	}
 }
 
+// Suspend disables the forwarder manually, it can not be enabled by health
+// checks or successful dials until Resume is called.
+func (f *Forwarder) Suspend() {
+	f.suspended.Store(true)
+	f.Disable()
+}
+
+// Resume cancels the manual disabling and enables the forwarder.
+func (f *Forwarder) Resume() {
+	f.suspended.Store(false)
+	f.Enable()
+}
+
+// Suspended returns whether the forwarder is disabled manually.
+func (f *Forwarder) Suspended() bool { return f.suspended.Load() }
+
 // Enabled returns the status of forwarder.
 func (f *Forwarder) Enabled() bool {
 	return !isTrue(atomic.LoadUint32(&f.disabled))
@@ -195,6 +273,20 @@ func (f *Forwarder) SetMaxFailures(l uint32) {
 	atomic.StoreUint32(&f.maxFailures, l)
 }
 
+// RecordCheck records a health check result of forwarder.
+func (f *Forwarder) RecordCheck(success bool) {
+	if success {
+		f.checkOK.Add(1)
+		return
+	}
+	f.checkFailed.Add(1)
+}
+
+// CheckResults returns the number of succeeded and failed health checks of forwarder.
+func (f *Forwarder) CheckResults() (success, failure uint64) {
+	return f.checkOK.Load(), f.checkFailed.Load()
+}
+
 // Latency returns the latency of forwarder.
 func (f *Forwarder) Latency() int64 {
 	return atomic.LoadInt64(&f.latency)
@@ -1,11 +1,15 @@
 package rule
 
 import (
+	"container/list"
 	"errors"
+	"fmt"
 	"hash/fnv"
+	"math/rand/v2"
 	"net"
 	"net/url"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
@@ -16,19 +20,6 @@ import (
 	"github.com/nadoo/glider/proxy"
 )
 
-// APIProxyManager 接口定义API代理管理器
-type APIProxyManager interface {
-	GetCurrentProxy() *Forwarder
-}
-
-// 全局API管理器接口
-var globalAPIManager APIProxyManager
-
-// SetAPIManager 设置全局API管理器
-func SetAPIManager(manager APIProxyManager) {
-	globalAPIManager = manager
-}
-
 // forwarder slice orderd by priority.
 type priSlice []*Forwarder
 
@@ -39,6 +30,9 @@ func (p priSlice) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
 // FwdrGroup is a forwarder group.
 type FwdrGroup struct {
 	name     string
+	rulePath string
+	forwards []string // forward urls in config
+	strategy string
 	config   *Strategy
 	fwdrs    priSlice
 	avail    []*Forwarder // available forwarders
@@ -46,18 +40,42 @@ type FwdrGroup struct {
 	index    uint32
 	priority uint32
 	next     func(addr string) *Forwarder
+
+	checking bool    // whether Check has been called
+	checker  Checker // nil if health checking is disabled
+
+	current atomic.Pointer[Forwarder] // api 模式下当前选中的转发器
+
+	sessMu   sync.Mutex
+	sessions map[string]*list.Element // sticky sessions in api mode, keyed by username
+	sessLRU  *list.List               // of *Session, the most recently used at front
+
+	done      chan struct{} // closed when the group is closed
+	closeOnce sync.Once
+
+	handlers []EventHandler
 }
 
 // NewFwdrGroup returns a new forward group.
 func NewFwdrGroup(rulePath string, s []string, c *Strategy) *FwdrGroup {
+	return renewFwdrGroup(nil, rulePath, s, c)
+}
+
+// renewFwdrGroup returns a new forward group to replace old, the forwarders of
+// old with the same url and dial settings are reused with their status, old can be nil.
+func renewFwdrGroup(old *FwdrGroup, rulePath string, s []string, c *Strategy) *FwdrGroup {
 	var fwdrs []*Forwarder
 	for _, chain := range s {
-		fwdr, err := ForwarderFromURL(chain, c.IntFace,
-			time.Duration(c.DialTimeout)*time.Second, time.Duration(c.RelayTimeout)*time.Second)
+		if fwdr := old.reusableForwarder(chain, c); fwdr != nil {
+			fwdr.resetHandlers()
+			fwdrs = append(fwdrs, fwdr)
+			continue
+		}
+
+		fwdr, err := newForwarder(chain, c)
 		if err != nil {
 			log.Fatal(err)
 		}
-		fwdr.SetMaxFailures(uint32(c.MaxFailures))
 		fwdrs = append(fwdrs, fwdr)
 	}
 
@@ -69,26 +87,82 @@ func NewFwdrGroup(rulePath string, s []string, c *Strategy) *FwdrGroup {
 			log.Fatal(err)
 		}
 		fwdrs = append(fwdrs, direct)
-		c.Strategy = "rr"
+
+		// the strategy may be shared with other groups
+		rr := *c
+		rr.Strategy = "rr"
+		c = &rr
+	}
+
+	p := newFwdrGroup(groupName(rulePath), fwdrs, c)
+	p.rulePath = rulePath
+	p.forwards = slices.Clone(s)
+	return p
+}
+
+// groupName returns the name of the group of rule file rulePath.
+func groupName(rulePath string) string {
+	return strings.TrimSuffix(filepath.Base(rulePath), filepath.Ext(rulePath))
+}
+
+// unchanged reports whether the group of rule file rulePath created with
+// forward urls s and strategy c would be the same as p.
+func (p *FwdrGroup) unchanged(rulePath string, s []string, c *Strategy) bool {
+	return p.rulePath == rulePath && slices.Equal(p.forwards, s) && *p.config == *c
+}
+
+// reusableForwarder returns the forwarder of p with forward url s if the
+// forwarder created by strategy c would be the same, or nil.
+func (p *FwdrGroup) reusableForwarder(s string, c *Strategy) *Forwarder {
+	if p == nil || p.config.IntFace != c.IntFace || p.config.DialTimeout != c.DialTimeout ||
+		p.config.RelayTimeout != c.RelayTimeout || p.config.MaxFailures != c.MaxFailures {
+		return nil
 	}
 
-	name := strings.TrimSuffix(filepath.Base(rulePath), filepath.Ext(rulePath))
-	return newFwdrGroup(name, fwdrs, c)
+	for _, f := range p.GetForwarders() {
+		if f.URL() == s && !f.Closed() {
+			return f
+		}
+	}
+	return nil
+}
+
+// newForwarder returns a new forwarder configured by the strategy of group.
+func newForwarder(s string, c *Strategy) (*Forwarder, error) {
+	fwdr, err := ForwarderFromURL(s, c.IntFace,
+		time.Duration(c.DialTimeout)*time.Second, time.Duration(c.RelayTimeout)*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	fwdr.SetMaxFailures(uint32(c.MaxFailures))
+	return fwdr, nil
 }
 
 // newFwdrGroup returns a new FwdrGroup.
 func newFwdrGroup(name string, fwdrs []*Forwarder, c *Strategy) *FwdrGroup {
-	p := &FwdrGroup{name: name, fwdrs: fwdrs, config: c}
+	p := &FwdrGroup{name: name, strategy: c.Strategy, fwdrs: fwdrs, config: c, done: make(chan struct{})}
 	sort.Sort(p.fwdrs)
 
 	p.init()
+	p.setScheduler()
+
+	for _, f := range fwdrs {
+		f.AddHandler(p.onStatusChanged)
+	}
+
+	return p
+}
+
+// setScheduler sets the scheduler according to the strategy and the number of forwarders.
+func (p *FwdrGroup) setScheduler() {
+	name, c := p.name, p.config
 
 	// default scheduler
 	p.next = p.scheduleRR
 
 	// if there're more than 1 forwarders, we care about the strategy.
-	if count := len(fwdrs); count > 1 {
-		switch c.Strategy {
+	if count := len(p.fwdrs); count > 1 {
+		switch p.strategy {
 		case "rr":
 			p.next = p.scheduleRR
 			log.F("[strategy] %s: %d forwarders forward in round robin mode.", name, count)
@@ -109,18 +183,13 @@ func newFwdrGroup(name string, fwdrs []*Forwarder, c *Strategy) *FwdrGroup {
 			log.F("[strategy] %s: not supported forward mode '%s', use round robin mode for %d forwarders.", name, c.Strategy, count)
 		}
 	}
-
-	for _, f := range fwdrs {
-		f.AddHandler(p.onStatusChanged)
-	}
-
-	return p
 }
 
 // Dial connects to the address addr on the network net.
 func (p *FwdrGroup) Dial(network, addr string) (net.Conn, proxy.Dialer, error) {
 	nd := p.NextDialer(addr)
 	c, err := nd.Dial(network, addr)
+	p.emitDial(nd, err)
 	return c, nd, err
 }
 
@@ -128,9 +197,17 @@ func (p *FwdrGroup) Dial(network, addr string) (net.Conn, proxy.Dialer, error) {
 func (p *FwdrGroup) DialUDP(network, addr string) (pc net.PacketConn, dialer proxy.UDPDialer, err error) {
 	nd := p.NextDialer(addr)
 	pc, err = nd.DialUDP(network, addr)
+	p.emitDial(nd, err)
 	return pc, nd, err
 }
 
+// emitDial emits the dial event of a new connection via dialer.
+func (p *FwdrGroup) emitDial(dialer proxy.Dialer, err error) {
+	if fwdr, ok := dialer.(*Forwarder); ok {
+		p.emit(Event{Type: EventDial, Forwarder: fwdr, Err: err})
+	}
+}
+
 // NextDialer returns the next dialer.
 func (p *FwdrGroup) NextDialer(dstAddr string) proxy.Dialer {
 	p.mu.RLock()
@@ -143,6 +220,31 @@ func (p *FwdrGroup) NextDialer(dstAddr string) proxy.Dialer {
 	return p.next(dstAddr)
 }
 
+// peekForwarder returns the forwarder NextDialer would return now, without
+// advancing the round robin index.
+func (p *FwdrGroup) peekForwarder(dstAddr string) *Forwarder {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if len(p.avail) == 0 {
+		return p.fwdrs[(atomic.LoadUint32(&p.index)+1)%uint32(len(p.fwdrs))]
+	}
+
+	if len(p.fwdrs) > 1 {
+		switch p.strategy {
+		case "ha", "lha", "dh":
+			return p.next(dstAddr)
+		case "api":
+			// no proxy is auto selected here, unlike scheduleAPI
+			if f := p.current.Load(); f != nil && slices.Contains(p.avail, f) {
+				return f
+			}
+		}
+	}
+
+	return p.avail[(atomic.LoadUint32(&p.index)+1)%uint32(len(p.avail))]
+}
+
 // Priority returns the active priority of dialer.
 func (p *FwdrGroup) Priority() uint32 { return atomic.LoadUint32(&p.priority) }
 
@@ -174,9 +276,20 @@ func (p *FwdrGroup) init() {
 
 // onStatusChanged will be called when fwdr's status changed.
 func (p *FwdrGroup) onStatusChanged(fwdr *Forwarder) {
+	ev := Event{Type: EventDisabled, Forwarder: fwdr}
+	if fwdr.Enabled() {
+		ev.Type = EventEnabled
+	}
+	defer p.emit(ev) // after p.mu unlocked
+
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
+	// the forwarder has been removed from group
+	if fwdr.Closed() {
+		return
+	}
+
 	if fwdr.Enabled() {
 		if fwdr.Priority() == p.Priority() {
 			p.avail = append(p.avail, fwdr)
@@ -201,49 +314,134 @@ func (p *FwdrGroup) onStatusChanged(fwdr *Forwarder) {
 	}
 }
 
-// Check runs the forwarder checks.
+// Close closes all forwarders in group to stop health checking them.
+func (p *FwdrGroup) Close() { p.close(nil) }
+
+// close closes the forwarders in group except the ones in keep, which are
+// reused by another group.
+func (p *FwdrGroup) close(keep map[*Forwarder]bool) {
+	p.closeOnce.Do(func() { close(p.done) })
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	for _, f := range p.fwdrs {
+		if !keep[f] {
+			f.Close()
+		}
+	}
+}
+
+// Check runs the forwarder checks, it does nothing if the checks are running.
 func (p *FwdrGroup) Check() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.checking {
+		return
+	}
+	p.checking = true
+	p.startCheck()
+}
+
+// startCheck starts checking all the forwarders, must be called with p.mu held.
+func (p *FwdrGroup) startCheck() {
 	if len(p.fwdrs) == 1 {
 		log.F("[group] %s: only 1 forwarder found, disable health checking", p.name)
 		return
 	}
 
-	if !strings.Contains(p.config.Check, "://") {
-		p.config.Check += "://"
+	checker, err := p.newChecker()
+	if err != nil {
+		log.F("[group] %s: %s, disable health checking", p.name, err)
+		return
+	}
+
+	log.F("[group] %s: using check config: %s", p.name, p.config.Check)
+
+	p.checker = checker
+	for i := range p.fwdrs {
+		go p.check(p.fwdrs[i], checker)
+	}
+}
+
+// newChecker returns the health checker specified by the check config.
+func (p *FwdrGroup) newChecker() (Checker, error) {
+	check := p.config.Check
+	if !strings.Contains(check, "://") {
+		check += "://"
 	}
 
-	u, err := url.Parse(p.config.Check)
+	u, err := url.Parse(check)
 	if err != nil {
-		log.F("[group] %s: parse check config error: %s, disable health checking", p.name, err)
-		return
+		return nil, fmt.Errorf("parse check config error: %s", err)
 	}
 
 	addr := u.Host
 	timeout := time.Duration(p.config.CheckTimeout) * time.Second
 
-	var checker Checker
 	switch u.Scheme {
 	case "tcp":
-		checker = newTcpChecker(addr, timeout)
+		return newTcpChecker(addr, timeout), nil
 	case "http", "https":
 		expect := "HTTP" // default: check the first 4 chars in response
 		params, _ := url.ParseQuery(u.Fragment)
 		if ex := params.Get("expect"); ex != "" {
 			expect = ex
 		}
-		checker = newHttpChecker(addr, u.RequestURI(), expect, timeout, u.Scheme == "https")
+		return newHttpChecker(addr, u.RequestURI(), expect, timeout, u.Scheme == "https"), nil
 	case "file":
-		checker = newFileChecker(u.Host + u.Path)
+		return newFileChecker(u.Host + u.Path), nil
 	default:
-		log.F("[group] %s: unknown scheme in check config `%s`, disable health checking", p.name, p.config.Check)
-		return
+		return nil, fmt.Errorf("unknown scheme in check config `%s`", p.config.Check)
 	}
+}
 
-	log.F("[group] %s: using check config: %s", p.name, p.config.Check)
+// CheckResult is the result of an on-demand health check.
+type CheckResult struct {
+	Forwarder *Forwarder
+	Elapsed   time.Duration
+	Err       error
+}
 
-	for i := range p.fwdrs {
-		go p.check(p.fwdrs[i], checker)
+// CheckForwarder checks fwdr immediately and enables or disables it by the
+// result as the checking loop does, it works even if health checking is
+// disabled because the group has only 1 forwarder.
+func (p *FwdrGroup) CheckForwarder(fwdr *Forwarder) (time.Duration, error) {
+	p.mu.RLock()
+	checker := p.checker
+	p.mu.RUnlock()
+
+	if checker == nil {
+		var err error
+		if checker, err = p.newChecker(); err != nil {
+			return 0, err
+		}
+	}
+
+	elapsed, err := checker.Check(fwdr)
+	p.applyCheck(fwdr, elapsed, err)
+	return elapsed, err
+}
+
+// CheckForwarders checks all the forwarders in group concurrently and
+// returns the results in the order of forwarders.
+func (p *FwdrGroup) CheckForwarders() []CheckResult {
+	fwdrs := p.GetForwarders()
+	results := make([]CheckResult, len(fwdrs))
+
+	var wg sync.WaitGroup
+	for i, f := range fwdrs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			elapsed, err := p.CheckForwarder(f)
+			results[i] = CheckResult{Forwarder: f, Elapsed: elapsed, Err: err}
+		}()
 	}
+	wg.Wait()
+
+	return results
 }
 
 func (p *FwdrGroup) check(fwdr *Forwarder, checker Checker) {
@@ -251,7 +449,14 @@ func (p *FwdrGroup) check(fwdr *Forwarder, checker Checker) {
 	intval := time.Duration(p.config.CheckInterval) * time.Second
 
 	for {
-		time.Sleep(intval * time.Duration(wait))
+		select {
+		case <-fwdr.Done():
+			log.F("[check] %s: %s(%d), closed, stop checking", p.name, fwdr.Addr(), fwdr.Priority())
+			return
+		case <-p.done:
+			return
+		case <-time.After(intval * time.Duration(wait)):
+		}
 
 		// check all forwarders at least one time
 		if wait > 0 && (fwdr.Priority() < p.Priority()) {
@@ -263,11 +468,10 @@ func (p *FwdrGroup) check(fwdr *Forwarder, checker Checker) {
 		}
 
 		elapsed, err := checker.Check(fwdr)
+		p.applyCheck(fwdr, elapsed, err)
 		if err != nil {
 			if errors.Is(err, proxy.ErrNotSupported) {
-				fwdr.SetMaxFailures(0)
-				log.F("[check] %s: %s(%d), %s, stop checking", p.name, fwdr.Addr(), fwdr.Priority(), err)
-				fwdr.Enable()
+				log.F("[check] %s: %s(%d), stop checking", p.name, fwdr.Addr(), fwdr.Priority())
 				break
 			}
 
@@ -275,20 +479,38 @@ func (p *FwdrGroup) check(fwdr *Forwarder, checker Checker) {
 			if wait > 16 {
 				wait = 16
 			}
-
-			log.F("[check] %s: %s(%d), FAILED. error: %s", p.name, fwdr.Addr(), fwdr.Priority(), err)
-			fwdr.Disable()
 			continue
 		}
 
 		wait = 1
-		p.setLatency(fwdr, elapsed)
-		log.F("[check] %s: %s(%d), SUCCESS. Elapsed: %dms, Latency: %dms.",
-			p.name, fwdr.Addr(), fwdr.Priority(), elapsed.Milliseconds(), time.Duration(fwdr.Latency()).Milliseconds())
-		fwdr.Enable()
 	}
 }
 
+// applyCheck records the check result of fwdr and enables or disables it.
+func (p *FwdrGroup) applyCheck(fwdr *Forwarder, elapsed time.Duration, err error) {
+	if err != nil {
+		if errors.Is(err, proxy.ErrNotSupported) {
+			fwdr.SetMaxFailures(0)
+			log.F("[check] %s: %s(%d), %s", p.name, fwdr.Addr(), fwdr.Priority(), err)
+			fwdr.Enable()
+			return
+		}
+
+		log.F("[check] %s: %s(%d), FAILED. error: %s", p.name, fwdr.Addr(), fwdr.Priority(), err)
+		fwdr.RecordCheck(false)
+		p.emit(Event{Type: EventCheck, Forwarder: fwdr, Elapsed: elapsed, Err: err})
+		fwdr.Disable()
+		return
+	}
+
+	fwdr.RecordCheck(true)
+	p.setLatency(fwdr, elapsed)
+	p.emit(Event{Type: EventCheck, Forwarder: fwdr, Elapsed: elapsed})
+	log.F("[check] %s: %s(%d), SUCCESS. Elapsed: %dms, Latency: %dms.",
+		p.name, fwdr.Addr(), fwdr.Priority(), elapsed.Milliseconds(), time.Duration(fwdr.Latency()).Milliseconds())
+	fwdr.Enable()
+}
+
 func (p *FwdrGroup) setLatency(fwdr *Forwarder, elapsed time.Duration) {
 	newLatency := int64(elapsed)
 	if cnt := p.config.CheckLatencySamples; cnt > 1 {
@@ -335,29 +557,132 @@ func (p *FwdrGroup) scheduleDH(dstAddr string) *Forwarder {
 
 // API Controlled Mode.
 func (p *FwdrGroup) scheduleAPI(dstAddr string) *Forwarder {
-	// 调用全局API管理器获取当前代理
-	if globalAPIManager != nil {
-		if currentProxy := globalAPIManager.GetCurrentProxy(); currentProxy != nil {
-			// 检查当前代理是否在可用列表中
-			for _, proxy := range p.avail {
-				if proxy.Addr() == currentProxy.Addr() {
-					return proxy
-				}
+	// 使用本组当前选中的代理
+	if currentProxy := p.autoSelect(); currentProxy != nil {
+		// 检查当前代理是否在可用列表中
+		for _, proxy := range p.avail {
+			if proxy == currentProxy {
+				return proxy
 			}
 		}
 	}
-	
-	// 如果API管理器不可用或当前代理不在可用列表中，fallback到轮询模式
+
+	// 如果当前代理不在可用列表中，fallback到轮询模式
 	return p.scheduleRR(dstAddr)
 }
 
+// Name returns the name of the group.
+func (p *FwdrGroup) Name() string { return p.name }
+
+// Strategy returns the forward strategy of the group.
+func (p *FwdrGroup) Strategy() string { return p.strategy }
+
+// Config returns the strategy config of the group.
+func (p *FwdrGroup) Config() *Strategy { return p.config }
+
 // GetForwarders 获取转发器列表
 func (p *FwdrGroup) GetForwarders() []*Forwarder {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
-	
+
 	// 返回所有转发器的副本
 	result := make([]*Forwarder, len(p.fwdrs))
 	copy(result, p.fwdrs)
 	return result
 }
+
+// AddForwarder parses the forward url and adds a new forwarder to the group,
+// the forwarder will be checked immediately if health checking is enabled.
+func (p *FwdrGroup) AddForwarder(s string) (*Forwarder, error) {
+	fwdr, err := newForwarder(s, p.config)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, f := range p.fwdrs {
+		if f.URL() == fwdr.URL() {
+			return nil, fmt.Errorf("forwarder %s already exists in group %s", f.Addr(), p.name)
+		}
+	}
+
+	fwdr.AddHandler(p.onStatusChanged)
+	p.fwdrs = append(p.fwdrs, fwdr)
+	sort.Sort(p.fwdrs)
+	p.init()
+	p.setScheduler()
+
+	log.F("[group] %s: added forwarder %s(%d), %d forwarders in total", p.name, fwdr.Addr(), fwdr.Priority(), len(p.fwdrs))
+
+	if p.checking {
+		if p.checker != nil {
+			go p.check(fwdr, p.checker)
+		} else if len(p.fwdrs) == 2 {
+			// health checking was skipped as there was only 1 forwarder
+			p.startCheck()
+		}
+	}
+
+	return fwdr, nil
+}
+
+// RemoveForwarder removes the forwarder from the group and stops checking it,
+// established connections via the forwarder will not be affected.
+func (p *FwdrGroup) RemoveForwarder(fwdr *Forwarder) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	idx := slices.Index(p.fwdrs, fwdr)
+	if idx < 0 {
+		return fmt.Errorf("forwarder %s not found in group %s", fwdr.Addr(), p.name)
+	}
+
+	if len(p.fwdrs) == 1 {
+		return fmt.Errorf("can not remove the last forwarder of group %s", p.name)
+	}
+
+	fwdr.Close()
+	p.fwdrs = slices.Delete(p.fwdrs, idx, idx+1)
+	p.current.CompareAndSwap(fwdr, nil)
+	p.init()
+	p.setScheduler()
+
+	log.F("[group] %s: removed forwarder %s(%d), %d forwarders in total", p.name, fwdr.Addr(), fwdr.Priority(), len(p.fwdrs))
+
+	return nil
+}
+
+// SetForwarderPriority sets the priority of fwdr and reorders the forwarders in group.
+func (p *FwdrGroup) SetForwarderPriority(fwdr *Forwarder, pri uint32) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	fwdr.SetPriority(pri)
+	sort.Sort(p.fwdrs)
+	p.init()
+}
+
+// CurrentProxy 获取本组当前选中的代理，未选择时为nil，不会改变选择
+func (p *FwdrGroup) CurrentProxy() *Forwarder {
+	return p.current.Load()
+}
+
+// SetCurrentProxy 设置本组当前选中的代理
+func (p *FwdrGroup) SetCurrentProxy(fwdr *Forwarder) {
+	p.current.Store(fwdr)
+}
+
+// autoSelect 未选择代理时从可用代理中随机选择一个，需要在持有 p.mu 且 p.avail 不为空的情况下调用
+func (p *FwdrGroup) autoSelect() *Forwarder {
+	if f := p.current.Load(); f != nil {
+		return f
+	}
+
+	f := p.avail[rand.IntN(len(p.avail))]
+	if p.current.CompareAndSwap(nil, f) {
+		log.F("[group] %s: auto selected proxy: %s", p.name, f.Addr())
+	}
+	return p.current.Load()
+}
@@ -0,0 +1,113 @@
+package rule
+
+import (
+	"container/list"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+const (
+	// learnedGrace is the time a learned ip is kept after its dns ttl expired,
+	// as clients may use a resolved ip a little longer than its ttl.
+	learnedGrace = 5 * time.Minute
+
+	// learnedMaxSize is the max number of learned ips, the least recently used
+	// ones are evicted when exceeded.
+	learnedMaxSize = 65536
+)
+
+// learnedIP is an ip learned from the dns answer of a domain matching a rule.
+type learnedIP struct {
+	ip      netip.Addr
+	domain  string
+	group   *FwdrGroup
+	expires time.Time
+}
+
+// learnedIPs is the table of learned ips, entries expire after the dns ttl
+// plus learnedGrace and the table is capped with lru eviction.
+type learnedIPs struct {
+	mu    sync.Mutex
+	lru   *list.List // of *learnedIP, the most recently used at front
+	items map[netip.Addr]*list.Element
+	size  int
+}
+
+func newLearnedIPs(size int) *learnedIPs {
+	return &learnedIPs{lru: list.New(), items: make(map[netip.Addr]*list.Element), size: size}
+}
+
+// add adds or refreshes the ip learned from the answer of domain with ttl in seconds.
+func (t *learnedIPs) add(ip netip.Addr, domain string, group *FwdrGroup, ttl int) {
+	t.put(ip, domain, group, time.Now().Add(time.Duration(ttl)*time.Second+learnedGrace))
+}
+
+// put adds or refreshes the ip learned from the answer of domain until expires.
+func (t *learnedIPs) put(ip netip.Addr, domain string, group *FwdrGroup, expires time.Time) {
+	ip = ip.Unmap()
+	now := time.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if e, ok := t.items[ip]; ok {
+		l := e.Value.(*learnedIP)
+		l.domain, l.group, l.expires = domain, group, expires
+		t.lru.MoveToFront(e)
+		return
+	}
+
+	t.items[ip] = t.lru.PushFront(&learnedIP{ip: ip, domain: domain, group: group, expires: expires})
+
+	// evict the expired and the least recently used ones
+	for e := t.lru.Back(); e != nil; e = t.lru.Back() {
+		if l := e.Value.(*learnedIP); t.lru.Len() <= t.size && now.Before(l.expires) {
+			break
+		}
+		t.remove(e)
+	}
+}
+
+// get returns the entry of ip, expired entries are removed and not returned.
+func (t *learnedIPs) get(ip netip.Addr) (learnedIP, bool) {
+	ip = ip.Unmap()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	e, ok := t.items[ip]
+	if !ok {
+		return learnedIP{}, false
+	}
+
+	l := e.Value.(*learnedIP)
+	if time.Now().After(l.expires) {
+		t.remove(e)
+		return learnedIP{}, false
+	}
+
+	t.lru.MoveToFront(e)
+	return *l, true
+}
+
+// entries returns the unexpired entries, the least recently used first.
+func (t *learnedIPs) entries() []learnedIP {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	ret := make([]learnedIP, 0, t.lru.Len())
+	for e := t.lru.Back(); e != nil; e = e.Prev() {
+		if l := e.Value.(*learnedIP); now.Before(l.expires) {
+			ret = append(ret, *l)
+		}
+	}
+	return ret
+}
+
+// remove removes e, must be called with t.mu held.
+func (t *learnedIPs) remove(e *list.Element) {
+	delete(t.items, e.Value.(*learnedIP).ip)
+	t.lru.Remove(e)
+}
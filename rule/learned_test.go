@@ -0,0 +1,154 @@
+package rule
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestLearnedIPsExpire(t *testing.T) {
+	g := &FwdrGroup{name: "g"}
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		ip      string
+		expires time.Time
+		found   bool
+	}{
+		{"unexpired", "1.1.1.1", now.Add(time.Minute), true},
+		{"in grace period", "1.1.1.2", now.Add(learnedGrace - time.Second), true},
+		{"expired", "1.1.1.3", now.Add(-time.Second), false},
+		{"expired ipv6", "2001:db8::1", now.Add(-time.Hour), false},
+	}
+
+	learned := newLearnedIPs(len(tests))
+	for _, tt := range tests {
+		learned.put(netip.MustParseAddr(tt.ip), "example.com", g, tt.expires)
+	}
+
+	for _, tt := range tests {
+		if _, ok := learned.get(netip.MustParseAddr(tt.ip)); ok != tt.found {
+			t.Errorf("%s: get(%s) found = %v, want %v", tt.name, tt.ip, ok, tt.found)
+		}
+	}
+
+	if n := len(learned.entries()); n != 2 {
+		t.Errorf("entries() returned %d entries, want the 2 unexpired ones", n)
+	}
+	if _, ok := learned.items[netip.MustParseAddr("1.1.1.3")]; ok {
+		t.Errorf("expired entry is not removed by get")
+	}
+
+	// entries expire after the ttl plus the grace period
+	ip := netip.MustParseAddr("1.1.1.4")
+	before := time.Now()
+	learned.add(ip, "example.com", g, 60)
+	after := time.Now()
+
+	l, ok := learned.get(ip)
+	ttl := 60*time.Second + learnedGrace
+	if !ok || l.expires.Before(before.Add(ttl)) || l.expires.After(after.Add(ttl)) {
+		t.Errorf("add() with ttl 60 expires at %v, want ttl plus %v from now", l.expires, learnedGrace)
+	}
+
+	// refreshing an entry updates its rule and expiry
+	g2 := &FwdrGroup{name: "g2"}
+	learned.put(ip, "example.org", g2, now.Add(-time.Second))
+	if _, ok := learned.get(ip); ok {
+		t.Errorf("entry refreshed with an expired time is still found")
+	}
+}
+
+func TestLearnedIPsLRU(t *testing.T) {
+	g := &FwdrGroup{name: "g"}
+	expires := time.Now().Add(time.Hour)
+	addr := netip.MustParseAddr
+
+	learned := newLearnedIPs(3)
+	for _, ip := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		learned.put(addr(ip), "example.com", g, expires)
+	}
+
+	// 10.0.0.1 becomes the most recently used, 10.0.0.2 the least
+	learned.get(addr("10.0.0.1"))
+	learned.put(addr("10.0.0.4"), "example.com", g, expires)
+
+	tests := []struct {
+		ip    string
+		found bool
+	}{
+		{"10.0.0.1", true},
+		{"10.0.0.2", false},
+		{"10.0.0.3", true},
+		{"10.0.0.4", true},
+	}
+	for _, tt := range tests {
+		if _, ok := learned.get(addr(tt.ip)); ok != tt.found {
+			t.Errorf("get(%s) found = %v, want %v", tt.ip, ok, tt.found)
+		}
+	}
+
+	// refreshing an existing entry evicts nothing
+	learned.put(addr("10.0.0.3"), "example.org", g, expires)
+	if n := learned.lru.Len(); n != 3 {
+		t.Errorf("%d entries after refreshing, want 3", n)
+	}
+
+	// expired entries are evicted even if the table is not full
+	learned = newLearnedIPs(3)
+	learned.put(addr("10.0.0.5"), "example.com", g, time.Now().Add(-time.Second))
+	learned.put(addr("10.0.0.6"), "example.com", g, expires)
+	if _, ok := learned.items[addr("10.0.0.5")]; ok || learned.lru.Len() != 1 {
+		t.Errorf("expired entry is not evicted when adding a new one")
+	}
+
+	// ipv4-mapped ipv6 addresses are stored as ipv4 addresses
+	learned.put(addr("::ffff:10.0.0.7"), "example.com", g, expires)
+	if _, ok := learned.get(addr("10.0.0.7")); !ok {
+		t.Errorf("get(10.0.0.7) of an entry added as ::ffff:10.0.0.7 not found")
+	}
+}
+
+func TestProxyLearnedIP(t *testing.T) {
+	c := testStrategy()
+	rules := []*Config{
+		{RulePath: "a.rule", Forward: []string{"direct://#tag=a"}, Strategy: testStrategy(), Domain: []string{"example.com"}},
+	}
+	p := NewProxy([]string{"direct://#tag=m"}, &c, rules, nil, nil)
+	t.Cleanup(p.Close)
+	a := p.Group("a")
+
+	p.AddDomainIP("www.example.com", netip.MustParseAddr("1.2.3.4"), 60)
+	p.AddDomainIP("www.example.org", netip.MustParseAddr("1.2.3.5"), 60)
+	p.learned.put(netip.MustParseAddr("1.2.3.6"), "example.com", a, time.Now().Add(-time.Second))
+
+	tests := []struct {
+		addr      string
+		group     *FwdrGroup
+		directive string
+		value     string
+	}{
+		{"1.2.3.4:443", a, "learned", "www.example.com"},
+		{"[::ffff:1.2.3.4]:443", a, "learned", "www.example.com"},
+		// domains matching no rule are not learned
+		{"1.2.3.5:443", p.main, "", ""},
+		// expired
+		{"1.2.3.6:443", p.main, "", ""},
+	}
+	for _, tt := range tests {
+		if m := p.route(nil, "tcp", tt.addr); m.group != tt.group || m.directive != tt.directive || m.value != tt.value {
+			t.Errorf("route(%s) = %s %s %s, want %s %s %s", tt.addr,
+				m.group.Name(), m.directive, m.value, tt.group.Name(), tt.directive, tt.value)
+		}
+	}
+
+	// learned ips are carried over to the proxy replacing p
+	c2 := testStrategy()
+	pxy := p.Renew([]string{"direct://#tag=m"}, &c2, rules, nil, nil)
+	t.Cleanup(pxy.Close)
+	pxy.Relearn(p)
+	if m := pxy.route(nil, "tcp", "1.2.3.4:443"); m.group != pxy.Group("a") || m.directive != "learned" {
+		t.Errorf("route(1.2.3.4:443) after relearn = %s %s, want a learned", m.group.Name(), m.directive)
+	}
+}
@@ -0,0 +1,253 @@
+package rule
+
+import (
+	"bufio"
+	"fmt"
+	"net/netip"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/nadoo/glider/pkg/geoip"
+	"github.com/nadoo/glider/proxy"
+)
+
+// Rule types of the rule list.
+const (
+	listDomain        = "DOMAIN"
+	listDomainSuffix  = "DOMAIN-SUFFIX"
+	listDomainKeyword = "DOMAIN-KEYWORD"
+	listDomainRegex   = "DOMAIN-REGEX"
+	listIPCIDR        = "IP-CIDR"
+	listIPCIDR6       = "IP-CIDR6"
+	listSrcIPCIDR     = "SRC-IP-CIDR"
+	listGeoIP         = "GEOIP"
+	listDstPort       = "DST-PORT"
+	listNetwork       = "NETWORK"
+	listMatch         = "MATCH"
+)
+
+// Special targets of the rule list.
+const (
+	targetDirect = "direct"
+	targetReject = "reject"
+)
+
+// List is an ordered rule list, the rules are checked from top to bottom
+// and the first matched one is used.
+type List struct {
+	Path  string
+	Rules []*ListRule
+}
+
+// ListRule is a rule of the rule list like DOMAIN-SUFFIX,google.com,proxyA.
+type ListRule struct {
+	Type   string
+	Value  string
+	Target string
+
+	cidr  netip.Prefix
+	re    *regexp.Regexp
+	ports portRange
+}
+
+// NewListFromFile returns a rule list from file, one rule per line in the format
+// TYPE,VALUE,TARGET or MATCH,TARGET, empty lines and lines starting with # are ignored.
+func NewListFromFile(path string) (*List, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	l := &List{Path: path}
+
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		r, err := parseListRule(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		l.Rules = append(l.Rules, r)
+	}
+
+	return l, s.Err()
+}
+
+// CheckGroups returns an error if the group of a rule file is named after a
+// special target, the rule list could not refer to the group otherwise.
+func (l *List) CheckGroups(rules []*Config) error {
+	for _, r := range rules {
+		switch name := groupName(r.RulePath); strings.ToLower(name) {
+		case targetDirect, targetReject:
+			return fmt.Errorf("%s: group name %s is reserved for the target of rule list %s, rename the rule file", r.RulePath, name, l.Path)
+		}
+	}
+	return nil
+}
+
+// parseListRule parses a rule, the no-resolve option of ip rules is accepted
+// and ignored as destination domains are never resolved to match ip rules.
+func parseListRule(line string) (*ListRule, error) {
+	fields := strings.Split(line, ",")
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+
+	r := &ListRule{Type: strings.ToUpper(fields[0])}
+	if !isListType(r.Type) {
+		return nil, fmt.Errorf("unknown rule type %s", fields[0])
+	}
+
+	if r.Type == listMatch {
+		if len(fields) != 2 || fields[1] == "" {
+			return nil, fmt.Errorf("invalid rule %q, use MATCH,TARGET", line)
+		}
+		r.Target = fields[1]
+		return r, nil
+	}
+
+	if len(fields) == 4 && strings.EqualFold(fields[3], "no-resolve") {
+		fields = fields[:3]
+	}
+	if len(fields) != 3 || fields[1] == "" || fields[2] == "" {
+		return nil, fmt.Errorf("invalid rule %q, use TYPE,VALUE,TARGET", line)
+	}
+	r.Value, r.Target = fields[1], fields[2]
+
+	var err error
+	switch r.Type {
+	case listDomain, listDomainSuffix, listDomainKeyword:
+		r.Value = strings.ToLower(r.Value)
+	case listDomainRegex:
+		r.re, err = regexp.Compile(r.Value)
+	case listIPCIDR, listIPCIDR6, listSrcIPCIDR:
+		r.cidr, err = netip.ParsePrefix(r.Value)
+		r.cidr = r.cidr.Masked()
+	case listGeoIP:
+		r.Value = strings.ToUpper(r.Value)
+	case listDstPort:
+		r.ports, err = parsePortRange(r.Value)
+	case listNetwork:
+		r.Value = strings.ToLower(r.Value)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid rule %q: %w", line, err)
+	}
+
+	return r, nil
+}
+
+// isListType reports whether typ is a rule type of the rule list.
+func isListType(typ string) bool {
+	switch typ {
+	case listDomain, listDomainSuffix, listDomainKeyword, listDomainRegex, listIPCIDR,
+		listIPCIDR6, listSrcIPCIDR, listGeoIP, listDstPort, listNetwork, listMatch:
+		return true
+	}
+	return false
+}
+
+// isDomainRule reports whether r matches domains.
+func (r *ListRule) isDomainRule() bool {
+	switch r.Type {
+	case listDomain, listDomainSuffix, listDomainKeyword, listDomainRegex:
+		return true
+	}
+	return false
+}
+
+// matchDomain reports whether the domain rule r matches domain.
+func (r *ListRule) matchDomain(domain string) bool {
+	switch r.Type {
+	case listDomain:
+		return domain == r.Value
+	case listDomainSuffix:
+		return domain == r.Value || strings.HasSuffix(domain, "."+r.Value)
+	case listDomainKeyword:
+		return strings.Contains(domain, r.Value)
+	case listDomainRegex:
+		return r.re.MatchString(domain)
+	}
+	return false
+}
+
+// listRequest is a request matched against the rule list, domain is the
+// destination domain or the domain a destination ip was learned from,
+// ip is invalid if the destination is a domain.
+type listRequest struct {
+	meta    *proxy.Metadata
+	network string
+	dstAddr string
+	domain  string
+	ip      netip.Addr
+}
+
+// match reports whether r matches the request.
+func (r *ListRule) match(req *listRequest, db *geoip.Reader) bool {
+	switch r.Type {
+	case listDomain, listDomainSuffix, listDomainKeyword, listDomainRegex:
+		return req.domain != "" && r.matchDomain(req.domain)
+	case listIPCIDR, listIPCIDR6:
+		return req.ip.IsValid() && r.cidr.Contains(req.ip)
+	case listSrcIPCIDR:
+		ip, ok := srcIP(req.meta)
+		return ok && r.cidr.Contains(ip)
+	case listGeoIP:
+		return req.ip.IsValid() && db != nil && db.Country(req.ip) == r.Value
+	case listDstPort:
+		port, ok := dstPort(req.dstAddr)
+		return ok && r.ports.contains(port)
+	case listNetwork:
+		return strings.TrimRight(req.network, "46") == r.Value
+	case listMatch:
+		return true
+	}
+	return false
+}
+
+// listEntry is a rule of the rule list with its target group.
+type listEntry struct {
+	rule  *ListRule
+	group *FwdrGroup
+}
+
+// matchList returns the first rule in the rule list that the request matches.
+func (p *Proxy) matchList(meta *proxy.Metadata, network, dstAddr, host string) match {
+	if len(p.list) == 0 {
+		return match{}
+	}
+
+	req := &listRequest{meta: meta, network: network, dstAddr: dstAddr}
+	if ip, err := netip.ParseAddr(host); err == nil {
+		req.ip = ip.Unmap()
+		if l, ok := p.learned.get(req.ip); ok {
+			req.domain = l.domain
+		}
+	} else {
+		req.domain = strings.ToLower(host)
+	}
+
+	for _, e := range p.list {
+		if e.rule.match(req, p.geoip) {
+			return match{e.group, e.rule.Type, e.rule.Value}
+		}
+	}
+	return match{}
+}
+
+// matchListDomain returns the first domain rule in the rule list that domain matches.
+func (p *Proxy) matchListDomain(domain string) match {
+	domain = strings.ToLower(domain)
+	for _, e := range p.list {
+		if e.rule.isDomainRule() && e.rule.matchDomain(domain) {
+			return match{e.group, e.rule.Type, e.rule.Value}
+		}
+	}
+	return match{}
+}
@@ -0,0 +1,169 @@
+package rule
+
+import (
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nadoo/glider/proxy"
+	_ "github.com/nadoo/glider/proxy/reject"
+)
+
+func TestParseListRule(t *testing.T) {
+	tests := []struct {
+		line string
+		typ  string
+		val  string
+		tgt  string
+		err  bool
+	}{
+		{"DOMAIN-SUFFIX,Google.com,proxyA", listDomainSuffix, "google.com", "proxyA", false},
+		{"domain-keyword, cdn , direct", listDomainKeyword, "cdn", "direct", false},
+		{"IP-CIDR,10.0.0.0/8,DIRECT,no-resolve", listIPCIDR, "10.0.0.0/8", "DIRECT", false},
+		{"GEOIP,cn,direct", listGeoIP, "CN", "direct", false},
+		{"DST-PORT,8000-9000,proxyA", listDstPort, "8000-9000", "proxyA", false},
+		{"MATCH,main", listMatch, "", "main", false},
+		{"UNKNOWN,a,b", "", "", "", true},
+		{"DOMAIN,example.com", "", "", "", true},
+		{"DOMAIN,,proxyA", "", "", "", true},
+		{"MATCH", "", "", "", true},
+		{"MATCH,main,extra", "", "", "", true},
+		{"IP-CIDR,10.0.0.0,direct", "", "", "", true},
+		{"DOMAIN-REGEX,(,direct", "", "", "", true},
+		{"DST-PORT,ssh,direct", "", "", "", true},
+	}
+
+	for _, tt := range tests {
+		r, err := parseListRule(tt.line)
+		if tt.err {
+			if err == nil {
+				t.Errorf("parseListRule(%q) = %+v, want error", tt.line, r)
+			}
+			continue
+		}
+		if err != nil || r.Type != tt.typ || r.Value != tt.val || r.Target != tt.tgt {
+			t.Errorf("parseListRule(%q) = %+v, %v, want %s,%s,%s", tt.line, r, err, tt.typ, tt.val, tt.tgt)
+		}
+	}
+}
+
+// writeList writes the rule list file with lines and returns the rule list.
+func writeList(t *testing.T, lines ...string) *List {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "rules.list")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	l, err := NewListFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func TestProxyList(t *testing.T) {
+	c := testStrategy()
+	rules := []*Config{
+		{RulePath: "proxyA.rule", Forward: []string{"direct://#tag=a"}, Strategy: testStrategy(),
+			Domain: []string{"example.org"}},
+		{RulePath: "proxyB.rule", Forward: []string{"direct://#tag=b"}, Strategy: testStrategy()},
+	}
+	list := writeList(t,
+		"# ads first",
+		"DOMAIN-KEYWORD,ads,reject",
+		"DOMAIN,www.example.com,proxyB",
+		"DOMAIN-SUFFIX,example.com,proxyA",
+		"",
+		"DOMAIN-REGEX,^img\\d+\\.,Direct",
+		"IP-CIDR,10.0.0.0/8,direct",
+		"IP-CIDR,10.1.0.0/16,proxyA",
+		"SRC-IP-CIDR,192.168.2.0/24,proxyB",
+		"DST-PORT,22,proxyA",
+		"NETWORK,udp,proxyB",
+		"DOMAIN,unknown.example.net,nosuchgroup",
+	)
+	p := NewProxy([]string{"direct://#tag=m"}, &c, rules, nil, list)
+	t.Cleanup(p.Close)
+
+	p.learned.add(netip.MustParseAddr("1.2.3.4"), "www.example.com", p.Group("proxyB"), 60)
+	lan := &proxy.Metadata{SrcAddr: &net.TCPAddr{IP: net.ParseIP("192.168.2.10"), Port: 50000}}
+
+	tests := []struct {
+		name      string
+		meta      *proxy.Metadata
+		network   string
+		dstAddr   string
+		group     string
+		directive string
+	}{
+		{"first match", nil, "tcp", "ads.example.com:443", targetReject, listDomainKeyword},
+		{"exact domain before suffix", nil, "tcp", "www.example.com:443", "proxyB", listDomain},
+		{"suffix", nil, "tcp", "a.example.com:443", "proxyA", listDomainSuffix},
+		{"target case insensitive", nil, "tcp", "img1.example.net:443", targetDirect, listDomainRegex},
+		{"first cidr not the most specific", nil, "tcp", "10.1.2.3:443", targetDirect, listIPCIDR},
+		{"learned domain", nil, "tcp", "1.2.3.4:443", "proxyB", listDomain},
+		{"source", lan, "tcp", "8.8.8.8:443", "proxyB", listSrcIPCIDR},
+		{"port", nil, "tcp", "8.8.8.8:22", "proxyA", listDstPort},
+		{"network", nil, "udp", "8.8.8.8:53", "proxyB", listNetwork},
+		// rules with unknown targets are ignored
+		{"unknown target", nil, "tcp", "unknown.example.net:443", "main", ""},
+		// the rule files are checked after the rule list
+		{"rule file", nil, "tcp", "www.example.org:443", "proxyA", "domain"},
+		{"no rule", nil, "tcp", "8.8.8.8:443", "main", ""},
+		// dstAddr without port
+		{"no port", nil, "tcp", "a.example.com", "proxyA", listDomainSuffix},
+		{"ip without port", nil, "tcp", "10.1.2.3", targetDirect, listIPCIDR},
+		{"ipv6 without port", nil, "tcp", "[2001:db8::1]", "main", ""},
+	}
+
+	for _, tt := range tests {
+		m := p.route(tt.meta, tt.network, tt.dstAddr)
+		if m.group.Name() != tt.group || m.directive != tt.directive {
+			t.Errorf("%s: route(%s %s) = %s %s, want %s %s", tt.name, tt.network, tt.dstAddr,
+				m.group.Name(), m.directive, tt.group, tt.directive)
+		}
+	}
+
+	if m := p.route(nil, "tcp", "ads.example.com:443"); m.group != p.reject {
+		t.Fatalf("reject target is not the reject group")
+	}
+	if _, err := p.NextDialer("ads.example.com:443").Dial("tcp", "ads.example.com:443"); err == nil {
+		t.Errorf("dial via reject target succeeded")
+	}
+
+	// MATCH matches all the requests left
+	p2 := NewProxy([]string{"direct://#tag=m"}, &c, rules, nil, writeList(t, "DOMAIN,example.net,direct", "MATCH,proxyB"))
+	t.Cleanup(p2.Close)
+	for _, addr := range []string{"example.net:443", "www.example.org:443", "8.8.8.8:443"} {
+		want := "proxyB"
+		if addr == "example.net:443" {
+			want = targetDirect
+		}
+		if m := p2.route(nil, "tcp", addr); m.group.Name() != want {
+			t.Errorf("route(%s) with MATCH = %s, want %s", addr, m.group.Name(), want)
+		}
+	}
+}
+
+func TestListCheckGroups(t *testing.T) {
+	list := &List{Path: "rules.list"}
+
+	tests := []struct {
+		path string
+		err  bool
+	}{
+		{"/etc/glider/rules.d/office.rule", false},
+		{"/etc/glider/rules.d/direct.rule", true},
+		{"/etc/glider/rules.d/Reject.rule", true},
+		{"/etc/glider/rules.d/directly.rule", false},
+	}
+
+	for _, tt := range tests {
+		if err := list.CheckGroups([]*Config{{RulePath: tt.path}}); (err != nil) != tt.err {
+			t.Errorf("CheckGroups(%s) error = %v, want error %v", tt.path, err, tt.err)
+		}
+	}
+}
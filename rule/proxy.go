@@ -3,9 +3,12 @@ package rule
 import (
 	"net"
 	"net/netip"
+	"regexp"
+	"slices"
 	"strings"
 	"sync"
 
+	"github.com/nadoo/glider/pkg/geoip"
 	"github.com/nadoo/glider/pkg/log"
 	"github.com/nadoo/glider/proxy"
 )
@@ -14,23 +17,110 @@ import (
 type Proxy struct {
 	main      *FwdrGroup
 	all       []*FwdrGroup
+	direct    *FwdrGroup
+	reject    *FwdrGroup
 	domainMap sync.Map
+	fullMap   map[string]*FwdrGroup
+	keywords  []domainKeyword
+	regexps   []domainRegex
 	ipMap     sync.Map
-	cidrMap   sync.Map
+	learned   *learnedIPs
+	cidrs     cidrTrie
+	geoip     *geoip.Reader
+	countries []geoIPRule
+
+	// request conditions of rule files, read only after created
+	conds map[*FwdrGroup]*conditions
+	// groups of the rule files with request conditions but no destination rules
+	condOnly []*FwdrGroup
+
+	// ordered rule list checked before the rule files
+	list     []listEntry
+	listPath string
+
+	// groups and forwarders reused by the proxy replacing p, Close keeps them
+	reusedGroups map[*FwdrGroup]bool
+	reusedFwdrs  map[*Forwarder]bool
 }
 
-// NewProxy returns a new rule proxy.
-func NewProxy(mainForwarders []string, mainStrategy *Strategy, rules []*Config) *Proxy {
-	rd := &Proxy{main: NewFwdrGroup("main", mainForwarders, mainStrategy)}
+// domainKeyword is a domain-keyword rule.
+type domainKeyword struct {
+	keyword string
+	group   *FwdrGroup
+}
+
+// domainRegex is a domain-regex rule.
+type domainRegex struct {
+	re    *regexp.Regexp
+	group *FwdrGroup
+}
+
+// geoIPRule is a geoip rule.
+type geoIPRule struct {
+	country string
+	not     bool
+	group   *FwdrGroup
+}
+
+// NewProxy returns a new rule proxy, geoDB is used by the geoip rules and list
+// is the ordered rule list, both can be nil.
+func NewProxy(mainForwarders []string, mainStrategy *Strategy, rules []*Config, geoDB *geoip.Reader, list *List) *Proxy {
+	return newProxy(nil, mainForwarders, mainStrategy, rules, geoDB, list)
+}
+
+// Renew returns a new rule proxy like NewProxy to replace p on reload. The
+// groups of p with unchanged forwarders and strategy are reused with their
+// state: forwarder status and latency, the current forwarder and sticky
+// sessions; for the changed groups, forwarders with unchanged dial settings
+// are reused. p.Close closes the groups and forwarders not reused only.
+func (p *Proxy) Renew(mainForwarders []string, mainStrategy *Strategy, rules []*Config, geoDB *geoip.Reader, list *List) *Proxy {
+	p.reusedGroups = make(map[*FwdrGroup]bool)
+	p.reusedFwdrs = make(map[*Forwarder]bool)
+	return newProxy(p, mainForwarders, mainStrategy, rules, geoDB, list)
+}
+
+// newProxy returns a new rule proxy reusing the groups of old, old can be nil.
+func newProxy(old *Proxy, mainForwarders []string, mainStrategy *Strategy, rules []*Config, geoDB *geoip.Reader, list *List) *Proxy {
+	rd := &Proxy{
+		main:    old.renewGroup("main", mainForwarders, mainStrategy),
+		fullMap: make(map[string]*FwdrGroup),
+		geoip:   geoDB,
+		learned: newLearnedIPs(learnedMaxSize),
+		conds:   make(map[*FwdrGroup]*conditions),
+	}
 
 	for _, r := range rules {
-		group := NewFwdrGroup(r.RulePath, r.Forward, &r.Strategy)
+		group := old.renewGroup(r.RulePath, r.Forward, &r.Strategy)
 		rd.all = append(rd.all, group)
 
+		if c := newConditions(r); c != nil {
+			rd.conds[group] = c
+			if !r.hasDestination() {
+				rd.condOnly = append(rd.condOnly, group)
+			}
+		}
+
 		for _, domain := range r.Domain {
 			rd.domainMap.Store(strings.ToLower(domain), group)
 		}
 
+		for _, domain := range r.DomainFull {
+			rd.fullMap[strings.ToLower(domain)] = group
+		}
+
+		for _, keyword := range r.DomainKeyword {
+			rd.keywords = append(rd.keywords, domainKeyword{strings.ToLower(keyword), group})
+		}
+
+		for _, s := range r.DomainRegex {
+			re, err := regexp.Compile(s)
+			if err != nil {
+				log.F("[rule] parse domain regex error: %s", err)
+				continue
+			}
+			rd.regexps = append(rd.regexps, domainRegex{re, group})
+		}
+
 		for _, s := range r.IP {
 			ip, err := netip.ParseAddr(s)
 			if err != nil {
@@ -46,84 +136,261 @@ func NewProxy(mainForwarders []string, mainStrategy *Strategy, rules []*Config)
 				log.F("[rule] parse cidr error: %s", err)
 				continue
 			}
-			rd.cidrMap.Store(cidr, group)
+			rd.cidrs.insert(cidr, group)
+		}
+
+		if len(r.GeoIP) > 0 && geoDB == nil {
+			log.Printf("[rule] geoip rules in %s are ignored as no geoip database is set", r.RulePath)
+		}
+
+		for _, s := range r.GeoIP {
+			country, not := strings.CutPrefix(strings.TrimSpace(s), "!")
+			rd.countries = append(rd.countries, geoIPRule{strings.ToUpper(country), not, group})
 		}
 	}
 
-	direct := NewFwdrGroup("", nil, mainStrategy)
-	rd.domainMap.Store("direct", direct)
+	rd.direct = NewFwdrGroup("", nil, mainStrategy)
+	rd.direct.name = targetDirect
+	rd.domainMap.Store("direct", rd.direct)
+
+	if list != nil {
+		rd.setList(list, mainStrategy)
+	}
 
 	// if there's any forwarder defined in main config, make sure they will be accessed directly.
 	if len(mainForwarders) > 0 {
 		for _, f := range rd.main.fwdrs {
-			addr := strings.Split(f.addr, ",")[0]
-			host, _, _ := net.SplitHostPort(addr)
-			if _, err := netip.ParseAddr(host); err != nil {
-				rd.domainMap.Store(strings.ToLower(host), direct)
-			}
+			rd.directForwarderHost(f)
 		}
 	}
 
 	return rd
 }
 
+// renewGroup returns the group of rule file rulePath for the proxy replacing p,
+// the group of p is reused if unchanged, p can be nil.
+func (p *Proxy) renewGroup(rulePath string, s []string, c *Strategy) *FwdrGroup {
+	if p == nil {
+		return NewFwdrGroup(rulePath, s, c)
+	}
+
+	var old *FwdrGroup
+	for _, g := range p.Groups() {
+		if g.rulePath == rulePath {
+			old = g
+			break
+		}
+	}
+
+	if old != nil && old.unchanged(rulePath, s, c) {
+		log.F("[rule] %s: group unchanged, reused", old.name)
+		p.reusedGroups[old] = true
+		return old
+	}
+
+	g := renewFwdrGroup(old, rulePath, s, c)
+	if old != nil {
+		fwdrs := old.GetForwarders()
+		for _, f := range g.fwdrs {
+			if slices.Contains(fwdrs, f) {
+				p.reusedFwdrs[f] = true
+			}
+		}
+	}
+	return g
+}
+
+// setList sets the ordered rule list, rules with unknown targets are ignored.
+func (p *Proxy) setList(list *List, c *Strategy) {
+	p.listPath = list.Path
+
+	for _, r := range list.Rules {
+		var group *FwdrGroup
+		switch strings.ToLower(r.Target) {
+		case targetDirect:
+			group = p.direct
+		case targetReject:
+			if p.reject == nil {
+				fwdr, err := newForwarder("reject://", c)
+				if err != nil {
+					log.Fatal(err)
+				}
+				p.reject = newFwdrGroup(targetReject, []*Forwarder{fwdr}, c)
+			}
+			group = p.reject
+		default:
+			group = p.Group(r.Target)
+		}
+
+		if group == nil {
+			log.Printf("[rule] unknown target %s of rule %s,%s in %s, ignored", r.Target, r.Type, r.Value, list.Path)
+			continue
+		}
+		if r.Type == listGeoIP && p.geoip == nil {
+			log.Printf("[rule] rule %s,%s in %s is ignored as no geoip database is set", r.Type, r.Value, list.Path)
+			continue
+		}
+		p.list = append(p.list, listEntry{r, group})
+	}
+}
+
+// directForwarderHost makes sure the host of forwarder will be accessed directly.
+func (p *Proxy) directForwarderHost(f *Forwarder) {
+	addr := strings.Split(f.addr, ",")[0]
+	host, _, _ := net.SplitHostPort(addr)
+	if _, err := netip.ParseAddr(host); err != nil {
+		p.domainMap.Store(strings.ToLower(host), p.direct)
+	}
+}
+
 // Dial dials to targer addr and return a conn.
 func (p *Proxy) Dial(network, addr string) (net.Conn, proxy.Dialer, error) {
-	return p.findDialer(addr).Dial(network, addr)
+	return p.findDialer(nil, network, addr).Dial(network, addr)
+}
+
+// DialMeta dials to targer addr with the metadata of client request.
+func (p *Proxy) DialMeta(meta *proxy.Metadata, network, addr string) (net.Conn, proxy.Dialer, error) {
+	return p.findDialer(meta, network, addr).DialMeta(meta, network, addr)
 }
 
 // DialUDP connects to the given address via the proxy.
 func (p *Proxy) DialUDP(network, addr string) (pc net.PacketConn, dialer proxy.UDPDialer, err error) {
-	return p.findDialer(addr).DialUDP(network, addr)
+	return p.findDialer(nil, network, addr).DialUDP(network, addr)
+}
+
+// DialUDPMeta connects to the given address via the proxy with the metadata of client request.
+func (p *Proxy) DialUDPMeta(meta *proxy.Metadata, network, addr string) (pc net.PacketConn, dialer proxy.UDPDialer, err error) {
+	return p.findDialer(meta, network, addr).DialUDPMeta(meta, network, addr)
+}
+
+// findDialer returns a dialer by the client request according to rule.
+func (p *Proxy) findDialer(meta *proxy.Metadata, network, dstAddr string) *FwdrGroup {
+	return p.route(meta, network, dstAddr).group
 }
 
-// findDialer returns a dialer by dstAddr according to rule.
-func (p *Proxy) findDialer(dstAddr string) *FwdrGroup {
+// route returns the rule matching the client request, or the main group if no rule matches.
+// The rule list is checked first from top to bottom; then the destination rules,
+// a rule in a file with request conditions is skipped if the request does not
+// match the conditions; then the rule files with only request conditions are
+// checked in order.
+func (p *Proxy) route(meta *proxy.Metadata, network, dstAddr string) match {
+	accept := func(g *FwdrGroup) bool {
+		c, ok := p.conds[g]
+		return !ok || c.match(meta, network, dstAddr)
+	}
+
+	// dstAddr may have no port, e.g. the dstAddr of NextDialer
 	host, _, err := net.SplitHostPort(dstAddr)
 	if err != nil {
-		return p.main
+		host = strings.Trim(dstAddr, "[]")
+	}
+	if host != "" {
+		if m := p.matchList(meta, network, dstAddr, host); m.group != nil {
+			return m
+		}
+		if m := p.matchDestination(host, accept); m.group != nil {
+			return m
+		}
+	}
+
+	for _, group := range p.condOnly {
+		if accept(group) {
+			return match{group, "conditions", ""}
+		}
 	}
 
+	return match{group: p.main}
+}
+
+// acceptAll accepts groups of all the rules.
+func acceptAll(*FwdrGroup) bool { return true }
+
+// matchDestination returns the destination rule that host matches and accept accepts.
+func (p *Proxy) matchDestination(host string, accept func(*FwdrGroup) bool) match {
 	if ip, err := netip.ParseAddr(host); err == nil {
 		// check ip
-		if proxy, ok := p.ipMap.Load(ip); ok {
-			return proxy.(*FwdrGroup)
+		if proxy, ok := p.ipMap.Load(ip); ok && accept(proxy.(*FwdrGroup)) {
+			return match{proxy.(*FwdrGroup), "ip", ip.String()}
 		}
 
-		// check cidr
-		var ret *FwdrGroup
-		p.cidrMap.Range(func(key, value any) bool {
-			if key.(netip.Prefix).Contains(ip) {
-				ret = value.(*FwdrGroup)
-				return false
-			}
-			return true
-		})
+		// check ips learned from dns answers
+		if l, ok := p.learned.get(ip); ok && accept(l.group) {
+			return match{l.group, "learned", l.domain}
+		}
+
+		// check cidr, the most specific one wins
+		if group, cidr := p.cidrs.lookup(ip, accept); group != nil {
+			return match{group, "cidr", cidr.String()}
+		}
 
-		if ret != nil {
-			return ret
+		// check geoip
+		if m := p.matchGeoIP(ip, accept); m.group != nil {
+			return m
 		}
 	}
 
 	// check host
+	return p.matchDomain(host, accept)
+}
+
+// matchDomain returns the domain rule that host matches and accept accepts.
+// Rules are checked in the order: domain-full, domain (suffix), domain-keyword
+// and domain-regex; keyword and regex rules are checked in the order they are defined.
+func (p *Proxy) matchDomain(host string, accept func(*FwdrGroup) bool) match {
 	host = strings.ToLower(host)
+
+	if group, ok := p.fullMap[host]; ok && accept(group) {
+		return match{group, "domain-full", host}
+	}
+
 	for i := len(host); i != -1; {
 		i = strings.LastIndexByte(host[:i], '.')
-		if proxy, ok := p.domainMap.Load(host[i+1:]); ok {
-			return proxy.(*FwdrGroup)
+		if proxy, ok := p.domainMap.Load(host[i+1:]); ok && accept(proxy.(*FwdrGroup)) {
+			group := proxy.(*FwdrGroup)
+			if group == p.direct {
+				// host of a forwarder in the main group
+				return match{group, "forwarder", host[i+1:]}
+			}
+			return match{group, "domain", host[i+1:]}
 		}
 	}
 
-	return p.main
+	for _, k := range p.keywords {
+		if strings.Contains(host, k.keyword) && accept(k.group) {
+			return match{k.group, "domain-keyword", k.keyword}
+		}
+	}
+
+	for _, r := range p.regexps {
+		if r.re.MatchString(host) && accept(r.group) {
+			return match{r.group, "domain-regex", r.re.String()}
+		}
+	}
+
+	return match{}
 }
 
 // NextDialer returns next dialer according to rule.
 func (p *Proxy) NextDialer(dstAddr string) proxy.Dialer {
-	return p.findDialer(dstAddr).NextDialer(dstAddr)
+	return p.findDialer(nil, "", dstAddr).NextDialer(dstAddr)
+}
+
+// NextDialerMeta returns next dialer according to rule with the metadata of client request,
+// the dial events are emitted when the returned dialer dials.
+func (p *Proxy) NextDialerMeta(meta *proxy.Metadata, network, dstAddr string) proxy.Dialer {
+	group := p.findDialer(meta, network, dstAddr)
+	nd := group.nextDialerMeta(meta, dstAddr)
+	if fwdr, ok := nd.(*Forwarder); ok {
+		return &eventDialer{fwdr, group}
+	}
+	return nd
 }
 
 // Record records result while using the dialer from proxy.
 func (p *Proxy) Record(dialer proxy.Dialer, success bool) {
+	if d, ok := dialer.(*eventDialer); ok {
+		dialer = d.Forwarder
+	}
 	if fwdr, ok := dialer.(*Forwarder); ok {
 		if !success {
 			fwdr.IncFailures()
@@ -133,19 +400,62 @@ func (p *Proxy) Record(dialer proxy.Dialer, success bool) {
 	}
 }
 
-// AddDomainIP used to update ipMap rules according to domainMap rule.
-func (p *Proxy) AddDomainIP(domain string, ip netip.Addr) error {
-	domain = strings.ToLower(domain)
-	for i := len(domain); i != -1; {
-		i = strings.LastIndexByte(domain[:i], '.')
-		if dialer, ok := p.domainMap.Load(domain[i+1:]); ok {
-			p.ipMap.Store(ip, dialer)
-			// log.F("[rule] update map: %s/%s based on rule: domain=%s\n", domain, ip, domain[i+1:])
+// matchGeoIP returns the first geoip rule that ip matches and accept accepts.
+// Negative rules only match ips whose country is known, so private ips never match.
+func (p *Proxy) matchGeoIP(ip netip.Addr, accept func(*FwdrGroup) bool) match {
+	if p.geoip == nil || len(p.countries) == 0 {
+		return match{}
+	}
+
+	country := p.geoip.Country(ip)
+	if country == "" {
+		return match{}
+	}
+
+	for _, r := range p.countries {
+		if (country == r.country) != r.not && accept(r.group) {
+			if r.not {
+				return match{r.group, "geoip", "!" + r.country}
+			}
+			return match{r.group, "geoip", r.country}
 		}
 	}
+	return match{}
+}
+
+// AddDomainIP learns the ip resolved for domain according to domain rules of
+// the rule list and the rule files, or geoip rules when the domain matches no
+// domain rule. The ip expires after the dns ttl in seconds plus a grace period.
+func (p *Proxy) AddDomainIP(domain string, ip netip.Addr, ttl int) error {
+	if m := p.matchResolved(domain, ip); m.group != nil {
+		p.learned.add(ip, domain, m.group, ttl)
+	}
 	return nil
 }
 
+// Relearn learns the unexpired ips learned by old again with the rules of p,
+// it's used when p replaces old on reload, as the dns answers served from the
+// cache are not passed to AddDomainIP again.
+func (p *Proxy) Relearn(old *Proxy) {
+	for _, l := range old.learned.entries() {
+		if m := p.matchResolved(l.domain, l.ip); m.group != nil {
+			p.learned.put(l.ip, l.domain, m.group, l.expires)
+		}
+	}
+}
+
+// matchResolved returns the rule the ip resolved for domain is learned by.
+func (p *Proxy) matchResolved(domain string, ip netip.Addr) match {
+	m := p.matchListDomain(domain)
+	if m.group == nil {
+		m = p.matchDomain(domain, acceptAll)
+	}
+	if m.group == nil {
+		m = p.matchGeoIP(ip, acceptAll)
+	}
+	return m
+}
+
 // Check checks availability of forwarders inside proxy.
 func (p *Proxy) Check() {
 	p.main.Check()
@@ -155,7 +465,51 @@ func (p *Proxy) Check() {
 	}
 }
 
+// Close stops health checking of all forwarders, connections established
+// through them are not affected.
+func (p *Proxy) Close() {
+	p.direct.Close()
+	if p.reject != nil {
+		p.reject.Close()
+	}
+
+	for _, fwdrGroup := range p.Groups() {
+		if !p.reusedGroups[fwdrGroup] {
+			fwdrGroup.close(p.reusedFwdrs)
+		}
+	}
+}
+
 // GetMainGroup 获取主转发器组
 func (p *Proxy) GetMainGroup() *FwdrGroup {
 	return p.main
 }
+
+// AddForwarder adds a new forwarder parsed from forward url s to group g.
+func (p *Proxy) AddForwarder(g *FwdrGroup, s string) (*Forwarder, error) {
+	f, err := g.AddForwarder(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if g == p.main {
+		p.directForwarderHost(f)
+	}
+
+	return f, nil
+}
+
+// Groups 获取所有转发器组，主转发器组排在第一位
+func (p *Proxy) Groups() []*FwdrGroup {
+	return append([]*FwdrGroup{p.main}, p.all...)
+}
+
+// Group 根据名称获取转发器组
+func (p *Proxy) Group(name string) *FwdrGroup {
+	for _, g := range p.Groups() {
+		if g.name == name {
+			return g
+		}
+	}
+	return nil
+}
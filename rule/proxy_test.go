@@ -0,0 +1,135 @@
+package rule
+
+import (
+	"slices"
+	"testing"
+)
+
+// availCount returns the number of available forwarders of group g.
+func availCount(g *FwdrGroup) int {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return len(g.avail)
+}
+
+func testStrategy() Strategy {
+	return Strategy{Strategy: "rr", MaxFailures: 3, DialTimeout: 3}
+}
+
+func TestProxyRenew(t *testing.T) {
+	c := testStrategy()
+	rules := []*Config{
+		{RulePath: "unchanged.rule", Forward: []string{"direct://#tag=a1", "direct://#tag=a2"}, Strategy: testStrategy()},
+		{RulePath: "removed.rule", Forward: []string{"direct://#tag=b1"}, Strategy: testStrategy()},
+		{RulePath: "strategy.rule", Forward: []string{"direct://#tag=c1"}, Strategy: testStrategy()},
+	}
+	old := NewProxy([]string{"direct://#tag=m1"}, &c, rules, nil, nil)
+
+	unchanged, removed, strategy := old.Group("unchanged"), old.Group("removed"), old.Group("strategy")
+	unchanged.SetCurrentProxy(unchanged.GetForwarders()[1])
+	m1 := old.main.GetForwarders()[0]
+
+	c2 := testStrategy()
+	apiStrategy := testStrategy()
+	apiStrategy.Strategy = "api"
+	newRules := []*Config{
+		{RulePath: "unchanged.rule", Forward: []string{"direct://#tag=a1", "direct://#tag=a2"}, Strategy: testStrategy()},
+		{RulePath: "strategy.rule", Forward: []string{"direct://#tag=c1"}, Strategy: apiStrategy},
+		{RulePath: "added.rule", Forward: []string{"direct://#tag=d1"}, Strategy: testStrategy()},
+	}
+	pxy := old.Renew([]string{"direct://#tag=m1", "direct://#tag=m2"}, &c2, newRules, nil, nil)
+	old.Close()
+
+	// unchanged group is reused with its state
+	if g := pxy.Group("unchanged"); g != unchanged {
+		t.Fatalf("unchanged group is not reused")
+	}
+	if f := unchanged.CurrentProxy(); f == nil || f.Tag() != "a2" {
+		t.Errorf("current proxy of unchanged group = %v, want a2", f)
+	}
+	for _, f := range unchanged.GetForwarders() {
+		if f.Closed() {
+			t.Errorf("forwarder %s of unchanged group is closed", f.Tag())
+		}
+	}
+
+	// removed group is closed
+	if pxy.Group("removed") != nil {
+		t.Errorf("removed group still exists")
+	}
+	for _, f := range removed.GetForwarders() {
+		if !f.Closed() {
+			t.Errorf("forwarder %s of removed group is not closed", f.Tag())
+		}
+	}
+
+	// added group is created
+	if g := pxy.Group("added"); g == nil || len(g.GetForwarders()) != 1 || g.GetForwarders()[0].Tag() != "d1" {
+		t.Errorf("added group is not created")
+	}
+
+	// changed groups are rebuilt and reuse the forwarders with unchanged dial settings
+	if g := pxy.Group("strategy"); g == strategy || g.Strategy() != "api" || g.GetForwarders()[0] != strategy.GetForwarders()[0] {
+		t.Errorf("group with changed strategy is not rebuilt with its forwarder reused")
+	}
+	if pxy.main == old.main || len(pxy.main.GetForwarders()) != 2 {
+		t.Fatalf("changed main group is not rebuilt")
+	}
+	if !slices.Contains(pxy.main.GetForwarders(), m1) || m1.Closed() {
+		t.Errorf("forwarder m1 of main group is not reused")
+	}
+
+	// status changes of the reused forwarder are handled by the new group only
+	m1.Enable()
+	if n, o := availCount(pxy.main), availCount(old.main); n != 1 || o != 0 {
+		t.Errorf("available forwarders: new main %d, old main %d, want 1 and 0", n, o)
+	}
+}
+
+func TestProxyDomainRules(t *testing.T) {
+	c := testStrategy()
+	rules := []*Config{
+		{RulePath: "full.rule", Forward: []string{"direct://#tag=full"}, Strategy: testStrategy(),
+			DomainFull: []string{"www.Example.com"}},
+		{RulePath: "suffix.rule", Forward: []string{"direct://#tag=suffix"}, Strategy: testStrategy(),
+			Domain: []string{"example.com"}},
+		{RulePath: "keyword.rule", Forward: []string{"direct://#tag=keyword"}, Strategy: testStrategy(),
+			DomainKeyword: []string{"cdn", "example"}},
+		{RulePath: "regex.rule", Forward: []string{"direct://#tag=regex"}, Strategy: testStrategy(),
+			DomainRegex: []string{`^img\d+\.`, `(`}},
+		{RulePath: "keyword2.rule", Forward: []string{"direct://#tag=keyword2"}, Strategy: testStrategy(),
+			DomainKeyword: []string{"static"}},
+	}
+	p := NewProxy([]string{"direct://#tag=m"}, &c, rules, nil, nil)
+	t.Cleanup(p.Close)
+
+	tests := []struct {
+		host      string
+		group     string
+		directive string
+		value     string
+	}{
+		{"www.example.com", "full", "domain-full", "www.example.com"},
+		{"WWW.EXAMPLE.COM", "full", "domain-full", "www.example.com"},
+		// full match only
+		{"a.www.example.com", "suffix", "domain", "example.com"},
+		{"example.com", "suffix", "domain", "example.com"},
+		// suffix rules win over keyword and regex rules
+		{"cdn.example.com", "suffix", "domain", "example.com"},
+		{"cdn.example.net", "keyword", "domain-keyword", "cdn"},
+		{"myexample.net", "keyword", "domain-keyword", "example"},
+		// keyword rules win over regex rules
+		{"img1.cdn.net", "keyword", "domain-keyword", "cdn"},
+		{"img1.static.net", "keyword2", "domain-keyword", "static"},
+		{"img12.foo.net", "regex", "domain-regex", `^img\d+\.`},
+		{"img.foo.net", "main", "", ""},
+	}
+
+	for _, tt := range tests {
+		m := p.route(nil, "tcp", tt.host+":443")
+		if m.group.Name() != tt.group || m.directive != tt.directive || m.value != tt.value {
+			t.Errorf("route(%s) = %s %s %s, want %s %s %s", tt.host,
+				m.group.Name(), m.directive, m.value, tt.group, tt.directive, tt.value)
+		}
+	}
+}
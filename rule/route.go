@@ -0,0 +1,56 @@
+package rule
+
+import (
+	"github.com/nadoo/glider/proxy"
+)
+
+// match is a rule matched by a request.
+type match struct {
+	group     *FwdrGroup
+	directive string
+	value     string
+}
+
+// Route explains how a request is routed by the rule proxy.
+type Route struct {
+	// Group is the forwarder group the request is forwarded by
+	Group *FwdrGroup
+
+	// RuleFile is the path of the rule file or the rule list matched, empty
+	// for the main group and the forwarder hosts accessed directly
+	RuleFile string
+
+	// Directive is the directive of the matched rule: ip, learned, cidr,
+	// geoip, domain-full, domain, domain-keyword, domain-regex, conditions
+	// or forwarder, the rule type like DOMAIN-SUFFIX for the rule list,
+	// empty if no rule matched and the main group is used
+	Directive string
+
+	// Value is the value of the matched directive, for learned ips it's
+	// the domain the ip was resolved for
+	Value string
+
+	// Forwarder is the forwarder the strategy of the group would pick now
+	Forwarder *Forwarder
+}
+
+// Explain returns how the request to dstAddr would be routed now, nothing is
+// dialed and the state of the forwarder groups is not changed.
+func (p *Proxy) Explain(meta *proxy.Metadata, network, dstAddr string) Route {
+	m := p.route(meta, network, dstAddr)
+
+	r := Route{
+		Group:     m.group,
+		Directive: m.directive,
+		Value:     m.value,
+		Forwarder: m.group.peekForwarder(dstAddr),
+	}
+	switch {
+	case isListType(m.directive):
+		r.RuleFile = p.listPath
+	case m.group != p.main && m.group != p.direct:
+		r.RuleFile = m.group.rulePath
+	}
+
+	return r
+}
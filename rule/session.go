@@ -0,0 +1,226 @@
+package rule
+
+import (
+	"cmp"
+	"container/list"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"slices"
+	"time"
+
+	"github.com/nadoo/glider/pkg/log"
+	"github.com/nadoo/glider/proxy"
+)
+
+const (
+	// sessionMaxSize is the max number of sticky sessions of a group, the
+	// least recently used ones are evicted when exceeded.
+	sessionMaxSize = 65536
+
+	// sessionPruneInterval is the interval to remove expired sessions.
+	sessionPruneInterval = time.Minute
+)
+
+// Session is a sticky session in api strategy, connections of the session
+// are dialed via the same forwarder until the session expires.
+type Session struct {
+	ID        string
+	Forwarder *Forwarder
+	Created   time.Time
+	LastUsed  time.Time
+}
+
+// DialMeta connects to the address addr on the network net, the client
+// request is dialed via its session forwarder if it carries a session id.
+func (p *FwdrGroup) DialMeta(meta *proxy.Metadata, network, addr string) (net.Conn, proxy.Dialer, error) {
+	nd := p.nextDialerMeta(meta, addr)
+	c, err := nd.Dial(network, addr)
+	p.emitDial(nd, err)
+	return c, nd, err
+}
+
+// DialUDPMeta connects to the given address like DialMeta.
+func (p *FwdrGroup) DialUDPMeta(meta *proxy.Metadata, network, addr string) (net.PacketConn, proxy.UDPDialer, error) {
+	nd := p.nextDialerMeta(meta, addr)
+	pc, err := nd.DialUDP(network, addr)
+	p.emitDial(nd, err)
+	return pc, nd, err
+}
+
+// nextDialerMeta returns the next dialer for the client request.
+func (p *FwdrGroup) nextDialerMeta(meta *proxy.Metadata, dstAddr string) proxy.Dialer {
+	if p.strategy != "api" || meta == nil {
+		return p.NextDialer(dstAddr)
+	}
+
+	if _, session := proxy.SplitUser(meta.User); session == "" {
+		return p.NextDialer(dstAddr)
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.sessionForwarder(meta.User)
+}
+
+// sessionTTL returns the idle time before a session expires, 0 means never.
+func (p *FwdrGroup) sessionTTL() time.Duration {
+	return time.Duration(p.config.SessionTTL) * time.Second
+}
+
+// expired reports whether the session s is expired at now, must be called with p.sessMu held.
+func (p *FwdrGroup) expired(s *Session, now time.Time) bool {
+	ttl := p.sessionTTL()
+	return ttl > 0 && now.Sub(s.LastUsed) > ttl
+}
+
+// sessionForwarder returns the forwarder of session id, a new forwarder is
+// pinned if the session expired or its forwarder is not available, must be
+// called with p.mu held.
+func (p *FwdrGroup) sessionForwarder(id string) *Forwarder {
+	p.sessMu.Lock()
+	defer p.sessMu.Unlock()
+
+	now := time.Now()
+	if e, ok := p.sessions[id]; ok {
+		p.sessLRU.MoveToFront(e)
+		s := e.Value.(*Session)
+		if p.expired(s, now) || !p.available(s.Forwarder) {
+			s.Forwarder, s.Created = p.pickForwarder(nil), now
+			log.F("[group] %s: session %s pinned to %s", p.name, id, s.Forwarder.Addr())
+		}
+		s.LastUsed = now
+		return s.Forwarder
+	}
+
+	if p.sessions == nil {
+		p.sessions = make(map[string]*list.Element)
+		p.sessLRU = list.New()
+		go p.pruneLoop()
+	}
+
+	s := &Session{ID: id, Forwarder: p.pickForwarder(nil), Created: now, LastUsed: now}
+	p.sessions[id] = p.sessLRU.PushFront(s)
+	log.F("[group] %s: session %s pinned to %s", p.name, id, s.Forwarder.Addr())
+
+	// evict the least recently used ones
+	for p.sessLRU.Len() > sessionMaxSize {
+		p.removeSession(p.sessLRU.Back())
+	}
+
+	return s.Forwarder
+}
+
+// available reports whether fwdr can be used by sessions, must be called with p.mu held.
+func (p *FwdrGroup) available(fwdr *Forwarder) bool {
+	if fwdr.Closed() {
+		return false
+	}
+	return fwdr.Enabled() || len(p.avail) == 0
+}
+
+// pickForwarder randomly picks an available forwarder other than exclude
+// if possible, must be called with p.mu held.
+func (p *FwdrGroup) pickForwarder(exclude *Forwarder) *Forwarder {
+	fwdrs := p.avail
+	if len(fwdrs) == 0 {
+		fwdrs = p.fwdrs
+	}
+
+	if exclude != nil && len(fwdrs) > 1 {
+		fwdrs = slices.DeleteFunc(slices.Clone(fwdrs), func(f *Forwarder) bool { return f == exclude })
+	}
+
+	return fwdrs[rand.IntN(len(fwdrs))]
+}
+
+// pruneLoop removes expired sessions periodically until the group is closed.
+func (p *FwdrGroup) pruneLoop() {
+	ticker := time.NewTicker(sessionPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case now := <-ticker.C:
+			p.sessMu.Lock()
+			p.pruneSessions(now)
+			p.sessMu.Unlock()
+		}
+	}
+}
+
+// pruneSessions removes expired sessions, must be called with p.sessMu held.
+func (p *FwdrGroup) pruneSessions(now time.Time) {
+	for e := p.sessLRU.Back(); e != nil; {
+		prev := e.Prev()
+		if s := e.Value.(*Session); p.expired(s, now) || s.Forwarder.Closed() {
+			p.removeSession(e)
+		}
+		e = prev
+	}
+}
+
+// removeSession removes session e, must be called with p.sessMu held.
+func (p *FwdrGroup) removeSession(e *list.Element) {
+	delete(p.sessions, e.Value.(*Session).ID)
+	p.sessLRU.Remove(e)
+}
+
+// Sessions returns the sticky sessions which are not expired ordered by id.
+func (p *FwdrGroup) Sessions() []Session {
+	p.sessMu.Lock()
+	defer p.sessMu.Unlock()
+
+	if p.sessLRU == nil {
+		return nil
+	}
+	p.pruneSessions(time.Now())
+
+	sessions := make([]Session, 0, len(p.sessions))
+	for e := p.sessLRU.Front(); e != nil; e = e.Next() {
+		sessions = append(sessions, *e.Value.(*Session))
+	}
+	slices.SortFunc(sessions, func(a, b Session) int { return cmp.Compare(a.ID, b.ID) })
+
+	return sessions
+}
+
+// RerollSession pins session id to another forwarder.
+func (p *FwdrGroup) RerollSession(id string) (Session, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	p.sessMu.Lock()
+	defer p.sessMu.Unlock()
+
+	e, ok := p.sessions[id]
+	if !ok || p.expired(e.Value.(*Session), time.Now()) {
+		return Session{}, fmt.Errorf("session %s not found in group %s", id, p.name)
+	}
+	s := e.Value.(*Session)
+
+	old := s.Forwarder
+	s.Forwarder = p.pickForwarder(old)
+	log.F("[group] %s: session %s re-pinned from %s to %s", p.name, id, old.Addr(), s.Forwarder.Addr())
+
+	return *s, nil
+}
+
+// ExpireSession removes session id, the next connection of the session will
+// be pinned to a new forwarder.
+func (p *FwdrGroup) ExpireSession(id string) bool {
+	p.sessMu.Lock()
+	defer p.sessMu.Unlock()
+
+	e, ok := p.sessions[id]
+	if !ok {
+		return false
+	}
+
+	p.removeSession(e)
+	log.F("[group] %s: session %s expired", p.name, id)
+
+	return true
+}
@@ -0,0 +1,183 @@
+package rule
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/nadoo/glider/proxy"
+)
+
+// newSessionGroup returns a group in api mode with n enabled forwarders.
+func newSessionGroup(t *testing.T, n int, ttl int) *FwdrGroup {
+	t.Helper()
+
+	c := testStrategy()
+	c.Strategy, c.SessionTTL = "api", ttl
+
+	var forwards []string
+	for i := range n {
+		forwards = append(forwards, fmt.Sprintf("direct://#tag=f%d", i))
+	}
+	g := NewFwdrGroup("sessions.rule", forwards, &c)
+	t.Cleanup(g.Close)
+
+	for _, f := range g.GetForwarders() {
+		f.Enable()
+	}
+	return g
+}
+
+func TestSessionPinning(t *testing.T) {
+	g := newSessionGroup(t, 8, 600)
+	meta := func(user string) *proxy.Metadata { return &proxy.Metadata{User: user} }
+
+	tests := []struct {
+		name   string
+		user   string
+		pinned bool
+	}{
+		{"session", "alice-session-1", true},
+		{"other session of the same user", "alice-session-2", true},
+		{"no session id", "alice", false},
+		{"no user", "", false},
+	}
+
+	for _, tt := range tests {
+		first := g.nextDialerMeta(meta(tt.user), "example.com:443")
+		for range 20 {
+			if d := g.nextDialerMeta(meta(tt.user), "example.com:443"); tt.pinned && d != first {
+				t.Errorf("%s: dialed via %s then %s, want the pinned forwarder", tt.name, first.Addr(), d.Addr())
+			}
+		}
+	}
+	// requests without session ids create no sessions
+	if n := len(g.Sessions()); n != 2 {
+		t.Errorf("%d sessions, want 2", n)
+	}
+
+	// udp requests of the session use the same forwarder
+	pinned := g.nextDialerMeta(meta("alice-session-1"), "example.com:443")
+	pc, d, err := g.DialUDPMeta(meta("alice-session-1"), "udp", "127.0.0.1:53")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc.Close()
+	if d != pinned {
+		t.Errorf("udp dialed via %s, want the pinned forwarder %s", d.Addr(), pinned.Addr())
+	}
+
+	// the session is pinned to another forwarder when its forwarder is disabled
+	pinned.(*Forwarder).Disable()
+	if d := g.nextDialerMeta(meta("alice-session-1"), "example.com:443"); d == pinned {
+		t.Errorf("session still pinned to the disabled forwarder %s", d.Addr())
+	}
+
+	// re-roll and expire
+	s, err := g.RerollSession("alice-session-2")
+	if err != nil || s.Forwarder == nil {
+		t.Fatalf("RerollSession() = %+v, %v", s, err)
+	}
+	if d := g.nextDialerMeta(meta("alice-session-2"), "example.com:443"); d != s.Forwarder {
+		t.Errorf("dialed via %s after re-roll, want %s", d.Addr(), s.Forwarder.Addr())
+	}
+	if !g.ExpireSession("alice-session-2") || g.ExpireSession("alice-session-2") {
+		t.Errorf("ExpireSession() should remove the session once")
+	}
+	if _, err := g.RerollSession("alice-session-2"); err == nil {
+		t.Errorf("RerollSession() of an expired session succeeded")
+	}
+}
+
+func TestSessionLRU(t *testing.T) {
+	g := newSessionGroup(t, 2, 0)
+
+	g.mu.RLock()
+	for i := range sessionMaxSize {
+		g.sessionForwarder(fmt.Sprintf("user-session-%d", i))
+	}
+	// session 0 becomes the most recently used, session 1 the least
+	g.sessionForwarder("user-session-0")
+	g.sessionForwarder("user-session-new")
+	g.mu.RUnlock()
+
+	g.sessMu.Lock()
+	defer g.sessMu.Unlock()
+
+	if n := g.sessLRU.Len(); n != sessionMaxSize || len(g.sessions) != sessionMaxSize {
+		t.Errorf("%d sessions, want at most %d", n, sessionMaxSize)
+	}
+	for id, want := range map[string]bool{"user-session-0": true, "user-session-1": false, "user-session-new": true} {
+		if _, ok := g.sessions[id]; ok != want {
+			t.Errorf("session %s found = %v, want %v", id, ok, want)
+		}
+	}
+}
+
+func TestSessionPrune(t *testing.T) {
+	tests := []struct {
+		name  string
+		ttl   int
+		after time.Duration
+		close bool
+		left  int
+	}{
+		{"unexpired", 600, 9 * time.Minute, false, 2},
+		{"expired", 600, 11 * time.Minute, false, 0},
+		{"never expire", 0, 24 * time.Hour, false, 2},
+		{"forwarder closed", 0, 0, true, 0},
+	}
+
+	for _, tt := range tests {
+		g := newSessionGroup(t, 1, tt.ttl)
+
+		g.mu.RLock()
+		g.sessionForwarder("user-session-1")
+		g.sessionForwarder("user-session-2")
+		g.mu.RUnlock()
+
+		if tt.close {
+			g.GetForwarders()[0].Close()
+		}
+
+		g.sessMu.Lock()
+		g.pruneSessions(time.Now().Add(tt.after))
+		left := g.sessLRU.Len()
+		g.sessMu.Unlock()
+
+		if left != tt.left {
+			t.Errorf("%s: %d sessions left after pruning, want %d", tt.name, left, tt.left)
+		}
+	}
+}
+
+func TestProxyDialUDPMeta(t *testing.T) {
+	c := testStrategy()
+	c.Strategy = "api"
+	p := NewProxy([]string{"direct://#tag=a", "direct://#tag=b", "direct://#tag=c"}, &c, nil, nil, nil)
+	t.Cleanup(p.Close)
+
+	meta := &proxy.Metadata{User: "bob-session-x", SrcAddr: &net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 5353}}
+	pc, want, err := p.DialUDPMeta(meta, "udp", "127.0.0.1:53")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc.Close()
+
+	for range 10 {
+		pc, d, err := p.DialUDPMeta(meta, "udp", "127.0.0.1:53")
+		if err != nil {
+			t.Fatal(err)
+		}
+		pc.Close()
+		if d != want {
+			t.Fatalf("udp dialed via %s, want the session forwarder %s", d.Addr(), want.Addr())
+		}
+	}
+
+	sessions := p.main.Sessions()
+	if len(sessions) != 1 || sessions[0].ID != meta.User || sessions[0].Forwarder != want {
+		t.Errorf("Sessions() = %+v, want session %s", sessions, meta.User)
+	}
+}
@@ -34,6 +34,7 @@ type dhcpd struct {
 	lease  time.Duration
 	iface  *net.Interface
 	server *server4.Server
+	done   chan struct{}
 }
 
 // NewService returns a new dhcpd Service.
@@ -93,6 +94,7 @@ func New(failover bool, args ...string) (*dhcpd, error) {
 		pool:     pool,
 		lease:    lease,
 		failover: failover,
+		done:     make(chan struct{}),
 	}
 
 	if dhcpd.server, err = server4.NewServer(
@@ -112,15 +114,63 @@ func (d *dhcpd) Run() {
 	if d.failover {
 		d.setFailover(discovery(d.iface))
 		go func() {
+			ticker := time.NewTicker(time.Second * 60)
+			defer ticker.Stop()
 			for {
-				d.setFailover(discovery(d.iface))
-				time.Sleep(time.Second * 60)
+				select {
+				case <-d.done:
+					return
+				case <-ticker.C:
+					d.setFailover(discovery(d.iface))
+				}
 			}
 		}()
 	}
 	d.server.Serve()
 }
 
+// Stop stops the service.
+func (d *dhcpd) Stop() {
+	close(d.done)
+	d.server.Close()
+}
+
+// Interface returns the name of the interface the service listens on.
+func (d *dhcpd) Interface() string { return d.name }
+
+// Leases returns the current leases, including static ips.
+func (d *dhcpd) Leases() []Lease { return d.pool.Leases() }
+
+// Contains reports whether ip is in the dhcp pool.
+func (d *dhcpd) Contains(ip netip.Addr) bool { return d.pool.Contains(ip) }
+
+// Reserve reserves ip for mac as a static ip.
+func (d *dhcpd) Reserve(mac net.HardwareAddr, ip netip.Addr) error {
+	if err := d.pool.ReserveIP(mac, ip); err != nil {
+		return err
+	}
+	log.F("[dhcpd] %s: reserved %s for %s", d.name, ip, mac)
+	return nil
+}
+
+// Unreserve removes the static ip of mac.
+func (d *dhcpd) Unreserve(mac net.HardwareAddr) bool {
+	if !d.pool.UnreserveIP(mac) {
+		return false
+	}
+	log.F("[dhcpd] %s: removed static ip of %s", d.name, mac)
+	return true
+}
+
+// Release releases the dynamic lease of mac.
+func (d *dhcpd) Release(mac net.HardwareAddr) bool {
+	if !d.pool.ReleaseIP(mac) {
+		return false
+	}
+	log.F("[dhcpd] %s: released lease of %s", d.name, mac)
+	return true
+}
+
 func (d *dhcpd) handleDHCP(serverIP net.IP, mask net.IPMask, pool *Pool) server4.Handler {
 	return func(conn net.PacketConn, peer net.Addr, m *dhcpv4.DHCPv4) {
 
@@ -0,0 +1,47 @@
+package dhcpd
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"time"
+)
+
+var (
+	// ErrNotInPool is returned when reserving an ip out of the dhcp pool.
+	ErrNotInPool = errors.New("ip is not in the dhcp pool")
+
+	// ErrReserved is returned when reserving an ip reserved for another mac.
+	ErrReserved = errors.New("ip is reserved for another mac")
+)
+
+// Lease is an ip leased from the dhcp pool.
+type Lease struct {
+	IP      netip.Addr
+	MAC     net.HardwareAddr
+	Expires time.Time // zero for static ips
+}
+
+// Static reports whether the lease is a static ip.
+func (l Lease) Static() bool { return l.Expires.IsZero() }
+
+// Manager manages the leases of a dhcpd service at runtime.
+type Manager interface {
+	// Interface returns the name of the interface the service listens on
+	Interface() string
+
+	// Leases returns the current leases, including static ips
+	Leases() []Lease
+
+	// Contains reports whether ip is in the dhcp pool
+	Contains(ip netip.Addr) bool
+
+	// Reserve reserves ip for mac as a static ip, the previous leases of mac are released
+	Reserve(mac net.HardwareAddr, ip netip.Addr) error
+
+	// Unreserve removes the static ip of mac
+	Unreserve(mac net.HardwareAddr) bool
+
+	// Release releases the dynamic lease of mac
+	Release(mac net.HardwareAddr) bool
+}
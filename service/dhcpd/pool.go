@@ -116,8 +116,9 @@ func (p *Pool) LeaseStaticIP(mac net.HardwareAddr, ip netip.Addr) {
 	}
 }
 
-// ReleaseIP releases ip from pool according to the given mac.
-func (p *Pool) ReleaseIP(mac net.HardwareAddr) {
+// ReleaseIP releases ip from pool according to the given mac,
+// it reports whether any ip was released.
+func (p *Pool) ReleaseIP(mac net.HardwareAddr) (released bool) {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
 
@@ -126,8 +127,83 @@ func (p *Pool) ReleaseIP(mac net.HardwareAddr) {
 		if !item.expire.IsZero() && bytes.Equal(mac, item.mac) {
 			item.mac = nil
 			item.expire = time.Time{}
+			released = true
 		}
 	}
+	return
+}
+
+// ReserveIP reserves ip in pool as the static ip of mac, the previous leases of mac are released.
+// The client currently using ip, if any, will get a new ip when it renews the lease.
+func (p *Pool) ReserveIP(mac net.HardwareAddr, ip netip.Addr) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	var target *item
+	for _, item := range p.items {
+		if item.ip == ip {
+			target = item
+			break
+		}
+	}
+
+	if target == nil {
+		return ErrNotInPool
+	}
+
+	if target.mac != nil && target.expire.IsZero() && !bytes.Equal(target.mac, mac) {
+		return ErrReserved
+	}
+
+	for _, item := range p.items {
+		if bytes.Equal(mac, item.mac) {
+			item.mac = nil
+			item.expire = time.Time{}
+		}
+	}
+
+	target.mac = mac
+	target.expire = time.Time{}
+	return nil
+}
+
+// UnreserveIP removes the static ip of mac from pool, it reports whether any ip was removed.
+func (p *Pool) UnreserveIP(mac net.HardwareAddr) (removed bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for _, item := range p.items {
+		if item.expire.IsZero() && bytes.Equal(mac, item.mac) {
+			item.mac = nil
+			removed = true
+		}
+	}
+	return
+}
+
+// Leases returns all the leased ips in pool, including static ips,
+// expired leases not yet released are excluded.
+func (p *Pool) Leases() []Lease {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	now := time.Now()
+	var leases []Lease
+	for _, item := range p.items {
+		if item.mac != nil && (item.expire.IsZero() || now.Before(item.expire)) {
+			leases = append(leases, Lease{IP: item.ip, MAC: item.mac, Expires: item.expire})
+		}
+	}
+	return leases
+}
+
+// Contains reports whether ip is in pool.
+func (p *Pool) Contains(ip netip.Addr) bool {
+	if !ip.Is4() || len(p.items) == 0 {
+		return false
+	}
+	n := ipv4ToNum(ip)
+	return n >= ipv4ToNum(p.items[0].ip) && n <= ipv4ToNum(p.items[len(p.items)-1].ip)
 }
 
 func ipv4ToNum(addr netip.Addr) uint32 {
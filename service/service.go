@@ -8,7 +8,13 @@ import (
 var creators = make(map[string]Creator)
 
 // Service is a server that can be run.
-type Service interface{ Run() }
+type Service interface {
+	// Run runs the service, it blocks until the service stopped
+	Run()
+
+	// Stop stops the service
+	Stop()
+}
 
 // Creator is a function to create services.
 type Creator func(args ...string) (Service, error)
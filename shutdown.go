@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/nadoo/glider/dns"
+	"github.com/nadoo/glider/pkg/log"
+	"github.com/nadoo/glider/proxy"
+	"github.com/nadoo/glider/service"
+)
+
+// API服务器关闭的最长等待时间
+const apiShutdownTimeout = 3 * time.Second
+
+// shutdown 优雅关闭：先停止所有监听器、DNS服务器和服务，然后最多等待当前配置的 ShutdownTimeout
+// 让正在转发的TCP连接结束，超时或再次收到信号时强制关闭剩余连接，最后关闭API服务器。
+// UDP会话不在连接表中，不会等待，随进程退出关闭
+func shutdown(sigCh <-chan os.Signal, apiServer *http.Server, d *dns.Server, services []service.Service) {
+	reloadMu.Lock()
+	// 使用重载后的配置
+	timeout := time.Duration(loadedConf.ShutdownTimeout) * time.Second
+	log.Printf("[main] shutting down, waiting up to %v for connections to finish", timeout)
+
+	stopping = true
+	for listen := range servers {
+		stopServer(listen)
+	}
+	reloadMu.Unlock()
+
+	if d != nil {
+		if err := d.Close(); err != nil {
+			log.F("[main] close dns server error: %v", err)
+		}
+	}
+
+	for _, s := range services {
+		s.Stop()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// 再次收到信号时不再等待
+	go func() {
+		for {
+			select {
+			case sig := <-sigCh:
+				if sig == syscall.SIGINT || sig == syscall.SIGTERM {
+					cancel()
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	if n := proxy.Drain(ctx); n > 0 {
+		log.Printf("[main] closed %d connections not finished in time", n)
+	}
+
+	if apiServer != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), apiShutdownTimeout)
+		defer cancel()
+		if err := apiServer.Shutdown(ctx); err != nil {
+			apiServer.Close()
+		}
+	}
+
+	if err := stateFile.save(); err != nil {
+		log.Printf("[state] failed to save state file: %v", err)
+	}
+
+	log.Printf("[main] shutdown complete")
+}
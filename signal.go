@@ -0,0 +1,11 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// checkSignals are the signals to check all forwarders immediately.
+var checkSignals = []os.Signal{syscall.SIGUSR1}
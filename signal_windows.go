@@ -0,0 +1,7 @@
+package main
+
+import "os"
+
+// checkSignals are the signals to check all forwarders immediately, SIGUSR1
+// is not available on windows.
+var checkSignals []os.Signal
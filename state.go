@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"slices"
+	"sync"
+
+	"github.com/nadoo/glider/pkg/log"
+	"github.com/nadoo/glider/rule"
+)
+
+// groupState 持久化的转发器组状态，转发器都以 URL 表示
+type groupState struct {
+	Current   string   `json:"current,omitempty"`   // api 模式下当前选中的代理
+	Suspended []string `json:"suspended,omitempty"` // 通过 API 手动禁用的代理
+	Added     []string `json:"added,omitempty"`     // 通过 API 添加的代理
+}
+
+// runtimeState 持久化的运行时状态
+type runtimeState struct {
+	Groups map[string]*groupState `json:"groups"`
+}
+
+// stateStore 将通过 API 修改的运行时状态保存到状态文件，启动和重新加载配置时恢复
+type stateStore struct {
+	path  string
+	dirty chan struct{}
+
+	mu    sync.Mutex
+	added map[string][]string // 按组名索引的通过 API 添加的代理
+}
+
+// 状态文件，未设置 apistatefile 时为 nil
+var stateFile *stateStore
+
+// newStateStore 创建状态文件并在后台保存状态的变化
+func newStateStore(path string) *stateStore {
+	s := &stateStore{path: path, dirty: make(chan struct{}, 1), added: make(map[string][]string)}
+	go s.run()
+	return s
+}
+
+// load 读取状态文件，文件不存在时返回空的状态
+func (s *stateStore) load() (*runtimeState, error) {
+	st := &runtimeState{Groups: make(map[string]*groupState)}
+
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, st); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// apply 将状态文件中的状态恢复到规则代理，必须在启动健康检查之前调用
+func (s *stateStore) apply(pxy *rule.Proxy) {
+	if s == nil {
+		return
+	}
+
+	st, err := s.load()
+	if err != nil {
+		log.Printf("[state] failed to load state file %s: %v", s.path, err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.added = make(map[string][]string)
+	for name, gs := range st.Groups {
+		g := pxy.Group(name)
+		if g == nil {
+			log.F("[state] group %s not found, state ignored", name)
+			continue
+		}
+
+		for _, url := range gs.Added {
+			// 重新加载时复用的组中已经有这个代理
+			if findProxy(g.GetForwarders(), func(f *rule.Forwarder) bool { return f.URL() == url }) != nil {
+				s.added[name] = append(s.added[name], url)
+				continue
+			}
+			if _, err := pxy.AddForwarder(g, url); err != nil {
+				log.F("[state] %s: failed to restore proxy: %v", name, err)
+				continue
+			}
+			s.added[name] = append(s.added[name], url)
+		}
+
+		fwdrs := g.GetForwarders()
+		for _, url := range gs.Suspended {
+			if f := findProxy(fwdrs, func(f *rule.Forwarder) bool { return f.URL() == url }); f != nil {
+				f.Suspend()
+			}
+		}
+
+		if gs.Current != "" {
+			if f := findProxy(fwdrs, func(f *rule.Forwarder) bool { return f.URL() == gs.Current }); f != nil {
+				g.SetCurrentProxy(f)
+			}
+		}
+	}
+
+	log.F("[state] restored state from %s", s.path)
+}
+
+// addForwarder 记录通过 API 添加的代理
+func (s *stateStore) addForwarder(group, url string) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.added[group] = append(s.added[group], url)
+	s.mu.Unlock()
+
+	s.changed()
+}
+
+// removeForwarder 删除代理后不再恢复它
+func (s *stateStore) removeForwarder(group, url string) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.added[group] = slices.DeleteFunc(s.added[group], func(u string) bool { return u == url })
+	s.mu.Unlock()
+
+	s.changed()
+}
+
+// changed 通知后台保存状态，不会阻塞
+func (s *stateStore) changed() {
+	if s == nil {
+		return
+	}
+
+	select {
+	case s.dirty <- struct{}{}:
+	default:
+	}
+}
+
+// run 在状态变化后保存状态文件
+func (s *stateStore) run() {
+	for range s.dirty {
+		if err := s.save(); err != nil {
+			log.Printf("[state] failed to save state file %s: %v", s.path, err)
+		}
+	}
+}
+
+// save 保存API管理器中所有组的状态
+func (s *stateStore) save() error {
+	if s == nil {
+		return nil
+	}
+
+	groups := apiManager.Groups()
+	if groups == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := &runtimeState{Groups: make(map[string]*groupState)}
+	for _, g := range groups {
+		gs := &groupState{}
+		fwdrs := g.GetForwarders()
+		for _, f := range fwdrs {
+			if f.Suspended() {
+				gs.Suspended = append(gs.Suspended, f.URL())
+			}
+		}
+		for _, url := range s.added[g.Name()] {
+			if findProxy(fwdrs, func(f *rule.Forwarder) bool { return f.URL() == url }) != nil {
+				gs.Added = append(gs.Added, url)
+			}
+		}
+		if g.Strategy() == "api" {
+			if f := g.CurrentProxy(); f != nil {
+				gs.Current = f.URL()
+			}
+		}
+		if gs.Current != "" || len(gs.Suspended) > 0 || len(gs.Added) > 0 {
+			st.Groups[g.Name()] = gs
+		}
+	}
+
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// 先写入临时文件再改名，避免写入过程中退出导致文件损坏
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}